@@ -1,32 +1,158 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"github.com/SawitProRecruitment/UserService/handler"
 	"github.com/SawitProRecruitment/UserService/internal"
+	"github.com/SawitProRecruitment/UserService/model"
+	userv1 "github.com/SawitProRecruitment/UserService/proto/user/v1"
 	"github.com/SawitProRecruitment/UserService/repository"
 	"github.com/SawitProRecruitment/UserService/transport"
 	"log"
+	"net"
+	"time"
 
+	authv3 "github.com/envoyproxy/go-control-plane/envoy/service/auth/v3"
 	"github.com/labstack/echo/v4"
+	"google.golang.org/grpc"
 )
 
 func main() {
+	cfg, err := internal.LoadConfig(".")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	phones, err := model.NewPhoneNumbering(cfg.Phone.DefaultCountry, cfg.Phone.AllowedCountries, cfg.Phone.Countries...)
+	if err != nil {
+		log.Fatal(err)
+	}
+	model.SetPhoneNumbering(phones)
+
+	passwords, err := cfg.Password.PasswordPolicy()
+	if err != nil {
+		log.Fatal(err)
+	}
+	model.SetPasswordPolicy(passwords)
+
+	hasher, err := cfg.Hashing.Hasher()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err = model.SetPasswordHasher(hasher); err != nil {
+		log.Fatal(err)
+	}
+
+	if err = cfg.SessionCookie.Validate(); err != nil {
+		log.Fatal(err)
+	}
+
+	shutdownTracer, err := internal.InitTracer(context.Background(), cfg.Tracing)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer func() {
+		_ = shutdownTracer(context.Background())
+	}()
+
 	e := echo.New()
+	e.Use(transport.TracingMiddleware(cfg.Tracing.ServiceName), transport.RequestLogger())
 
-	var server handler.HandlerInterface = newServer()
+	repo, err := newRepository(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer func() {
+		_ = repo.Close()
+	}()
 
-	transport.RegisterHandler(e, server)
-	e.Logger.Fatal(e.Start(":8080"))
+	var sms internal.SMSSender
+	if cfg.SMS.Enabled() {
+		if sms, err = cfg.SMS.Sender(); err != nil {
+			log.Fatal(err)
+		}
+	} else {
+		log.Println("sms.webhook_url is not set, login with texted codes is disabled")
+	}
+
+	var server handler.HandlerInterface = handler.NewServer(cfg, handler.NewServerOptions{
+		Repository: repo,
+		SMS:        sms,
+	})
+
+	transport.RegisterHandler(e, server, repo, cfg)
+	defer sweepExpiredChallenges(repo, cfg.OTP.SendWindow)()
+
+	if cfg.ExtAuthz.Address != "" {
+		stop := serveGRPC(cfg.ExtAuthz.Address, func(s *grpc.Server) {
+			authv3.RegisterAuthorizationServer(s, transport.NewExtAuthzServer(repo, cfg.Admin.UserIDs, cfg.SessionCookie))
+		})
+		defer stop()
+	}
+	if cfg.GRPC.Address != "" {
+		stop := serveGRPC(cfg.GRPC.Address, func(s *grpc.Server) {
+			userv1.RegisterUserServiceServer(s, transport.NewUserServiceServer(server))
+		}, grpc.UnaryInterceptor(transport.AuthInterceptor(repo)))
+		defer stop()
+	}
+
+	if err := e.Start(":8080"); err != nil {
+		log.Println(err)
+	}
 }
 
-func newServer() *handler.Server {
-	cfg, err := internal.LoadConfig(".")
+// serveGRPC starts a gRPC server on address with the services register adds,
+// returning the function stopping it.
+func serveGRPC(address string, register func(s *grpc.Server), opts ...grpc.ServerOption) func() {
+	lis, err := net.Listen("tcp", address)
 	if err != nil {
 		log.Fatal(err)
 	}
+	grpcServer := grpc.NewServer(opts...)
+	register(grpcServer)
+	go func() {
+		if err := grpcServer.Serve(lis); err != nil {
+			log.Println(err)
+		}
+	}()
+	return grpcServer.GracefulStop
+}
+
+// challengeSweepInterval is how often expired challenges and login codes are
+// deleted.
+const challengeSweepInterval = time.Minute
+
+// sweepExpiredChallenges deletes expired challenges and login codes every
+// challengeSweepInterval, returning the function stopping it.
+func sweepExpiredChallenges(repo repository.RepositoryInterface, otpWindow time.Duration) func() {
+	ticker := time.NewTicker(challengeSweepInterval)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				if err := repo.DeleteExpiredChallenges(context.Background(), otpWindow); err != nil {
+					log.Printf("deleting expired challenges: %v", err)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		ticker.Stop()
+		close(done)
+	}
+}
 
-	var repo repository.RepositoryInterface = repository.NewRepository(repository.NewRepositoryOptions{
+type closableRepository interface {
+	repository.RepositoryInterface
+	Close() error
+}
+
+func newRepository(cfg internal.Config) (closableRepository, error) {
+	opts := repository.NewRepositoryOptions{
 		Dsn: fmt.Sprintf("%s://%s:%s@%s:%d/%s?sslmode=disable",
 			"postgres",
 			cfg.DB.User,
@@ -34,9 +160,20 @@ func newServer() *handler.Server {
 			cfg.DB.Host,
 			cfg.DB.Port,
 			cfg.DB.DatabaseName),
-	})
-	opts := handler.NewServerOptions{
-		Repository: repo,
+		MaxOpenConns:    cfg.DB.MaxOpenConns,
+		MaxIdleConns:    cfg.DB.MaxIdleConns,
+		ConnMaxLifetime: cfg.DB.ConnMaxLifetime,
+		ConnMaxIdleTime: cfg.DB.ConnMaxIdleTime,
+		ConnectRetries:  cfg.DB.ConnectRetries,
+		ConnectBackoff:  cfg.DB.ConnectBackoff,
+	}
+
+	switch cfg.DB.Driver {
+	case internal.DriverPostgres:
+		return repository.NewRepository(opts)
+	case internal.DriverPgx:
+		return repository.NewPgxRepository(opts)
+	default:
+		return nil, fmt.Errorf("unknown database driver %q", cfg.DB.Driver)
 	}
-	return handler.NewServer(cfg, opts)
 }
@@ -13,7 +13,156 @@ CREATE TABLE IF NOT EXISTS users (
     phone VARCHAR UNIQUE NOT NULL,
     name VARCHAR NOT NULL,
     password VARCHAR NOT NULL,
-    success_login bigint DEFAULT 0,
+    email VARCHAR,
+    email_verified_at TIMESTAMP,
+    avatar_url VARCHAR,
+    locale VARCHAR,
+    timezone VARCHAR,
+    success_login bigint NOT NULL DEFAULT 0,
+    last_login_at TIMESTAMP,
+    version bigint NOT NULL DEFAULT 1,
     created_at TIMESTAMP DEFAULT now(),
     updated_at TIMESTAMP
 );
+
+/** Emails are unique regardless of case. */
+CREATE UNIQUE INDEX IF NOT EXISTS users_email_key ON users (lower(email));
+
+/** Pending email verification, one per user. Only the SHA-256 of the token is stored. */
+CREATE TABLE IF NOT EXISTS email_verifications (
+    user_id uuid PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    email VARCHAR NOT NULL,
+    token_hash VARCHAR UNIQUE NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT now()
+);
+
+/** TOTP secret of a user, pending until a first code is confirmed. */
+CREATE TABLE IF NOT EXISTS user_totp (
+    user_id uuid PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    secret VARCHAR NOT NULL,
+    confirmed_at TIMESTAMP,
+    last_used_step bigint NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL DEFAULT now()
+);
+
+/** Single use MFA recovery codes. Only the SHA-256 of a code is stored. */
+CREATE TABLE IF NOT EXISTS mfa_recovery_codes (
+    user_id uuid NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    code_hash VARCHAR NOT NULL,
+    used_at TIMESTAMP,
+    PRIMARY KEY (user_id, code_hash)
+);
+
+/** Second login step, answered with a TOTP or recovery code. Only the SHA-256 of the token is stored. */
+CREATE TABLE IF NOT EXISTS mfa_challenges (
+    token_hash VARCHAR PRIMARY KEY,
+    user_id uuid NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    attempts int NOT NULL DEFAULT 0,
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS mfa_challenges_expires_at_idx ON mfa_challenges (expires_at);
+
+/** Login sessions. Access tokens carry the session ID and are refused once it is revoked. */
+CREATE TABLE IF NOT EXISTS sessions (
+    id uuid PRIMARY KEY,
+    user_id uuid NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    user_agent VARCHAR NOT NULL DEFAULT '',
+    ip VARCHAR NOT NULL DEFAULT '',
+    device_name VARCHAR NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT now(),
+    last_seen_at TIMESTAMP NOT NULL DEFAULT now(),
+    expires_at TIMESTAMP NOT NULL,
+    revoked_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS sessions_user_id_idx ON sessions (user_id);
+
+/** WebAuthn registration and login ceremonies in progress, keyed by the challenge sent to the authenticator. */
+CREATE TABLE IF NOT EXISTS webauthn_challenges (
+    challenge VARCHAR PRIMARY KEY,
+    ceremony VARCHAR NOT NULL,
+    user_id uuid REFERENCES users(id) ON DELETE CASCADE,
+    session_data bytea NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS webauthn_challenges_expires_at_idx ON webauthn_challenges (expires_at);
+
+/** Passkeys (WebAuthn credentials) users log in with instead of a password. */
+CREATE TABLE IF NOT EXISTS passkeys (
+    credential_id bytea PRIMARY KEY,
+    user_id uuid NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    public_key bytea NOT NULL,
+    attestation_type VARCHAR NOT NULL,
+    transports VARCHAR[] NOT NULL DEFAULT '{}',
+    aaguid bytea,
+    sign_count bigint NOT NULL DEFAULT 0,
+    backup_eligible boolean NOT NULL DEFAULT false,
+    backup_state boolean NOT NULL DEFAULT false,
+    clone_warning boolean NOT NULL DEFAULT false,
+    created_at TIMESTAMP NOT NULL DEFAULT now(),
+    last_used_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS passkeys_user_id_idx ON passkeys (user_id);
+
+/** One-time codes texted for passwordless logins. Requests for numbers without a user are recorded too, so that they count against the same limits. */
+CREATE TABLE IF NOT EXISTS login_otps (
+    id uuid PRIMARY KEY,
+    phone VARCHAR NOT NULL,
+    user_id uuid REFERENCES users(id) ON DELETE CASCADE,
+    code_hash VARCHAR NOT NULL,
+    attempts int NOT NULL DEFAULT 0,
+    expires_at TIMESTAMP NOT NULL,
+    consumed_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS login_otps_phone_created_at_idx ON login_otps (phone, created_at);
+CREATE INDEX IF NOT EXISTS login_otps_expires_at_idx ON login_otps (expires_at);
+
+/** Applications users log in to through OpenID Connect. Public clients have no secret and rely on PKCE alone. */
+CREATE TABLE IF NOT EXISTS oauth_clients (
+    id VARCHAR PRIMARY KEY,
+    secret_hash VARCHAR,
+    name VARCHAR NOT NULL,
+    redirect_uris VARCHAR[] NOT NULL DEFAULT '{}',
+    owner_id uuid NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS oauth_authorization_codes (
+    code_hash VARCHAR PRIMARY KEY,
+    client_id VARCHAR NOT NULL REFERENCES oauth_clients(id) ON DELETE CASCADE,
+    user_id uuid NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    redirect_uri VARCHAR NOT NULL,
+    scope VARCHAR NOT NULL,
+    nonce VARCHAR NOT NULL DEFAULT '',
+    code_challenge VARCHAR NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT now()
+);
+
+/** Backend jobs that get tokens for themselves with the client credentials grant. */
+CREATE TABLE IF NOT EXISTS machine_clients (
+    id VARCHAR PRIMARY KEY,
+    secret_hash VARCHAR NOT NULL,
+    name VARCHAR NOT NULL,
+    scopes VARCHAR[] NOT NULL DEFAULT '{}',
+    created_by uuid NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT now()
+);
+
+/** Scopes users granted to clients, so that they are only asked again for new ones. */
+CREATE TABLE IF NOT EXISTS oauth_consents (
+    user_id uuid NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    client_id VARCHAR NOT NULL REFERENCES oauth_clients(id) ON DELETE CASCADE,
+    scopes VARCHAR[] NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP NOT NULL DEFAULT now(),
+    updated_at TIMESTAMP NOT NULL DEFAULT now(),
+    PRIMARY KEY (user_id, client_id)
+);
@@ -0,0 +1,154 @@
+package handler
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/SawitProRecruitment/UserService/internal"
+	"github.com/SawitProRecruitment/UserService/model"
+	"github.com/SawitProRecruitment/UserService/repository"
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel/codes"
+)
+
+// emailVerification is a verification issued inside a transaction and mailed
+// once it committed.
+type emailVerification struct {
+	email string
+	token string
+}
+
+// newToken returns a random URL-safe token and the hash stored in its place.
+func newToken() (token, hash string, err error) {
+	buf := make([]byte, 32)
+	if _, err = rand.Read(buf); err != nil {
+		return "", "", err
+	}
+	token = base64.RawURLEncoding.EncodeToString(buf)
+	return token, hashToken(token), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// issueEmailVerification stores a verification for the user's current email.
+func (s *Server) issueEmailVerification(ctx context.Context, repo repository.RepositoryInterface, user repository.User) (*emailVerification, error) {
+	token, hash, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+	err = repo.CreateEmailVerification(ctx, repository.EmailVerification{
+		UserID:    user.UserID,
+		Email:     user.Email.String,
+		TokenHash: hash,
+		ExpiresAt: time.Now().Add(s.Cfg.Email.VerificationTTL),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &emailVerification{email: user.Email.String, token: token}, nil
+}
+
+func (s *Server) sendEmailVerification(ctx context.Context, verification *emailVerification) error {
+	link := s.Cfg.Email.VerificationURL + "?token=" + url.QueryEscape(verification.token)
+	return s.Mailer.Send(ctx, internal.Mail{
+		To:      verification.email,
+		Subject: "Verify your email address",
+		Body:    fmt.Sprintf("Open the link below to verify your email address:\n\n%s\n", link),
+	})
+}
+
+// (POST /user/email/verification)
+func (s *Server) RequestEmailVerification(ctx echo.Context) error {
+	reqCtx, span := tracer.Start(ctx.Request().Context(), "handler.RequestEmailVerification")
+	defer span.End()
+
+	claimUser := ctx.Get("claims").(*model.Claims)
+	if claimUser == nil {
+		return ctx.JSON(http.StatusForbidden, map[string]struct{}{})
+	}
+
+	var verification *emailVerification
+	err := s.Repository.WithTx(reqCtx, func(repo repository.RepositoryInterface) error {
+		user, err := repo.GetUserByID(reqCtx, claimUser.UserID)
+		if err != nil {
+			return err
+		}
+		if !user.Email.Valid {
+			return errNoEmail
+		}
+		if user.EmailVerifiedAt.Valid {
+			return errEmailVerified
+		}
+		verification, err = s.issueEmailVerification(reqCtx, repo, user)
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, errNoEmail) || errors.Is(err, errEmailVerified) {
+			return ctx.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+		}
+		span.SetStatus(codes.Error, err.Error())
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	if err = s.sendEmailVerification(reqCtx, verification); err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return ctx.JSON(http.StatusBadGateway, map[string]string{"error": "failed to send verification email"})
+	}
+	return ctx.JSON(http.StatusAccepted, map[string]struct{}{})
+}
+
+type verifyEmailReq struct {
+	Token string `json:"token"`
+}
+
+// (POST /user/email/verify)
+func (s *Server) VerifyEmail(ctx echo.Context) error {
+	reqCtx, span := tracer.Start(ctx.Request().Context(), "handler.VerifyEmail")
+	defer span.End()
+
+	req := new(verifyEmailReq)
+	if err := ctx.Bind(req); err != nil || req.Token == "" {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+	}
+
+	_, err := s.Repository.ConfirmEmailVerification(reqCtx, hashToken(req.Token))
+	if err != nil {
+		if errors.Is(err, repository.ErrVerificationNotFound) {
+			return ctx.JSON(http.StatusBadRequest, map[string]string{"error": "invalid or expired token"})
+		}
+		span.SetStatus(codes.Error, err.Error())
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return ctx.JSON(http.StatusOK, map[string]interface{}{
+		"data": map[string]bool{"email_verified": true},
+	})
+}
+
+var (
+	errNoEmail       = errors.New("no email to verify")
+	errEmailVerified = errors.New("email already verified")
+)
+
+// mailEmailVerification sends a verification issued by a profile update. The
+// update already succeeded, so a delivery failure is only logged; the user
+// can ask for a new email.
+func (s *Server) mailEmailVerification(ctx context.Context, verification *emailVerification) {
+	if verification == nil {
+		return
+	}
+	if err := s.sendEmailVerification(ctx, verification); err != nil {
+		log.Printf("send email verification: %v", err)
+	}
+}
@@ -1,24 +1,42 @@
 package handler
 
 import (
-	"github.com/SawitProRecruitment/UserService/internal"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"github.com/SawitProRecruitment/UserService/model"
+	"github.com/SawitProRecruitment/UserService/repository"
 	"github.com/labstack/echo/v4"
-	"github.com/lib/pq"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"io"
+	"mime"
 	"net/http"
-	"strings"
 )
 
 // (POST /hello)
 func (s *Server) Register(ctx echo.Context) error {
+	reqCtx, span := tracer.Start(ctx.Request().Context(), "handler.Register")
+	defer span.End()
+
 	user := new(model.RegisterUserReq)
 	if err := ctx.Bind(user); err != nil {
 		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
 	}
 
+	user.Normalize()
 	err := user.Validate()
 	if err != nil {
-		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		var fieldErrs model.FieldErrors
+		if !errors.As(err, &fieldErrs) {
+			span.SetStatus(codes.Error, err.Error())
+			return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		}
+		return ctx.JSON(http.StatusBadRequest, map[string]interface{}{
+			"error":  err.Error(),
+			"fields": fieldErrs,
+		})
 	}
 
 	userInput, err := user.ToDAO()
@@ -26,8 +44,12 @@ func (s *Server) Register(ctx echo.Context) error {
 		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
 	}
 
-	userID, err := s.Repository.RegisterUser(ctx.Request().Context(), userInput)
+	userID, err := s.Repository.RegisterUser(reqCtx, userInput)
 	if err != nil {
+		if errors.Is(err, repository.ErrConflict) {
+			return ctx.JSON(http.StatusConflict, map[string]string{"error": "phone already registered"})
+		}
+		span.SetStatus(codes.Error, err.Error())
 		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
 	}
 	return ctx.JSON(http.StatusOK, map[string]interface{}{"data": map[string]string{
@@ -37,56 +59,150 @@ func (s *Server) Register(ctx echo.Context) error {
 
 // (POST /login)
 func (s *Server) Login(ctx echo.Context) error {
+	ctx2, span := tracer.Start(ctx.Request().Context(), "handler.Login")
+	defer span.End()
+
 	req := new(model.LoginRequest)
 	if err := ctx.Bind(req); err != nil {
 		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
 	}
 
-	ctx2 := ctx.Request().Context()
-	userDAO, err := s.Repository.GetUserByPhone(ctx2, strings.TrimSpace(req.Phone))
-	if err != nil {
+	// The password is checked and, if outdated, rehashed before the
+	// transaction, which should not stay open for deliberately slow hashes.
+	phone, email := req.Lookup()
+	var (
+		userDAO repository.User
+		err     error
+	)
+	if email != "" {
+		userDAO, err = s.Repository.GetUserByEmail(ctx2, email)
+	} else {
+		userDAO, err = s.Repository.GetUserByPhone(ctx2, phone)
+	}
+	unknown := errors.Is(err, repository.ErrUserNotFound)
+	if err != nil && !unknown {
+		span.SetStatus(codes.Error, err.Error())
 		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
 	}
 
 	user := model.FromRepoUser(userDAO)
-	err = user.CheckLogin(req.Password)
+	_, checkSpan := tracer.Start(ctx2, "handler.Login.CheckLogin")
+	if unknown {
+		err = model.CheckUnknownLogin(req.Password)
+	} else {
+		err = user.CheckLogin(req.Password)
+	}
+	checkSpan.End()
+	// Unknown users get the same answer as a wrong password.
+	if errors.Is(err, model.ErrPasswordMismatch) {
+		return ctx.JSON(http.StatusUnauthorized, map[string]string{"error": errInvalidCredentials})
+	}
 	if err != nil {
-		return ctx.JSON(http.StatusUnauthorized, map[string]string{"error": err.Error()})
+		span.SetStatus(codes.Error, err.Error())
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
 	}
 
-	tokenString, err := internal.GenerateJWTToken(user, s.Cfg.App.Env)
+	// The password is only known here, so hashes made with outdated
+	// parameters are upgraded on login.
+	rehashed := ""
+	if user.PasswordOutdated() {
+		if rehashed, err = model.HashPassword(req.Password); err != nil {
+			span.SetStatus(codes.Error, err.Error())
+			return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		}
+	}
+
+	var (
+		challenge *mfaChallenge
+		session   repository.Session
+	)
+	err = s.Repository.WithTx(ctx2, func(repo repository.RepositoryInterface) error {
+		challenge, session = nil, repository.Session{}
+		// The counter and password are keyed by phone, which has to still
+		// belong to the user whose password was verified.
+		current, err := repo.GetUserByPhone(ctx2, user.Phone)
+		if errors.Is(err, repository.ErrUserNotFound) ||
+			(err == nil && (current.UserID != user.UserID || current.Password != userDAO.Password)) {
+			return model.ErrPasswordMismatch
+		}
+		if err != nil {
+			return err
+		}
+
+		// Users with TOTP only count as logged in after POST /login/mfa.
+		challenge, err = s.issueMFAChallenge(ctx2, repo, user.UserID)
+		if err != nil {
+			return err
+		}
+		if challenge == nil {
+			if err = repo.IncrSuccessLogin(ctx2, user.Phone); err != nil {
+				return err
+			}
+			if session, err = startSession(ctx, ctx2, repo, user.UserID, req.DeviceName); err != nil {
+				return err
+			}
+		}
+
+		if rehashed == "" {
+			return nil
+		}
+		return repo.UpdatePassword(ctx2, user.Phone, rehashed)
+	})
 	if err != nil {
+		if errors.Is(err, model.ErrPasswordMismatch) {
+			return ctx.JSON(http.StatusUnauthorized, map[string]string{"error": errInvalidCredentials})
+		}
+		span.SetStatus(codes.Error, err.Error())
 		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
 	}
 
-	if err = s.Repository.IncrSuccessLogin(ctx2, user.Phone); err != nil {
-		return ctx.JSON(http.StatusInternalServerError, map[string]interface{}{"error": err.Error()})
+	return s.respondLogin(ctx, span, user, challenge, session)
+}
+
+// respondLogin answers a login whose first factor was verified: with the
+// mfa_token of challenge for users with TOTP, otherwise with a token for
+// session.
+func (s *Server) respondLogin(ctx echo.Context, span trace.Span, user model.User, challenge *mfaChallenge, session repository.Session) error {
+	if challenge != nil {
+		return ctx.JSON(http.StatusOK, map[string]interface{}{
+			"mfa_required": true,
+			"mfa_token":    challenge.token,
+			"expires_in":   int(s.Cfg.MFA.ChallengeTTL.Seconds()),
+		})
 	}
 
-	return ctx.JSON(http.StatusOK, map[string]interface{}{
-		"token": tokenString,
-	})
+	return s.respondToken(ctx, span, user, session)
 }
 
+const errInvalidCredentials = "invalid identifier or password"
+
 // (GET /profile)
 func (s *Server) GetProfile(ctx echo.Context) error {
+	reqCtx, span := tracer.Start(ctx.Request().Context(), "handler.GetProfile")
+	defer span.End()
+
 	claimUser := ctx.Get("claims").(*model.Claims)
 	if claimUser == nil {
 		return ctx.JSON(http.StatusForbidden, map[string]struct{}{})
 	}
 
-	userDAO, err := s.Repository.GetUserByPhone(ctx.Request().Context(), claimUser.Phone)
+	userDAO, err := s.Repository.GetUserByID(reqCtx, claimUser.UserID)
 	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
 		return ctx.JSON(http.StatusInternalServerError, map[string]interface{}{"error": err.Error()})
 	}
 	user := model.FromRepoUser(userDAO)
 
+	ctx.Response().Header().Set(headerETag, formatETag(user.Version))
 	return ctx.JSON(http.StatusOK, map[string]interface{}{
 		"data": user.ToProfileResp(),
 	})
 }
 
 func (s *Server) UpdateUser(ctx echo.Context) error {
+	reqCtx, span := tracer.Start(ctx.Request().Context(), "handler.UpdateUser")
+	defer span.End()
+
 	claimUser := ctx.Get("claims").(*model.Claims)
 	if claimUser == nil {
 		return ctx.JSON(http.StatusForbidden, map[string]struct{}{})
@@ -97,19 +213,120 @@ func (s *Server) UpdateUser(ctx echo.Context) error {
 		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request body"})
 	}
 
+	updateUser.Normalize()
 	err := updateUser.Validate()
 	if err != nil {
 		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request body"})
 	}
 
-	err = s.Repository.UpdateUser(ctx.Request().Context(), updateUser.ToDAO(), claimUser.Phone)
+	input := updateUser.ToDAO()
+	return s.updateProfile(ctx, reqCtx, span, claimUser.UserID, &input)
+}
+
+// (PATCH /user)
+func (s *Server) PatchUser(ctx echo.Context) error {
+	reqCtx, span := tracer.Start(ctx.Request().Context(), "handler.PatchUser")
+	defer span.End()
+
+	claimUser := ctx.Get("claims").(*model.Claims)
+	if claimUser == nil {
+		return ctx.JSON(http.StatusForbidden, map[string]struct{}{})
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(ctx.Request().Header.Get(echo.HeaderContentType))
+	if mediaType != model.MIMEMergePatchJSON {
+		return ctx.JSON(http.StatusUnsupportedMediaType, map[string]string{"error": "content type must be " + model.MIMEMergePatchJSON})
+	}
+
+	body, err := io.ReadAll(ctx.Request().Body)
+	if err != nil {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+	}
+	// A merge patch that is not an object would replace the whole user.
+	body = bytes.TrimSpace(body)
+	if len(body) == 0 || body[0] != '{' {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": "patch must be a JSON object"})
+	}
+
+	patch := new(model.PatchUserReq)
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.DisallowUnknownFields()
+	if err = decoder.Decode(patch); err != nil {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+	}
+
+	patch.Normalize()
+	if err = patch.Validate(); err != nil {
+		return ctx.JSON(http.StatusBadRequest, map[string]interface{}{
+			"error":  "invalid request body",
+			"fields": err,
+		})
+	}
+
+	if patch.IsEmpty() {
+		return s.updateProfile(ctx, reqCtx, span, claimUser.UserID, nil)
+	}
+	input := patch.ToDAO()
+	return s.updateProfile(ctx, reqCtx, span, claimUser.UserID, &input)
+}
+
+// updateProfile applies input to the user, honouring If-Match, and responds
+// with the profile as persisted. A nil input only checks the precondition
+// and returns the current profile.
+func (s *Server) updateProfile(ctx echo.Context, reqCtx context.Context, span trace.Span, userID string, input *repository.UpdateUser) error {
+	version, ok := parseIfMatch(ctx.Request().Header.Get(headerIfMatch))
+	if !ok {
+		return ctx.JSON(http.StatusPreconditionFailed, map[string]string{"error": "If-Match does not match the current profile"})
+	}
+
+	var (
+		updated      repository.User
+		verification *emailVerification
+	)
+	err := s.Repository.WithTx(reqCtx, func(repo repository.RepositoryInterface) error {
+		verification = nil
+		current, err := repo.GetUserByID(reqCtx, userID)
+		if err != nil {
+			return err
+		}
+		if input == nil {
+			if version > 0 && current.Version != version {
+				return repository.ErrVersionConflict
+			}
+			updated = current
+			return nil
+		}
+
+		input.Version = version
+		if err = repo.UpdateUser(reqCtx, *input, current.Phone); err != nil {
+			return err
+		}
+		if updated, err = repo.GetUserByID(reqCtx, userID); err != nil {
+			return err
+		}
+
+		// A new email address needs to be verified again.
+		if input.Email != nil && updated.Email.Valid && !updated.EmailVerifiedAt.Valid {
+			verification, err = s.issueEmailVerification(reqCtx, repo, updated)
+		}
+		return err
+	})
 	if err != nil {
-		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+		if errors.Is(err, repository.ErrVersionConflict) {
+			return ctx.JSON(http.StatusPreconditionFailed, map[string]string{"error": "If-Match does not match the current profile"})
+		}
+		span.SetStatus(codes.Error, err.Error())
+		if errors.Is(err, repository.ErrConflict) {
 			return ctx.JSON(http.StatusConflict, map[string]string{"error": "invalid request"})
 		}
 		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
 	}
+
+	s.mailEmailVerification(reqCtx, verification)
+
+	user := model.FromRepoUser(updated)
+	ctx.Response().Header().Set(headerETag, formatETag(user.Version))
 	return ctx.JSON(http.StatusOK, map[string]interface{}{
-		"data": updateUser,
+		"data": user.ToProfileResp(),
 	})
 }
@@ -0,0 +1,82 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/SawitProRecruitment/UserService/model"
+	"github.com/SawitProRecruitment/UserService/repository"
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel/codes"
+)
+
+// (GET /auth/verify)
+//
+// VerifyForwardAuth answers the subrequests of nginx auth_request and
+// Traefik ForwardAuth: 200 with the user in X-User-* headers for the proxy
+// to pass on, otherwise 401. With a login URL configured, the 401 carries
+// it in Location, for nginx to redirect with; with ?redirect=true, as
+// Traefik passes responses through to the browser, it is a 302 instead.
+func (s *Server) VerifyForwardAuth(ctx echo.Context) error {
+	reqCtx, span := tracer.Start(ctx.Request().Context(), "handler.VerifyForwardAuth")
+	defer span.End()
+
+	ctx.Response().Header().Set("Cache-Control", "no-store")
+
+	claims, _ := ctx.Get("claims").(*model.Claims)
+	if claims == nil {
+		return s.denyForwardAuth(ctx)
+	}
+	user, err := s.Repository.GetUserByID(reqCtx, claims.UserID)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return s.denyForwardAuth(ctx)
+		}
+		span.SetStatus(codes.Error, err.Error())
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	header := ctx.Response().Header()
+	header.Set("X-User-Id", user.UserID)
+	header.Set("X-User-Phone", user.Phone)
+	header.Set("X-User-Roles", strings.Join(model.UserRoles(user.UserID, s.Cfg.Admin.UserIDs), ","))
+	return ctx.NoContent(http.StatusOK)
+}
+
+func (s *Server) denyForwardAuth(ctx echo.Context) error {
+	ctx.Response().Header().Set("WWW-Authenticate", "Bearer")
+	if s.Cfg.ForwardAuth.LoginURL == "" {
+		return ctx.NoContent(http.StatusUnauthorized)
+	}
+	login, err := url.Parse(s.Cfg.ForwardAuth.LoginURL)
+	if err != nil {
+		return ctx.NoContent(http.StatusUnauthorized)
+	}
+	if original := forwardedURL(ctx.Request()); original != "" {
+		query := login.Query()
+		query.Set("rd", original)
+		login.RawQuery = query.Encode()
+	}
+
+	if redirect := ctx.QueryParam("redirect"); redirect == "true" || redirect == "1" {
+		return ctx.Redirect(http.StatusFound, login.String())
+	}
+	ctx.Response().Header().Set("Location", login.String())
+	return ctx.NoContent(http.StatusUnauthorized)
+}
+
+// forwardedURL returns the URL the proxy checks access to, from the
+// X-Original-URL header nginx is usually set up to send or the
+// X-Forwarded-* headers of Traefik.
+func forwardedURL(req *http.Request) string {
+	if original := req.Header.Get("X-Original-URL"); original != "" {
+		return original
+	}
+	proto, host := req.Header.Get("X-Forwarded-Proto"), req.Header.Get("X-Forwarded-Host")
+	if proto == "" || host == "" {
+		return ""
+	}
+	return proto + "://" + host + req.Header.Get("X-Forwarded-Uri")
+}
@@ -7,4 +7,33 @@ type HandlerInterface interface {
 	Login(ctx echo.Context) error
 	GetProfile(ctx echo.Context) error
 	UpdateUser(ctx echo.Context) error
+	PatchUser(ctx echo.Context) error
+	RequestEmailVerification(ctx echo.Context) error
+	VerifyEmail(ctx echo.Context) error
+	EnrollTOTP(ctx echo.Context) error
+	ConfirmTOTP(ctx echo.Context) error
+	LoginMFA(ctx echo.Context) error
+	ListSessions(ctx echo.Context) error
+	RevokeSession(ctx echo.Context) error
+	RevokeOtherSessions(ctx echo.Context) error
+	BeginPasskeyRegistration(ctx echo.Context) error
+	FinishPasskeyRegistration(ctx echo.Context) error
+	BeginPasskeyLogin(ctx echo.Context) error
+	FinishPasskeyLogin(ctx echo.Context) error
+	RequestLoginOTP(ctx echo.Context) error
+	VerifyLoginOTP(ctx echo.Context) error
+	RegisterOAuthClient(ctx echo.Context) error
+	Authorize(ctx echo.Context) error
+	ApproveAuthorization(ctx echo.Context) error
+	IssueOAuthToken(ctx echo.Context) error
+	RevokeOAuthToken(ctx echo.Context) error
+	UserInfo(ctx echo.Context) error
+	OpenIDConfiguration(ctx echo.Context) error
+	JWKS(ctx echo.Context) error
+	CreateMachineClient(ctx echo.Context) error
+	ListMachineClients(ctx echo.Context) error
+	DeleteMachineClient(ctx echo.Context) error
+	GetUser(ctx echo.Context) error
+	IntrospectToken(ctx echo.Context) error
+	VerifyForwardAuth(ctx echo.Context) error
 }
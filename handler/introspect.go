@@ -0,0 +1,116 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+
+	"github.com/SawitProRecruitment/UserService/model"
+	"github.com/SawitProRecruitment/UserService/repository"
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel/codes"
+)
+
+// (POST /oauth/introspect)
+//
+// IntrospectToken answers RFC 7662 token introspection for machine clients
+// granted model.ScopeTokensIntrospect, so that other services need neither
+// our key nor their own copy of the checks of transport.AuthMiddleware. A
+// token is active only while the middleware would accept it: for tokens of
+// users and OAuth clients the session has to be live, for tokens of machine
+// clients the client has to still exist.
+func (s *Server) IntrospectToken(ctx echo.Context) error {
+	reqCtx, span := tracer.Start(ctx.Request().Context(), "handler.IntrospectToken")
+	defer span.End()
+
+	ctx.Response().Header().Set("Cache-Control", "no-store")
+	ctx.Response().Header().Set("Pragma", "no-cache")
+
+	client, err := s.authenticateMachineClient(ctx, reqCtx)
+	if err != nil {
+		if errors.Is(err, errInvalidClient) {
+			return respondOAuthError(ctx, http.StatusUnauthorized, errInvalidClient)
+		}
+		span.SetStatus(codes.Error, err.Error())
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	if !slices.Contains(client.Scopes, model.ScopeTokensIntrospect) {
+		return respondOAuthError(ctx, http.StatusForbidden, &oauthError{"insufficient_scope",
+			"the " + model.ScopeTokensIntrospect + " scope is required"})
+	}
+	tokenString := ctx.FormValue("token")
+	if tokenString == "" {
+		return respondOAuthError(ctx, http.StatusBadRequest, &oauthError{"invalid_request", "token is required"})
+	}
+
+	// Nothing is told about tokens that are not active, not even why.
+	inactive := map[string]bool{"active": false}
+	claims, err := s.parseToken(tokenString)
+	if err != nil {
+		return ctx.JSON(http.StatusOK, inactive)
+	}
+	resp := map[string]interface{}{
+		"active":     true,
+		"token_type": "Bearer",
+		"exp":        claims.ExpiresAt,
+	}
+	if claims.IssuedAt != 0 {
+		resp["iat"] = claims.IssuedAt
+	}
+	if claims.Issuer != "" {
+		resp["iss"] = claims.Issuer
+	}
+
+	switch {
+	case claims.IDToken():
+		// ID tokens carry the session as well, but are no access tokens.
+		return ctx.JSON(http.StatusOK, inactive)
+	case claims.SessionID != "":
+		session, err := s.Repository.GetSession(reqCtx, claims.SessionID)
+		if errors.Is(err, repository.ErrSessionNotFound) {
+			return ctx.JSON(http.StatusOK, inactive)
+		}
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+			return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		}
+		if claims.ClientID != "" && claims.Subject != session.UserID {
+			return ctx.JSON(http.StatusOK, inactive)
+		}
+		resp["sub"] = session.UserID
+		resp["sid"] = session.SessionID
+		resp["session"] = map[string]interface{}{
+			"device_name":  session.DeviceName,
+			"created_at":   session.CreatedAt,
+			"last_seen_at": session.LastSeenAt,
+			"expires_at":   session.ExpiresAt,
+		}
+		if claims.ClientID == "" {
+			user, err := s.Repository.GetUserByID(reqCtx, session.UserID)
+			if err != nil {
+				span.SetStatus(codes.Error, err.Error())
+				return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			}
+			resp["username"] = user.Phone
+		} else {
+			resp["client_id"] = claims.ClientID
+			resp["scope"] = claims.Scope
+		}
+	case claims.ClientID != "" && claims.Subject == claims.ClientID:
+		_, err := s.Repository.GetMachineClient(reqCtx, claims.ClientID)
+		if errors.Is(err, repository.ErrOAuthNotFound) {
+			return ctx.JSON(http.StatusOK, inactive)
+		}
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+			return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		}
+		resp["sub"] = claims.ClientID
+		resp["client_id"] = claims.ClientID
+		resp["scope"] = claims.Scope
+	default:
+		// Tokens from before sessions were introduced.
+		return ctx.JSON(http.StatusOK, inactive)
+	}
+	return ctx.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,271 @@
+package handler
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/SawitProRecruitment/UserService/internal"
+	"github.com/SawitProRecruitment/UserService/model"
+	"github.com/SawitProRecruitment/UserService/repository"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// machineScopes are the scopes machine clients may be granted.
+var machineScopes = []string{model.ScopeUsersRead, model.ScopeTokensIntrospect}
+
+var errNotAdmin = errors.New("not an admin")
+
+// adminID returns the ID of the user behind claims, failing with
+// errNotAdmin unless the user is one of the configured admins.
+func (s *Server) adminID(ctx context.Context, claims *model.Claims) (string, error) {
+	user, err := s.Repository.GetUserByID(ctx, claims.UserID)
+	if err != nil {
+		return "", err
+	}
+	if !slices.Contains(s.Cfg.Admin.UserIDs, user.UserID) {
+		return "", errNotAdmin
+	}
+	return user.UserID, nil
+}
+
+type createMachineClientReq struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+}
+
+// (POST /admin/machine-clients)
+func (s *Server) CreateMachineClient(ctx echo.Context) error {
+	reqCtx, span := tracer.Start(ctx.Request().Context(), "handler.CreateMachineClient")
+	defer span.End()
+
+	claimUser := ctx.Get("claims").(*model.Claims)
+	if claimUser == nil {
+		return ctx.JSON(http.StatusForbidden, map[string]struct{}{})
+	}
+	adminID, err := s.adminID(reqCtx, claimUser)
+	if err != nil {
+		if errors.Is(err, errNotAdmin) {
+			return ctx.JSON(http.StatusForbidden, map[string]struct{}{})
+		}
+		span.SetStatus(codes.Error, err.Error())
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	req := new(createMachineClientReq)
+	if err = ctx.Bind(req); err != nil {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" || utf8.RuneCountInString(name) > maxClientNameLen {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": "name of up to 100 characters is required"})
+	}
+	var scopes []string
+	for _, scope := range req.Scopes {
+		if !slices.Contains(machineScopes, scope) {
+			return ctx.JSON(http.StatusBadRequest, map[string]string{
+				"error": "scopes must be among " + strings.Join(machineScopes, ", "),
+			})
+		}
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	if len(scopes) == 0 {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": "scopes are required"})
+	}
+
+	// Like the secrets of OAuth clients, the secret is only shown here.
+	secret, hash, err := newToken()
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	client := repository.MachineClient{
+		ClientID:   uuid.NewString(),
+		SecretHash: hash,
+		Name:       name,
+		Scopes:     scopes,
+		CreatedBy:  adminID,
+	}
+	if err = s.Repository.CreateMachineClient(reqCtx, client); err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	data := machineClientResp(client)
+	data["client_secret"] = secret
+	return ctx.JSON(http.StatusCreated, map[string]interface{}{"data": data})
+}
+
+// (GET /admin/machine-clients)
+func (s *Server) ListMachineClients(ctx echo.Context) error {
+	reqCtx, span := tracer.Start(ctx.Request().Context(), "handler.ListMachineClients")
+	defer span.End()
+
+	claimUser := ctx.Get("claims").(*model.Claims)
+	if claimUser == nil {
+		return ctx.JSON(http.StatusForbidden, map[string]struct{}{})
+	}
+	_, err := s.adminID(reqCtx, claimUser)
+	if err != nil {
+		if errors.Is(err, errNotAdmin) {
+			return ctx.JSON(http.StatusForbidden, map[string]struct{}{})
+		}
+		span.SetStatus(codes.Error, err.Error())
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	clients, err := s.Repository.ListMachineClients(reqCtx)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	data := make([]map[string]interface{}, 0, len(clients))
+	for _, client := range clients {
+		data = append(data, machineClientResp(client))
+	}
+	return ctx.JSON(http.StatusOK, map[string]interface{}{"data": data})
+}
+
+func machineClientResp(client repository.MachineClient) map[string]interface{} {
+	return map[string]interface{}{
+		"client_id":  client.ClientID,
+		"name":       client.Name,
+		"scopes":     client.Scopes,
+		"created_by": client.CreatedBy,
+		"created_at": client.CreatedAt,
+	}
+}
+
+// (DELETE /admin/machine-clients/:id)
+func (s *Server) DeleteMachineClient(ctx echo.Context) error {
+	reqCtx, span := tracer.Start(ctx.Request().Context(), "handler.DeleteMachineClient")
+	defer span.End()
+
+	claimUser := ctx.Get("claims").(*model.Claims)
+	if claimUser == nil {
+		return ctx.JSON(http.StatusForbidden, map[string]struct{}{})
+	}
+	_, err := s.adminID(reqCtx, claimUser)
+	if err != nil {
+		if errors.Is(err, errNotAdmin) {
+			return ctx.JSON(http.StatusForbidden, map[string]struct{}{})
+		}
+		span.SetStatus(codes.Error, err.Error())
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	// Tokens of the client stop working with it, as the middleware looks
+	// the client up on every request.
+	err = s.Repository.DeleteMachineClient(reqCtx, ctx.Param("id"))
+	if err != nil {
+		if errors.Is(err, repository.ErrOAuthNotFound) {
+			return ctx.JSON(http.StatusNotFound, map[string]string{"error": "machine client not found"})
+		}
+		span.SetStatus(codes.Error, err.Error())
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return ctx.NoContent(http.StatusNoContent)
+}
+
+// authenticateMachineClient is authenticateClient for machine clients.
+func (s *Server) authenticateMachineClient(ctx echo.Context, reqCtx context.Context) (repository.MachineClient, error) {
+	clientID, secret := clientCredentials(ctx)
+	client, err := s.Repository.GetMachineClient(reqCtx, clientID)
+	if errors.Is(err, repository.ErrOAuthNotFound) {
+		return client, errInvalidClient
+	}
+	if err != nil {
+		return client, err
+	}
+	if subtle.ConstantTimeCompare([]byte(hashToken(secret)), []byte(client.SecretHash)) != 1 {
+		return client, errInvalidClient
+	}
+	return client, nil
+}
+
+// issueMachineToken answers the client credentials grant of RFC 6749
+// section 4.4. The token has no user and no session; its Subject is the
+// client itself.
+func (s *Server) issueMachineToken(ctx echo.Context, reqCtx context.Context, span trace.Span) error {
+	client, err := s.authenticateMachineClient(ctx, reqCtx)
+	if err != nil {
+		if errors.Is(err, errInvalidClient) {
+			return respondOAuthError(ctx, http.StatusUnauthorized, errInvalidClient)
+		}
+		span.SetStatus(codes.Error, err.Error())
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	// Without a scope parameter the client gets all of its scopes.
+	scopes := client.Scopes
+	if requested := strings.Fields(ctx.FormValue("scope")); len(requested) > 0 {
+		scopes = nil
+		for _, scope := range requested {
+			if !slices.Contains(client.Scopes, scope) {
+				return respondOAuthError(ctx, http.StatusBadRequest, &oauthError{"invalid_scope", "scope " + scope + " is not granted to the client"})
+			}
+			if !slices.Contains(scopes, scope) {
+				scopes = append(scopes, scope)
+			}
+		}
+	}
+	scope := strings.Join(scopes, " ")
+
+	now := time.Now()
+	expiresAt := now.Add(s.Cfg.OIDC.MachineTokenTTL)
+	accessToken, err := internal.SignToken(&model.Claims{
+		StandardClaims: jwt.StandardClaims{
+			Issuer:    s.issuer(),
+			Subject:   client.ClientID,
+			IssuedAt:  now.Unix(),
+			ExpiresAt: expiresAt.Unix(),
+		},
+		ClientID: client.ClientID,
+		Scope:    scope,
+	}, s.Cfg.App.Env)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	return ctx.JSON(http.StatusOK, map[string]interface{}{
+		"access_token": accessToken,
+		"token_type":   "Bearer",
+		"expires_in":   int(expiresAt.Sub(now).Seconds()),
+		"scope":        scope,
+	})
+}
+
+// (GET /users/:id)
+func (s *Server) GetUser(ctx echo.Context) error {
+	reqCtx, span := tracer.Start(ctx.Request().Context(), "handler.GetUser")
+	defer span.End()
+
+	if ctx.Get("claims").(*model.Claims) == nil {
+		return ctx.JSON(http.StatusForbidden, map[string]struct{}{})
+	}
+
+	userDAO, err := s.Repository.GetUserByID(reqCtx, ctx.Param("id"))
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return ctx.JSON(http.StatusNotFound, map[string]string{"error": "user not found"})
+		}
+		span.SetStatus(codes.Error, err.Error())
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	user := model.FromRepoUser(userDAO)
+	return ctx.JSON(http.StatusOK, map[string]interface{}{
+		"data": user.ToProfileResp(),
+	})
+}
@@ -0,0 +1,261 @@
+package handler
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/SawitProRecruitment/UserService/internal/totp"
+	"github.com/SawitProRecruitment/UserService/model"
+	"github.com/SawitProRecruitment/UserService/repository"
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel/codes"
+)
+
+var (
+	errInvalidMFACode = errors.New("invalid code")
+	errNoPendingTOTP  = errors.New("no pending TOTP enrollment")
+)
+
+var recoveryCodeEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// newRecoveryCodes returns n codes formatted like "abcde-fghij" and their
+// hashes.
+func newRecoveryCodes(n int) (codes, hashes []string, err error) {
+	for i := 0; i < n; i++ {
+		buf := make([]byte, 7)
+		if _, err = rand.Read(buf); err != nil {
+			return nil, nil, err
+		}
+		code := strings.ToLower(recoveryCodeEncoding.EncodeToString(buf)[:10])
+		codes = append(codes, code[:5]+"-"+code[5:])
+		hashes = append(hashes, hashRecoveryCode(code))
+	}
+	return codes, hashes, nil
+}
+
+// hashRecoveryCode hashes a recovery code as typed, ignoring case, spaces and
+// dashes.
+func hashRecoveryCode(code string) string {
+	code = strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, strings.ToLower(code))
+	return hashToken(code)
+}
+
+// (POST /user/mfa/totp)
+func (s *Server) EnrollTOTP(ctx echo.Context) error {
+	reqCtx, span := tracer.Start(ctx.Request().Context(), "handler.EnrollTOTP")
+	defer span.End()
+
+	claimUser := ctx.Get("claims").(*model.Claims)
+	if claimUser == nil {
+		return ctx.JSON(http.StatusForbidden, map[string]struct{}{})
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	var user repository.User
+	err = s.Repository.WithTx(reqCtx, func(repo repository.RepositoryInterface) error {
+		var err error
+		user, err = repo.GetUserByID(reqCtx, claimUser.UserID)
+		if err != nil {
+			return err
+		}
+		return repo.SaveTOTP(reqCtx, user.UserID, secret)
+	})
+	if err != nil {
+		if errors.Is(err, repository.ErrConflict) {
+			return ctx.JSON(http.StatusConflict, map[string]string{"error": "TOTP is already enabled"})
+		}
+		span.SetStatus(codes.Error, err.Error())
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	return ctx.JSON(http.StatusCreated, map[string]interface{}{"data": map[string]string{
+		"secret":           secret,
+		"provisioning_uri": totp.ProvisioningURI(s.Cfg.MFA.Issuer, user.Phone, secret),
+	}})
+}
+
+type confirmTOTPReq struct {
+	Code string `json:"code"`
+}
+
+// (POST /user/mfa/totp/confirm)
+func (s *Server) ConfirmTOTP(ctx echo.Context) error {
+	reqCtx, span := tracer.Start(ctx.Request().Context(), "handler.ConfirmTOTP")
+	defer span.End()
+
+	claimUser := ctx.Get("claims").(*model.Claims)
+	if claimUser == nil {
+		return ctx.JSON(http.StatusForbidden, map[string]struct{}{})
+	}
+
+	req := new(confirmTOTPReq)
+	if err := ctx.Bind(req); err != nil || req.Code == "" {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+	}
+
+	recoveryCodes, hashes, err := newRecoveryCodes(s.Cfg.MFA.RecoveryCodes)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	err = s.Repository.WithTx(reqCtx, func(repo repository.RepositoryInterface) error {
+		user, err := repo.GetUserByID(reqCtx, claimUser.UserID)
+		if err != nil {
+			return err
+		}
+		secret, err := repo.GetTOTP(reqCtx, user.UserID)
+		if errors.Is(err, repository.ErrMFANotFound) || secret.ConfirmedAt.Valid {
+			return errNoPendingTOTP
+		}
+		if err != nil {
+			return err
+		}
+
+		step, ok := totp.Validate(secret.Secret, req.Code, time.Now(), s.Cfg.MFA.Skew)
+		if !ok {
+			return errInvalidMFACode
+		}
+		return repo.ConfirmTOTP(reqCtx, user.UserID, step, hashes)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, errNoPendingTOTP):
+			return ctx.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+		case errors.Is(err, errInvalidMFACode):
+			return ctx.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+		span.SetStatus(codes.Error, err.Error())
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	return ctx.JSON(http.StatusOK, map[string]interface{}{"data": map[string]interface{}{
+		"recovery_codes": recoveryCodes,
+	}})
+}
+
+// mfaChallenge is issued inside the login transaction for users with TOTP;
+// token is handed to the client instead of an access token.
+type mfaChallenge struct {
+	token string
+}
+
+// issueMFAChallenge returns nil when the user has not enabled TOTP.
+func (s *Server) issueMFAChallenge(ctx context.Context, repo repository.RepositoryInterface, userID string) (*mfaChallenge, error) {
+	secret, err := repo.GetTOTP(ctx, userID)
+	if errors.Is(err, repository.ErrMFANotFound) || (err == nil && !secret.ConfirmedAt.Valid) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	token, hash, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+	err = repo.CreateMFAChallenge(ctx, repository.MFAChallenge{
+		UserID:    userID,
+		TokenHash: hash,
+		ExpiresAt: time.Now().Add(s.Cfg.MFA.ChallengeTTL),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &mfaChallenge{token: token}, nil
+}
+
+type loginMFAReq struct {
+	MFAToken     string `json:"mfa_token"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+	DeviceName   string `json:"device_name"`
+}
+
+// (POST /login/mfa)
+func (s *Server) LoginMFA(ctx echo.Context) error {
+	reqCtx, span := tracer.Start(ctx.Request().Context(), "handler.LoginMFA")
+	defer span.End()
+
+	req := new(loginMFAReq)
+	if err := ctx.Bind(req); err != nil || req.MFAToken == "" || (req.Code == "") == (req.RecoveryCode == "") {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": "mfa_token and either code or recovery_code are required"})
+	}
+
+	// The attempt is counted outside the transaction below so that wrong
+	// codes, which roll it back, still use up attempts.
+	tokenHash := hashToken(req.MFAToken)
+	userID, err := s.Repository.RecordMFAAttempt(reqCtx, tokenHash, s.Cfg.MFA.MaxAttempts)
+	if err != nil {
+		if errors.Is(err, repository.ErrMFANotFound) {
+			return ctx.JSON(http.StatusUnauthorized, map[string]string{"error": "invalid or expired mfa_token"})
+		}
+		span.SetStatus(codes.Error, err.Error())
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	var (
+		user    model.User
+		session repository.Session
+	)
+	err = s.Repository.WithTx(reqCtx, func(repo repository.RepositoryInterface) error {
+		userDAO, err := repo.GetUserByID(reqCtx, userID)
+		if err != nil {
+			return err
+		}
+		user = model.FromRepoUser(userDAO)
+
+		if req.Code != "" {
+			var secret repository.TOTP
+			if secret, err = repo.GetTOTP(reqCtx, userID); err != nil {
+				return err
+			}
+			step, ok := totp.Validate(secret.Secret, req.Code, time.Now(), s.Cfg.MFA.Skew)
+			if !ok {
+				return errInvalidMFACode
+			}
+			err = repo.UseTOTPStep(reqCtx, userID, step)
+		} else {
+			err = repo.UseRecoveryCode(reqCtx, userID, hashRecoveryCode(req.RecoveryCode))
+		}
+		if errors.Is(err, repository.ErrMFANotFound) {
+			return errInvalidMFACode
+		}
+		if err != nil {
+			return err
+		}
+
+		if err = repo.DeleteMFAChallenge(reqCtx, tokenHash); err != nil {
+			return err
+		}
+		if err = repo.IncrSuccessLogin(reqCtx, user.Phone); err != nil {
+			return err
+		}
+		session, err = startSession(ctx, reqCtx, repo, user.UserID, req.DeviceName)
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, errInvalidMFACode) {
+			return ctx.JSON(http.StatusUnauthorized, map[string]string{"error": err.Error()})
+		}
+		span.SetStatus(codes.Error, err.Error())
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	return s.respondToken(ctx, span, user, session)
+}
@@ -0,0 +1,589 @@
+package handler
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/SawitProRecruitment/UserService/internal"
+	"github.com/SawitProRecruitment/UserService/model"
+	"github.com/SawitProRecruitment/UserService/repository"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	scopeOpenID  = "openid"
+	scopeProfile = "profile"
+	scopeEmail   = "email"
+	scopePhone   = "phone"
+)
+
+// supportedScopes are the scopes clients may ask for; openid is required.
+var supportedScopes = []string{scopeOpenID, scopeProfile, scopeEmail, scopePhone}
+
+const (
+	authMethodNone   = "none"
+	authMethodBasic  = "client_secret_basic"
+	authMethodPost   = "client_secret_post"
+	maxClientNameLen = 100
+)
+
+var tokenEndpointAuthMethods = []string{authMethodBasic, authMethodPost, authMethodNone}
+
+// oauthError is an error answered as defined in RFC 6749 section 5.2.
+type oauthError struct {
+	code        string
+	description string
+}
+
+func (e *oauthError) Error() string {
+	return e.code + ": " + e.description
+}
+
+var (
+	errInvalidClient = &oauthError{"invalid_client", "client authentication failed"}
+	errInvalidGrant  = &oauthError{"invalid_grant", "invalid, expired or already used authorization code"}
+)
+
+func respondOAuthError(ctx echo.Context, status int, err *oauthError) error {
+	return ctx.JSON(status, map[string]string{"error": err.code, "error_description": err.description})
+}
+
+// parseScope splits a space separated scope, refusing unsupported scopes and
+// requests without openid.
+func parseScope(scope string) ([]string, bool) {
+	var scopes []string
+	for _, s := range strings.Fields(scope) {
+		if !slices.Contains(supportedScopes, s) {
+			return nil, false
+		}
+		if !slices.Contains(scopes, s) {
+			scopes = append(scopes, s)
+		}
+	}
+	return scopes, slices.Contains(scopes, scopeOpenID)
+}
+
+// validRedirectURI accepts https URIs, http ones on the loopback interface
+// for development and, for public clients, private-use schemes such as
+// "com.example.app:/callback" of native apps.
+func validRedirectURI(raw string, public bool) bool {
+	u, err := url.Parse(raw)
+	if err != nil || !u.IsAbs() || u.Fragment != "" {
+		return false
+	}
+	switch u.Scheme {
+	case "https":
+		return u.Host != ""
+	case "http":
+		return u.Hostname() == "localhost" || net.ParseIP(u.Hostname()).IsLoopback()
+	default:
+		return public && strings.Contains(u.Scheme, ".")
+	}
+}
+
+// validPKCEValue reports whether s is a code verifier, or an S256 code
+// challenge when exactly 43 characters long, as defined in RFC 7636.
+func validPKCEValue(s string) bool {
+	if len(s) < 43 || len(s) > 128 {
+		return false
+	}
+	for _, r := range s {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-._~", r)) {
+			return false
+		}
+	}
+	return true
+}
+
+func pkceChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// redirectWith adds params to the query of a registered redirect URI.
+func redirectWith(redirectURI string, params url.Values) string {
+	u, _ := url.Parse(redirectURI)
+	query := u.Query()
+	for key, values := range params {
+		if values[0] != "" {
+			query[key] = values
+		}
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+func (s *Server) issuer() string {
+	return strings.TrimSuffix(s.Cfg.OIDC.Issuer, "/")
+}
+
+type registerClientReq struct {
+	ClientName   string   `json:"client_name"`
+	RedirectURIs []string `json:"redirect_uris"`
+	// TokenEndpointAuthMethod is "none" for public clients, otherwise a
+	// secret is issued.
+	TokenEndpointAuthMethod string `json:"token_endpoint_auth_method"`
+}
+
+// (POST /oauth/clients)
+func (s *Server) RegisterOAuthClient(ctx echo.Context) error {
+	reqCtx, span := tracer.Start(ctx.Request().Context(), "handler.RegisterOAuthClient")
+	defer span.End()
+
+	claimUser := ctx.Get("claims").(*model.Claims)
+	if claimUser == nil {
+		return ctx.JSON(http.StatusForbidden, map[string]struct{}{})
+	}
+
+	req := new(registerClientReq)
+	if err := ctx.Bind(req); err != nil {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+	}
+	name := strings.TrimSpace(req.ClientName)
+	method := req.TokenEndpointAuthMethod
+	if method == "" {
+		method = authMethodBasic
+	}
+	if name == "" || utf8.RuneCountInString(name) > maxClientNameLen || !slices.Contains(tokenEndpointAuthMethods, method) {
+		return respondOAuthError(ctx, http.StatusBadRequest, &oauthError{"invalid_client_metadata",
+			"client_name of up to 100 characters is required and token_endpoint_auth_method must be one of " +
+				strings.Join(tokenEndpointAuthMethods, ", ")})
+	}
+	public := method == authMethodNone
+	if len(req.RedirectURIs) == 0 {
+		return respondOAuthError(ctx, http.StatusBadRequest, &oauthError{"invalid_redirect_uri", "redirect_uris are required"})
+	}
+	for _, redirectURI := range req.RedirectURIs {
+		if !validRedirectURI(redirectURI, public) {
+			return respondOAuthError(ctx, http.StatusBadRequest, &oauthError{"invalid_redirect_uri", "invalid redirect URI " + redirectURI})
+		}
+	}
+
+	user, err := s.Repository.GetUserByID(reqCtx, claimUser.UserID)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	client := repository.OAuthClient{
+		ClientID:     uuid.NewString(),
+		Name:         name,
+		RedirectURIs: req.RedirectURIs,
+		OwnerID:      user.UserID,
+	}
+	// The secret is only shown here; like other tokens only its hash is
+	// kept.
+	var secret string
+	if !public {
+		var hash string
+		if secret, hash, err = newToken(); err != nil {
+			span.SetStatus(codes.Error, err.Error())
+			return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		}
+		client.SecretHash = sql.NullString{String: hash, Valid: true}
+	}
+	if err = s.Repository.CreateOAuthClient(reqCtx, client); err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	data := map[string]interface{}{
+		"client_id":                  client.ClientID,
+		"client_name":                client.Name,
+		"redirect_uris":              client.RedirectURIs,
+		"token_endpoint_auth_method": method,
+	}
+	if secret != "" {
+		data["client_secret"] = secret
+	}
+	return ctx.JSON(http.StatusCreated, map[string]interface{}{"data": data})
+}
+
+type authorizeReq struct {
+	ResponseType        string `query:"response_type" json:"response_type"`
+	ClientID            string `query:"client_id" json:"client_id"`
+	RedirectURI         string `query:"redirect_uri" json:"redirect_uri"`
+	Scope               string `query:"scope" json:"scope"`
+	State               string `query:"state" json:"state"`
+	Nonce               string `query:"nonce" json:"nonce"`
+	CodeChallenge       string `query:"code_challenge" json:"code_challenge"`
+	CodeChallengeMethod string `query:"code_challenge_method" json:"code_challenge_method"`
+	// Approve is the answer on the consent screen, only sent to POST.
+	Approve bool `json:"approve"`
+}
+
+// checkAuthorization validates an authorization request, returning the
+// client and the requested scopes. Invalid requests fail with an
+// *oauthError; they are answered directly rather than redirected since the
+// redirect URI may be the invalid part.
+func (s *Server) checkAuthorization(ctx context.Context, req *authorizeReq) (client repository.OAuthClient, scopes []string, err error) {
+	client, err = s.Repository.GetOAuthClient(ctx, req.ClientID)
+	if errors.Is(err, repository.ErrOAuthNotFound) {
+		return client, nil, &oauthError{"invalid_client", "unknown client_id"}
+	}
+	if err != nil {
+		return client, nil, err
+	}
+	if !slices.Contains(client.RedirectURIs, req.RedirectURI) {
+		return client, nil, &oauthError{"invalid_request", "redirect_uri is not registered for the client"}
+	}
+	if req.ResponseType != "code" {
+		return client, nil, &oauthError{"unsupported_response_type", "only the code response type is supported"}
+	}
+	scopes, ok := parseScope(req.Scope)
+	if !ok {
+		return client, nil, &oauthError{"invalid_scope", "scope must include openid and only " + strings.Join(supportedScopes, ", ")}
+	}
+	if req.CodeChallengeMethod != "S256" || len(req.CodeChallenge) != 43 || !validPKCEValue(req.CodeChallenge) {
+		return client, nil, &oauthError{"invalid_request", "an S256 code_challenge is required"}
+	}
+	return client, scopes, nil
+}
+
+// grantedScopes returns the scopes the user granted the client before.
+func grantedScopes(ctx context.Context, repo repository.RepositoryInterface, userID, clientID string) ([]string, error) {
+	consent, err := repo.GetOAuthConsent(ctx, userID, clientID)
+	if errors.Is(err, repository.ErrOAuthNotFound) {
+		return nil, nil
+	}
+	return consent.Scopes, err
+}
+
+// (GET /oauth/authorize)
+func (s *Server) Authorize(ctx echo.Context) error {
+	reqCtx, span := tracer.Start(ctx.Request().Context(), "handler.Authorize")
+	defer span.End()
+
+	claimUser := ctx.Get("claims").(*model.Claims)
+	if claimUser == nil {
+		return ctx.JSON(http.StatusForbidden, map[string]struct{}{})
+	}
+
+	req := new(authorizeReq)
+	if err := ctx.Bind(req); err != nil {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+	client, scopes, err := s.checkAuthorization(reqCtx, req)
+	var oauthErr *oauthError
+	if errors.As(err, &oauthErr) {
+		return respondOAuthError(ctx, http.StatusBadRequest, oauthErr)
+	}
+	var user repository.User
+	if err == nil {
+		user, err = s.Repository.GetUserByID(reqCtx, claimUser.UserID)
+	}
+	var granted []string
+	if err == nil {
+		granted, err = grantedScopes(reqCtx, s.Repository, user.UserID, client.ClientID)
+	}
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	// The consent screen can be skipped when every scope was granted
+	// before.
+	consentRequired := false
+	for _, scope := range scopes {
+		if !slices.Contains(granted, scope) {
+			consentRequired = true
+		}
+	}
+	return ctx.JSON(http.StatusOK, map[string]interface{}{"data": map[string]interface{}{
+		"client_id":        client.ClientID,
+		"client_name":      client.Name,
+		"scopes":           scopes,
+		"consent_required": consentRequired,
+	}})
+}
+
+// (POST /oauth/authorize)
+func (s *Server) ApproveAuthorization(ctx echo.Context) error {
+	reqCtx, span := tracer.Start(ctx.Request().Context(), "handler.ApproveAuthorization")
+	defer span.End()
+
+	claimUser := ctx.Get("claims").(*model.Claims)
+	if claimUser == nil {
+		return ctx.JSON(http.StatusForbidden, map[string]struct{}{})
+	}
+
+	req := new(authorizeReq)
+	if err := ctx.Bind(req); err != nil {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+	}
+	client, scopes, err := s.checkAuthorization(reqCtx, req)
+	var oauthErr *oauthError
+	if errors.As(err, &oauthErr) {
+		return respondOAuthError(ctx, http.StatusBadRequest, oauthErr)
+	}
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	params := url.Values{"state": {req.State}, "iss": {s.issuer()}}
+	if !req.Approve {
+		params.Set("error", "access_denied")
+		return ctx.JSON(http.StatusOK, map[string]interface{}{"data": map[string]string{
+			"redirect_to": redirectWith(req.RedirectURI, params),
+		}})
+	}
+
+	code, codeHash, err := newToken()
+	if err == nil {
+		err = s.Repository.WithTx(reqCtx, func(repo repository.RepositoryInterface) error {
+			user, err := repo.GetUserByID(reqCtx, claimUser.UserID)
+			if err != nil {
+				return err
+			}
+			granted, err := grantedScopes(reqCtx, repo, user.UserID, client.ClientID)
+			if err != nil {
+				return err
+			}
+			for _, scope := range scopes {
+				if !slices.Contains(granted, scope) {
+					granted = append(granted, scope)
+				}
+			}
+			err = repo.SaveOAuthConsent(reqCtx, repository.OAuthConsent{
+				UserID:   user.UserID,
+				ClientID: client.ClientID,
+				Scopes:   granted,
+			})
+			if err != nil {
+				return err
+			}
+			return repo.CreateAuthorizationCode(reqCtx, repository.AuthorizationCode{
+				CodeHash:      codeHash,
+				ClientID:      client.ClientID,
+				UserID:        user.UserID,
+				RedirectURI:   req.RedirectURI,
+				Scope:         strings.Join(scopes, " "),
+				Nonce:         req.Nonce,
+				CodeChallenge: req.CodeChallenge,
+				ExpiresAt:     time.Now().Add(s.Cfg.OIDC.CodeTTL),
+			})
+		})
+	}
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	params.Set("code", code)
+	return ctx.JSON(http.StatusOK, map[string]interface{}{"data": map[string]string{
+		"redirect_to": redirectWith(req.RedirectURI, params),
+	}})
+}
+
+// authenticateClient identifies the client calling the token or revocation
+// endpoint by HTTP Basic credentials or the client_id and client_secret form
+// fields. Public clients send their client_id alone.
+func (s *Server) authenticateClient(ctx echo.Context, reqCtx context.Context) (repository.OAuthClient, error) {
+	clientID, secret := clientCredentials(ctx)
+	if clientID == "" {
+		return repository.OAuthClient{}, errInvalidClient
+	}
+
+	client, err := s.Repository.GetOAuthClient(reqCtx, clientID)
+	if errors.Is(err, repository.ErrOAuthNotFound) {
+		return client, errInvalidClient
+	}
+	if err != nil {
+		return client, err
+	}
+	if client.SecretHash.Valid {
+		if subtle.ConstantTimeCompare([]byte(hashToken(secret)), []byte(client.SecretHash.String)) != 1 {
+			return client, errInvalidClient
+		}
+	} else if secret != "" {
+		return client, errInvalidClient
+	}
+	return client, nil
+}
+
+// clientCredentials reads the client ID and secret from HTTP Basic
+// authentication or, without it, from the form.
+func clientCredentials(ctx echo.Context) (clientID, secret string) {
+	clientID, secret, basic := ctx.Request().BasicAuth()
+	if basic {
+		// RFC 6749 form-encodes both before they are Basic encoded.
+		clientID, _ = url.QueryUnescape(clientID)
+		secret, _ = url.QueryUnescape(secret)
+		return clientID, secret
+	}
+	return ctx.FormValue("client_id"), ctx.FormValue("client_secret")
+}
+
+// (POST /oauth/token)
+func (s *Server) IssueOAuthToken(ctx echo.Context) error {
+	reqCtx, span := tracer.Start(ctx.Request().Context(), "handler.IssueOAuthToken")
+	defer span.End()
+
+	ctx.Response().Header().Set("Cache-Control", "no-store")
+	ctx.Response().Header().Set("Pragma", "no-cache")
+
+	// Machine clients are kept apart from the clients users log in to, and
+	// only use the client credentials grant.
+	grantType := ctx.FormValue("grant_type")
+	if grantType == "client_credentials" {
+		return s.issueMachineToken(ctx, reqCtx, span)
+	}
+
+	client, err := s.authenticateClient(ctx, reqCtx)
+	if err != nil {
+		if errors.Is(err, errInvalidClient) {
+			return respondOAuthError(ctx, http.StatusUnauthorized, errInvalidClient)
+		}
+		span.SetStatus(codes.Error, err.Error())
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	switch grantType {
+	case "authorization_code":
+		return s.exchangeAuthorizationCode(ctx, reqCtx, span, client)
+	default:
+		return respondOAuthError(ctx, http.StatusBadRequest, &oauthError{"unsupported_grant_type",
+			"only authorization_code and client_credentials are supported"})
+	}
+}
+
+func (s *Server) exchangeAuthorizationCode(ctx echo.Context, reqCtx context.Context, span trace.Span, client repository.OAuthClient) error {
+	code, verifier := ctx.FormValue("code"), ctx.FormValue("code_verifier")
+	if code == "" || !validPKCEValue(verifier) {
+		return respondOAuthError(ctx, http.StatusBadRequest, &oauthError{"invalid_request", "code and code_verifier are required"})
+	}
+
+	// The code is used up even when the rest of the request is wrong.
+	grant, err := s.Repository.ConsumeAuthorizationCode(reqCtx, hashToken(code))
+	if err != nil {
+		if errors.Is(err, repository.ErrOAuthNotFound) {
+			return respondOAuthError(ctx, http.StatusBadRequest, errInvalidGrant)
+		}
+		span.SetStatus(codes.Error, err.Error())
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	challenge := pkceChallenge(verifier)
+	if grant.ClientID != client.ClientID || grant.RedirectURI != ctx.FormValue("redirect_uri") ||
+		subtle.ConstantTimeCompare([]byte(challenge), []byte(grant.CodeChallenge)) != 1 {
+		return respondOAuthError(ctx, http.StatusBadRequest, errInvalidGrant)
+	}
+
+	// Tokens of clients get a session of their own, so that the user sees
+	// and can revoke them like any other login.
+	user, err := s.Repository.GetUserByID(reqCtx, grant.UserID)
+	var session repository.Session
+	if err == nil {
+		session, err = startSessionUntil(ctx, reqCtx, s.Repository, grant.UserID, client.Name, time.Now().Add(s.Cfg.OIDC.TokenTTL))
+	}
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	now := time.Now()
+	accessToken, err := internal.SignToken(&model.Claims{
+		StandardClaims: jwt.StandardClaims{
+			Issuer:    s.issuer(),
+			Subject:   user.UserID,
+			IssuedAt:  now.Unix(),
+			ExpiresAt: session.ExpiresAt.Unix(),
+		},
+		SessionID: session.SessionID,
+		ClientID:  client.ClientID,
+		Scope:     grant.Scope,
+	}, s.Cfg.App.Env)
+	var idToken string
+	if err == nil {
+		idToken, err = internal.SignToken(&model.IDTokenClaims{
+			StandardClaims: jwt.StandardClaims{
+				Issuer:    s.issuer(),
+				Subject:   user.UserID,
+				Audience:  client.ClientID,
+				IssuedAt:  now.Unix(),
+				ExpiresAt: session.ExpiresAt.Unix(),
+			},
+			Nonce:           grant.Nonce,
+			AuthorizedParty: client.ClientID,
+			SessionID:       session.SessionID,
+		}, s.Cfg.App.Env)
+	}
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	return ctx.JSON(http.StatusOK, map[string]interface{}{
+		"access_token": accessToken,
+		"token_type":   "Bearer",
+		"expires_in":   int(session.ExpiresAt.Sub(now).Seconds()),
+		"id_token":     idToken,
+		"scope":        grant.Scope,
+	})
+}
+
+// parseToken verifies a token signed with our key, refusing expired ones.
+// Whether it was revoked is left to the caller.
+func (s *Server) parseToken(tokenString string) (*model.Claims, error) {
+	key, err := internal.SigningKey(s.Cfg.App.Env)
+	if err != nil {
+		return nil, err
+	}
+	claims := &model.Claims{}
+	_, err = jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		if token.Method != jwt.SigningMethodRS256 {
+			return nil, errors.New("unexpected signing method")
+		}
+		return key, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// (POST /oauth/revoke)
+func (s *Server) RevokeOAuthToken(ctx echo.Context) error {
+	reqCtx, span := tracer.Start(ctx.Request().Context(), "handler.RevokeOAuthToken")
+	defer span.End()
+
+	client, err := s.authenticateClient(ctx, reqCtx)
+	if err != nil {
+		if errors.Is(err, errInvalidClient) {
+			return respondOAuthError(ctx, http.StatusUnauthorized, errInvalidClient)
+		}
+		span.SetStatus(codes.Error, err.Error())
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	tokenString := ctx.FormValue("token")
+	if tokenString == "" {
+		return respondOAuthError(ctx, http.StatusBadRequest, &oauthError{"invalid_request", "token is required"})
+	}
+
+	// As RFC 7009 asks, invalid tokens and tokens of other clients are
+	// answered like revoked ones.
+	claims, err := s.parseToken(tokenString)
+	if err != nil || claims.ClientID != client.ClientID || claims.SessionID == "" {
+		return ctx.NoContent(http.StatusOK)
+	}
+	err = s.Repository.RevokeSession(reqCtx, claims.Subject, claims.SessionID)
+	if err != nil && !errors.Is(err, repository.ErrSessionNotFound) {
+		span.SetStatus(codes.Error, err.Error())
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return ctx.NoContent(http.StatusOK)
+}
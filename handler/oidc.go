@@ -0,0 +1,115 @@
+package handler
+
+import (
+	"encoding/base64"
+	"errors"
+	"math/big"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/SawitProRecruitment/UserService/internal"
+	"github.com/SawitProRecruitment/UserService/model"
+	"github.com/SawitProRecruitment/UserService/repository"
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel/codes"
+)
+
+// (GET /.well-known/openid-configuration)
+func (s *Server) OpenIDConfiguration(ctx echo.Context) error {
+	issuer := s.issuer()
+	return ctx.JSON(http.StatusOK, map[string]interface{}{
+		"issuer":                                        issuer,
+		"authorization_endpoint":                        issuer + "/oauth/authorize",
+		"token_endpoint":                                issuer + "/oauth/token",
+		"userinfo_endpoint":                             issuer + "/userinfo",
+		"revocation_endpoint":                           issuer + "/oauth/revoke",
+		"introspection_endpoint":                        issuer + "/oauth/introspect",
+		"jwks_uri":                                      issuer + "/.well-known/jwks.json",
+		"scopes_supported":                              append(supportedScopes[:len(supportedScopes):len(supportedScopes)], machineScopes...),
+		"response_types_supported":                      []string{"code"},
+		"grant_types_supported":                         []string{"authorization_code", "client_credentials"},
+		"subject_types_supported":                       []string{"public"},
+		"id_token_signing_alg_values_supported":         []string{"RS256"},
+		"token_endpoint_auth_methods_supported":         tokenEndpointAuthMethods,
+		"revocation_endpoint_auth_methods_supported":    tokenEndpointAuthMethods,
+		"introspection_endpoint_auth_methods_supported": []string{authMethodBasic, authMethodPost},
+		"code_challenge_methods_supported":              []string{"S256"},
+		"claims_supported": []string{"sub", "iss", "aud", "exp", "iat", "nonce", "azp", "sid",
+			"name", "picture", "locale", "zoneinfo", "email", "email_verified", "phone_number"},
+		"authorization_response_iss_parameter_supported": true,
+	})
+}
+
+// (GET /.well-known/jwks.json)
+func (s *Server) JWKS(ctx echo.Context) error {
+	key, err := internal.SigningKey(s.Cfg.App.Env)
+	if err != nil {
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return ctx.JSON(http.StatusOK, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"use": "sig",
+			"alg": "RS256",
+			"kid": internal.KeyID(key),
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}},
+	})
+}
+
+// (GET /userinfo)
+func (s *Server) UserInfo(ctx echo.Context) error {
+	reqCtx, span := tracer.Start(ctx.Request().Context(), "handler.UserInfo")
+	defer span.End()
+
+	claims := ctx.Get("claims").(*model.Claims)
+	if claims == nil {
+		return ctx.JSON(http.StatusForbidden, map[string]struct{}{})
+	}
+	scopes := strings.Fields(claims.Scope)
+	if !slices.Contains(scopes, scopeOpenID) {
+		return respondOAuthError(ctx, http.StatusForbidden, &oauthError{"insufficient_scope", "the openid scope is required"})
+	}
+
+	userDAO, err := s.Repository.GetUserByID(reqCtx, claims.Subject)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return respondOAuthError(ctx, http.StatusUnauthorized, &oauthError{"invalid_token", "the user no longer exists"})
+		}
+		span.SetStatus(codes.Error, err.Error())
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	user := model.FromRepoUser(userDAO)
+	profile := user.ToProfileResp()
+
+	// Claims are only released for the scopes granted, named as in OpenID
+	// Connect Core section 5.1.
+	info := map[string]interface{}{"sub": user.UserID}
+	if slices.Contains(scopes, scopeProfile) {
+		info["name"] = profile.Name
+		setClaim(info, "picture", profile.AvatarURL)
+		setClaim(info, "locale", profile.Locale)
+		setClaim(info, "zoneinfo", profile.Timezone)
+		updatedAt := user.UpdatedAt
+		if updatedAt.IsZero() {
+			updatedAt = user.CreatedAt
+		}
+		info["updated_at"] = updatedAt.Unix()
+	}
+	if slices.Contains(scopes, scopeEmail) && profile.Email != nil {
+		info["email"] = *profile.Email
+		info["email_verified"] = profile.EmailVerified
+	}
+	if slices.Contains(scopes, scopePhone) {
+		info["phone_number"] = profile.Phone
+	}
+	return ctx.JSON(http.StatusOK, info)
+}
+
+func setClaim(info map[string]interface{}, name string, value *string) {
+	if value != nil {
+		info[name] = *value
+	}
+}
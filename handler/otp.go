@@ -0,0 +1,194 @@
+package handler
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SawitProRecruitment/UserService/internal"
+	"github.com/SawitProRecruitment/UserService/model"
+	"github.com/SawitProRecruitment/UserService/repository"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel/codes"
+)
+
+var (
+	errInvalidOTP  = errors.New("invalid or expired code")
+	errTooManyOTPs = errors.New("too many codes requested, try again later")
+)
+
+// newOTPCode returns a random code of n decimal digits.
+func newOTPCode(n int) (string, error) {
+	max := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+	v, err := rand.Int(rand.Reader, max)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%0*d", n, v), nil
+}
+
+type loginOTPReq struct {
+	Phone      string `json:"phone"`
+	Code       string `json:"code"`
+	DeviceName string `json:"device_name"`
+}
+
+// (POST /login/otp/request)
+func (s *Server) RequestLoginOTP(ctx echo.Context) error {
+	reqCtx, span := tracer.Start(ctx.Request().Context(), "handler.RequestLoginOTP")
+	defer span.End()
+
+	req := new(loginOTPReq)
+	if err := ctx.Bind(req); err != nil {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+	}
+	phone := model.NormalizePhone(req.Phone)
+	if !model.ValidPhone(phone) {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": "invalid phone number"})
+	}
+
+	code, err := newOTPCode(s.Cfg.OTP.Length)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	// Numbers no user has get a code as well, which is never sent, so that
+	// they are answered and limited like any other.
+	var user repository.User
+	err = s.Repository.WithTx(reqCtx, func(repo repository.RepositoryInterface) error {
+		requested, err := repo.CountLoginOTPs(reqCtx, phone, s.Cfg.OTP.SendWindow)
+		if err != nil {
+			return err
+		}
+		if requested >= s.Cfg.OTP.MaxSends {
+			return errTooManyOTPs
+		}
+
+		otp := repository.LoginOTP{
+			ID:        uuid.NewString(),
+			Phone:     phone,
+			CodeHash:  hashToken(code),
+			ExpiresAt: time.Now().Add(s.Cfg.OTP.TTL),
+		}
+		user, err = repo.GetUserByPhone(reqCtx, phone)
+		if err != nil && !errors.Is(err, repository.ErrUserNotFound) {
+			return err
+		}
+		if err == nil {
+			otp.UserID = sql.NullString{String: user.UserID, Valid: true}
+		}
+		return repo.CreateLoginOTP(reqCtx, otp)
+	})
+	if err != nil {
+		if errors.Is(err, errTooManyOTPs) {
+			ctx.Response().Header().Set("Retry-After", strconv.Itoa(int(s.Cfg.OTP.SendWindow.Seconds())))
+			return ctx.JSON(http.StatusTooManyRequests, map[string]string{"error": err.Error()})
+		}
+		span.SetStatus(codes.Error, err.Error())
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	// The text is sent in the background, so that numbers with a user are
+	// not told apart by how long the provider takes.
+	if user.UserID != "" {
+		go s.sendLoginCode(context.WithoutCancel(reqCtx), internal.SMS{
+			To: user.Phone,
+			Body: fmt.Sprintf("%s is your login code. It expires in %d minutes. Do not share it with anyone.",
+				code, int(s.Cfg.OTP.TTL.Minutes())),
+		})
+	}
+	return ctx.JSON(http.StatusAccepted, map[string]interface{}{
+		"expires_in": int(s.Cfg.OTP.TTL.Seconds()),
+	})
+}
+
+// sendLoginCode texts a login code after its request was answered, so a
+// delivery failure is only logged; the user can ask for a new code.
+func (s *Server) sendLoginCode(ctx context.Context, sms internal.SMS) {
+	ctx, span := tracer.Start(ctx, "handler.sendLoginCode")
+	defer span.End()
+
+	if err := s.SMS.Send(ctx, sms); err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		log.Printf("send login code: %v", err)
+	}
+}
+
+// (POST /login/otp/verify)
+func (s *Server) VerifyLoginOTP(ctx echo.Context) error {
+	reqCtx, span := tracer.Start(ctx.Request().Context(), "handler.VerifyLoginOTP")
+	defer span.End()
+
+	req := new(loginOTPReq)
+	if err := ctx.Bind(req); err != nil || req.Phone == "" || req.Code == "" {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": "phone and code are required"})
+	}
+	phone := model.NormalizePhone(req.Phone)
+
+	// The attempt is counted outside the transaction below so that wrong
+	// codes still use up attempts.
+	otp, err := s.Repository.RecordLoginOTPAttempt(reqCtx, phone, s.Cfg.OTP.MaxAttempts)
+	if err != nil {
+		if errors.Is(err, repository.ErrOTPNotFound) {
+			return ctx.JSON(http.StatusUnauthorized, map[string]string{"error": errInvalidOTP.Error()})
+		}
+		span.SetStatus(codes.Error, err.Error())
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	codeHash := hashToken(strings.TrimSpace(req.Code))
+	if !otp.UserID.Valid || subtle.ConstantTimeCompare([]byte(codeHash), []byte(otp.CodeHash)) != 1 {
+		return ctx.JSON(http.StatusUnauthorized, map[string]string{"error": errInvalidOTP.Error()})
+	}
+
+	var (
+		user      model.User
+		challenge *mfaChallenge
+		session   repository.Session
+	)
+	err = s.Repository.WithTx(reqCtx, func(repo repository.RepositoryInterface) error {
+		if err := repo.ConsumeLoginOTP(reqCtx, otp.ID); err != nil {
+			return err
+		}
+		userDAO, err := repo.GetUserByID(reqCtx, otp.UserID.String)
+		if err != nil {
+			return err
+		}
+		// The code only proves access to the number it was texted to.
+		if userDAO.Phone != otp.Phone {
+			return repository.ErrOTPNotFound
+		}
+		user = model.FromRepoUser(userDAO)
+
+		// The code stands in for the password only; users with TOTP still
+		// finish with POST /login/mfa.
+		challenge, err = s.issueMFAChallenge(reqCtx, repo, user.UserID)
+		if err != nil || challenge != nil {
+			return err
+		}
+		if err = repo.IncrSuccessLogin(reqCtx, user.Phone); err != nil {
+			return err
+		}
+		session, err = startSession(ctx, reqCtx, repo, user.UserID, req.DeviceName)
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, repository.ErrOTPNotFound) || errors.Is(err, repository.ErrUserNotFound) {
+			return ctx.JSON(http.StatusUnauthorized, map[string]string{"error": errInvalidOTP.Error()})
+		}
+		span.SetStatus(codes.Error, err.Error())
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	return s.respondLogin(ctx, span, user, challenge, session)
+}
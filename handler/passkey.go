@@ -0,0 +1,314 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/SawitProRecruitment/UserService/model"
+	"github.com/SawitProRecruitment/UserService/repository"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel/codes"
+)
+
+var (
+	errInvalidPasskeyChallenge = errors.New("invalid or expired challenge")
+	errPasskeyNotVerified      = errors.New("passkey could not be verified")
+)
+
+// webAuthnUser presents a user and their passkeys to the webauthn package.
+type webAuthnUser struct {
+	user     repository.User
+	passkeys []repository.Passkey
+}
+
+// The user handle stored by authenticators is the user ID, which is random
+// and reveals nothing about the user.
+func (u webAuthnUser) WebAuthnID() []byte          { return []byte(u.user.UserID) }
+func (u webAuthnUser) WebAuthnName() string        { return u.user.Phone }
+func (u webAuthnUser) WebAuthnDisplayName() string { return u.user.Name }
+func (u webAuthnUser) WebAuthnIcon() string        { return "" }
+
+func (u webAuthnUser) WebAuthnCredentials() []webauthn.Credential {
+	credentials := make([]webauthn.Credential, 0, len(u.passkeys))
+	for _, passkey := range u.passkeys {
+		transports := make([]protocol.AuthenticatorTransport, 0, len(passkey.Transports))
+		for _, transport := range passkey.Transports {
+			transports = append(transports, protocol.AuthenticatorTransport(transport))
+		}
+		credentials = append(credentials, webauthn.Credential{
+			ID:              passkey.CredentialID,
+			PublicKey:       passkey.PublicKey,
+			AttestationType: passkey.AttestationType,
+			Transport:       transports,
+			Flags: webauthn.CredentialFlags{
+				BackupEligible: passkey.BackupEligible,
+				BackupState:    passkey.BackupState,
+			},
+			Authenticator: webauthn.Authenticator{
+				AAGUID:       passkey.AAGUID,
+				SignCount:    uint32(passkey.SignCount),
+				CloneWarning: passkey.CloneWarning,
+			},
+		})
+	}
+	return credentials
+}
+
+func newPasskey(userID string, credential *webauthn.Credential) repository.Passkey {
+	transports := make([]string, 0, len(credential.Transport))
+	for _, transport := range credential.Transport {
+		transports = append(transports, string(transport))
+	}
+	return repository.Passkey{
+		CredentialID:    credential.ID,
+		UserID:          userID,
+		PublicKey:       credential.PublicKey,
+		AttestationType: credential.AttestationType,
+		Transports:      transports,
+		AAGUID:          credential.Authenticator.AAGUID,
+		SignCount:       int64(credential.Authenticator.SignCount),
+		BackupEligible:  credential.Flags.BackupEligible,
+		BackupState:     credential.Flags.BackupState,
+	}
+}
+
+// saveWebAuthnChallenge keeps session until the client finishes the
+// ceremony.
+func (s *Server) saveWebAuthnChallenge(ctx context.Context, ceremony, userID string, session *webauthn.SessionData) error {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+	return s.Repository.CreateWebAuthnChallenge(ctx, repository.WebAuthnChallenge{
+		Challenge:   session.Challenge,
+		Ceremony:    ceremony,
+		UserID:      sql.NullString{String: userID, Valid: userID != ""},
+		SessionData: data,
+		ExpiresAt:   time.Now().Add(s.Cfg.WebAuthn.ChallengeTTL),
+	})
+}
+
+// consumeWebAuthnChallenge looks up the ceremony the client data answers.
+// The challenge is used up even when the answer turns out to be invalid.
+func (s *Server) consumeWebAuthnChallenge(ctx context.Context, ceremony string, clientData protocol.CollectedClientData) (challenge repository.WebAuthnChallenge, sessionData webauthn.SessionData, err error) {
+	challenge, err = s.Repository.ConsumeWebAuthnChallenge(ctx, clientData.Challenge, ceremony)
+	if errors.Is(err, repository.ErrPasskeyNotFound) {
+		return challenge, sessionData, errInvalidPasskeyChallenge
+	}
+	if err != nil {
+		return challenge, sessionData, err
+	}
+	return challenge, sessionData, json.Unmarshal(challenge.SessionData, &sessionData)
+}
+
+// (POST /user/passkeys/challenge)
+func (s *Server) BeginPasskeyRegistration(ctx echo.Context) error {
+	reqCtx, span := tracer.Start(ctx.Request().Context(), "handler.BeginPasskeyRegistration")
+	defer span.End()
+
+	claimUser := ctx.Get("claims").(*model.Claims)
+	if claimUser == nil {
+		return ctx.JSON(http.StatusForbidden, map[string]struct{}{})
+	}
+
+	rp, err := s.Cfg.WebAuthn.RelyingParty()
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	user, err := s.Repository.GetUserByID(reqCtx, claimUser.UserID)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	passkeys, err := s.Repository.ListPasskeys(reqCtx, user.UserID)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	// Passkeys have to be discoverable so that logins need no identifier,
+	// and authenticators holding one already are excluded.
+	owner := webAuthnUser{user: user, passkeys: passkeys}
+	exclusions := make([]protocol.CredentialDescriptor, 0, len(passkeys))
+	for _, credential := range owner.WebAuthnCredentials() {
+		exclusions = append(exclusions, credential.Descriptor())
+	}
+	creation, session, err := rp.BeginRegistration(owner,
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementRequired),
+		webauthn.WithExclusions(exclusions))
+	if err == nil {
+		err = s.saveWebAuthnChallenge(reqCtx, repository.CeremonyRegistration, user.UserID, session)
+	}
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	return ctx.JSON(http.StatusOK, map[string]interface{}{"data": creation})
+}
+
+// (POST /user/passkeys)
+func (s *Server) FinishPasskeyRegistration(ctx echo.Context) error {
+	reqCtx, span := tracer.Start(ctx.Request().Context(), "handler.FinishPasskeyRegistration")
+	defer span.End()
+
+	claimUser := ctx.Get("claims").(*model.Claims)
+	if claimUser == nil {
+		return ctx.JSON(http.StatusForbidden, map[string]struct{}{})
+	}
+
+	parsed, err := protocol.ParseCredentialCreationResponseBody(ctx.Request().Body)
+	if err != nil {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": "invalid credential"})
+	}
+
+	rp, err := s.Cfg.WebAuthn.RelyingParty()
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	challenge, sessionData, err := s.consumeWebAuthnChallenge(reqCtx, repository.CeremonyRegistration, parsed.Response.CollectedClientData)
+	if err != nil {
+		if errors.Is(err, errInvalidPasskeyChallenge) {
+			return ctx.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+		span.SetStatus(codes.Error, err.Error())
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	user, err := s.Repository.GetUserByID(reqCtx, claimUser.UserID)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	if challenge.UserID.String != user.UserID {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": errInvalidPasskeyChallenge.Error()})
+	}
+
+	credential, err := rp.CreateCredential(webAuthnUser{user: user}, sessionData, parsed)
+	if err != nil {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": errPasskeyNotVerified.Error()})
+	}
+	if err = s.Repository.CreatePasskey(reqCtx, newPasskey(user.UserID, credential)); err != nil {
+		if errors.Is(err, repository.ErrConflict) {
+			return ctx.JSON(http.StatusConflict, map[string]string{"error": "passkey is already registered"})
+		}
+		span.SetStatus(codes.Error, err.Error())
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	return ctx.JSON(http.StatusCreated, map[string]interface{}{"data": map[string]string{
+		"id": base64.RawURLEncoding.EncodeToString(credential.ID),
+	}})
+}
+
+// (POST /login/passkey/challenge)
+func (s *Server) BeginPasskeyLogin(ctx echo.Context) error {
+	reqCtx, span := tracer.Start(ctx.Request().Context(), "handler.BeginPasskeyLogin")
+	defer span.End()
+
+	rp, err := s.Cfg.WebAuthn.RelyingParty()
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	// A passkey stands in for both the password and a second factor, so
+	// the authenticator has to verify the user as well.
+	assertion, session, err := rp.BeginDiscoverableLogin(webauthn.WithUserVerification(protocol.VerificationRequired))
+	if err == nil {
+		err = s.saveWebAuthnChallenge(reqCtx, repository.CeremonyLogin, "", session)
+	}
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	return ctx.JSON(http.StatusOK, map[string]interface{}{"data": assertion})
+}
+
+// (POST /login/passkey)
+func (s *Server) FinishPasskeyLogin(ctx echo.Context) error {
+	reqCtx, span := tracer.Start(ctx.Request().Context(), "handler.FinishPasskeyLogin")
+	defer span.End()
+
+	parsed, err := protocol.ParseCredentialRequestResponseBody(ctx.Request().Body)
+	if err != nil {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": "invalid credential"})
+	}
+
+	rp, err := s.Cfg.WebAuthn.RelyingParty()
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	_, sessionData, err := s.consumeWebAuthnChallenge(reqCtx, repository.CeremonyLogin, parsed.Response.CollectedClientData)
+	if err != nil {
+		if errors.Is(err, errInvalidPasskeyChallenge) {
+			return ctx.JSON(http.StatusUnauthorized, map[string]string{"error": err.Error()})
+		}
+		span.SetStatus(codes.Error, err.Error())
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	// The authenticator tells whose passkey it is through the user handle.
+	var owner webAuthnUser
+	credential, err := rp.ValidateDiscoverableLogin(func(rawID, userHandle []byte) (webauthn.User, error) {
+		userID := string(userHandle)
+		if _, err := uuid.Parse(userID); err != nil {
+			return nil, repository.ErrUserNotFound
+		}
+		user, err := s.Repository.GetUserByID(reqCtx, userID)
+		if err != nil {
+			return nil, err
+		}
+		passkeys, err := s.Repository.ListPasskeys(reqCtx, userID)
+		if err != nil {
+			return nil, err
+		}
+		owner = webAuthnUser{user: user, passkeys: passkeys}
+		return owner, nil
+	}, sessionData, parsed)
+	if err != nil {
+		return ctx.JSON(http.StatusUnauthorized, map[string]string{"error": errPasskeyNotVerified.Error()})
+	}
+
+	passkey := newPasskey(owner.user.UserID, credential)
+	passkey.CloneWarning = credential.Authenticator.CloneWarning
+	user := model.FromRepoUser(owner.user)
+	var session repository.Session
+	err = s.Repository.WithTx(reqCtx, func(repo repository.RepositoryInterface) error {
+		if err := repo.UpdatePasskeyUse(reqCtx, passkey); err != nil {
+			return err
+		}
+		// A sign count that did not increase means the key may have been
+		// copied; the passkey is flagged and the login refused.
+		if passkey.CloneWarning {
+			return nil
+		}
+		if err := repo.IncrSuccessLogin(reqCtx, user.Phone); err != nil {
+			return err
+		}
+		var err error
+		session, err = startSession(ctx, reqCtx, repo, user.UserID, "")
+		return err
+	})
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	if passkey.CloneWarning {
+		return ctx.JSON(http.StatusUnauthorized, map[string]string{"error": errPasskeyNotVerified.Error()})
+	}
+
+	return s.respondToken(ctx, span, user, session)
+}
@@ -3,20 +3,36 @@ package handler
 import (
 	"github.com/SawitProRecruitment/UserService/internal"
 	"github.com/SawitProRecruitment/UserService/repository"
+	"go.opentelemetry.io/otel"
 )
 
+var tracer = otel.Tracer("github.com/SawitProRecruitment/UserService/handler")
+
 type Server struct {
 	Cfg        internal.Config
 	Repository repository.RepositoryInterface
+	Mailer     internal.Mailer
+	SMS        internal.SMSSender
 }
 
 type NewServerOptions struct {
 	Repository repository.RepositoryInterface
+	// Mailer defaults to internal.LogMailer.
+	Mailer internal.Mailer
+	// SMS has no default: texting login codes needs a real provider, and
+	// the OTP login routes are only registered when one is configured.
+	SMS internal.SMSSender
 }
 
 func NewServer(cfg internal.Config, opts NewServerOptions) *Server {
+	mailer := opts.Mailer
+	if mailer == nil {
+		mailer = internal.LogMailer{}
+	}
 	return &Server{
 		Cfg:        cfg,
 		Repository: opts.Repository,
+		Mailer:     mailer,
+		SMS:        opts.SMS,
 	}
 }
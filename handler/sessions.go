@@ -0,0 +1,188 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/SawitProRecruitment/UserService/internal"
+	"github.com/SawitProRecruitment/UserService/model"
+	"github.com/SawitProRecruitment/UserService/repository"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	maxUserAgentLength  = 512
+	maxDeviceNameLength = 100
+)
+
+// startSession records the session of a token about to be issued to the user
+// making the request.
+func startSession(ctx echo.Context, reqCtx context.Context, repo repository.RepositoryInterface, userID, deviceName string) (repository.Session, error) {
+	return startSessionUntil(ctx, reqCtx, repo, userID, deviceName, time.Now().Add(internal.TokenTTL))
+}
+
+// startSessionUntil is startSession for tokens expiring at expiresAt instead
+// of after internal.TokenTTL.
+func startSessionUntil(ctx echo.Context, reqCtx context.Context, repo repository.RepositoryInterface, userID, deviceName string, expiresAt time.Time) (repository.Session, error) {
+	userAgent := ctx.Request().UserAgent()
+	deviceName = strings.TrimSpace(deviceName)
+	if deviceName == "" {
+		deviceName = model.DescribeDevice(userAgent)
+	}
+
+	session := repository.Session{
+		SessionID:  uuid.NewString(),
+		UserID:     userID,
+		UserAgent:  truncate(userAgent, maxUserAgentLength),
+		IP:         ctx.RealIP(),
+		DeviceName: truncate(deviceName, maxDeviceNameLength),
+		ExpiresAt:  expiresAt,
+	}
+	return session, repo.CreateSession(reqCtx, session)
+}
+
+// issueToken signs an access token for user that lives as long as session.
+func (s *Server) issueToken(user model.User, session repository.Session) (string, error) {
+	return internal.GenerateJWTToken(user, session.SessionID, session.ExpiresAt, s.Cfg.App.Env)
+}
+
+// respondToken answers a login with a token for session. With session
+// cookies enabled the token is only set as the session cookie, out of reach
+// of scripts, and the answer carries the CSRF token of the session the
+// frontend has to send back with it instead.
+func (s *Server) respondToken(ctx echo.Context, span trace.Span, user model.User, session repository.Session) error {
+	tokenString, err := s.issueToken(user, session)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	if !s.Cfg.SessionCookie.Enabled {
+		return ctx.JSON(http.StatusOK, map[string]interface{}{
+			"token": tokenString,
+		})
+	}
+	csrfToken := model.CSRFToken(s.Cfg.SessionCookie.CSRFSecret, session.SessionID)
+	ctx.SetCookie(s.sessionCookie(model.SessionCookie, tokenString, session.ExpiresAt, true))
+	ctx.SetCookie(s.sessionCookie(model.CSRFCookie, csrfToken, session.ExpiresAt, false))
+	return ctx.JSON(http.StatusOK, map[string]interface{}{
+		"csrf_token": csrfToken,
+	})
+}
+
+func (s *Server) sessionCookie(name, value string, expires time.Time, httpOnly bool) *http.Cookie {
+	sameSite, _ := s.Cfg.SessionCookie.SameSiteMode()
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		Domain:   s.Cfg.SessionCookie.Domain,
+		Expires:  expires,
+		Secure:   true,
+		HttpOnly: httpOnly,
+		SameSite: sameSite,
+	}
+}
+
+func truncate(s string, maxRunes int) string {
+	if utf8.RuneCountInString(s) <= maxRunes {
+		return s
+	}
+	return string([]rune(s)[:maxRunes])
+}
+
+// (GET /user/sessions)
+func (s *Server) ListSessions(ctx echo.Context) error {
+	reqCtx, span := tracer.Start(ctx.Request().Context(), "handler.ListSessions")
+	defer span.End()
+
+	claimUser := ctx.Get("claims").(*model.Claims)
+	if claimUser == nil {
+		return ctx.JSON(http.StatusForbidden, map[string]struct{}{})
+	}
+
+	user, err := s.Repository.GetUserByID(reqCtx, claimUser.UserID)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	sessions, err := s.Repository.ListSessions(reqCtx, user.UserID)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	resp := make([]model.SessionResp, 0, len(sessions))
+	for _, session := range sessions {
+		resp = append(resp, model.FromRepoSession(session, claimUser.SessionID))
+	}
+	return ctx.JSON(http.StatusOK, map[string]interface{}{"data": resp})
+}
+
+// (DELETE /user/sessions/{id})
+func (s *Server) RevokeSession(ctx echo.Context) error {
+	reqCtx, span := tracer.Start(ctx.Request().Context(), "handler.RevokeSession")
+	defer span.End()
+
+	claimUser := ctx.Get("claims").(*model.Claims)
+	if claimUser == nil {
+		return ctx.JSON(http.StatusForbidden, map[string]struct{}{})
+	}
+
+	// Session IDs are UUIDs; anything else cannot name a session.
+	sessionID := ctx.Param("id")
+	if _, err := uuid.Parse(sessionID); err != nil {
+		return ctx.JSON(http.StatusNotFound, map[string]string{"error": repository.ErrSessionNotFound.Error()})
+	}
+
+	err := s.Repository.WithTx(reqCtx, func(repo repository.RepositoryInterface) error {
+		user, err := repo.GetUserByID(reqCtx, claimUser.UserID)
+		if err != nil {
+			return err
+		}
+		return repo.RevokeSession(reqCtx, user.UserID, sessionID)
+	})
+	if err != nil {
+		if errors.Is(err, repository.ErrSessionNotFound) {
+			return ctx.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		}
+		span.SetStatus(codes.Error, err.Error())
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return ctx.NoContent(http.StatusNoContent)
+}
+
+// (DELETE /user/sessions)
+func (s *Server) RevokeOtherSessions(ctx echo.Context) error {
+	reqCtx, span := tracer.Start(ctx.Request().Context(), "handler.RevokeOtherSessions")
+	defer span.End()
+
+	claimUser := ctx.Get("claims").(*model.Claims)
+	if claimUser == nil {
+		return ctx.JSON(http.StatusForbidden, map[string]struct{}{})
+	}
+
+	var revoked int64
+	err := s.Repository.WithTx(reqCtx, func(repo repository.RepositoryInterface) error {
+		user, err := repo.GetUserByID(reqCtx, claimUser.UserID)
+		if err != nil {
+			return err
+		}
+		revoked, err = repo.RevokeOtherSessions(reqCtx, user.UserID, claimUser.SessionID)
+		return err
+	})
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return ctx.JSON(http.StatusOK, map[string]interface{}{"data": map[string]int64{
+		"revoked": revoked,
+	}})
+}
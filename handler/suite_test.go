@@ -1,13 +1,188 @@
 package handler
 
 import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"sync"
 	"testing"
 
+	"github.com/SawitProRecruitment/UserService/internal"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+	"github.com/go-webauthn/webauthn/protocol/webauthncose"
+
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 )
 
+var spanExporter = tracetest.NewInMemoryExporter()
+
 func TestUsecase(t *testing.T) {
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(spanExporter)))
+
 	RegisterFailHandler(Fail)
 	RunSpecs(t, "handler suite")
 }
+
+type fakeMailer struct {
+	sent []internal.Mail
+}
+
+func (m *fakeMailer) Send(ctx context.Context, mail internal.Mail) error {
+	m.sent = append(m.sent, mail)
+	return nil
+}
+
+// fakeSMSSender records texts, which handlers send in the background.
+type fakeSMSSender struct {
+	mu   sync.Mutex
+	sent []internal.SMS
+}
+
+func (s *fakeSMSSender) Send(ctx context.Context, sms internal.SMS) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sent = append(s.sent, sms)
+	return nil
+}
+
+func (s *fakeSMSSender) Sent() []internal.SMS {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]internal.SMS(nil), s.sent...)
+}
+
+// softAuthenticator is a passkey held in memory. It answers the options of
+// the passkey endpoints like a browser and platform authenticator would.
+type softAuthenticator struct {
+	rpID   string
+	origin string
+	key    *ecdsa.PrivateKey
+	id     []byte
+	// userHandle is stored on registration and returned on login.
+	userHandle []byte
+	signCount  uint32
+}
+
+func newSoftAuthenticator(rpID, origin string) *softAuthenticator {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	id := make([]byte, 16)
+	if _, err = rand.Read(id); err != nil {
+		panic(err)
+	}
+	return &softAuthenticator{rpID: rpID, origin: origin, key: key, id: id}
+}
+
+const (
+	flagUserPresent        = 0x01
+	flagUserVerified       = 0x04
+	flagAttestedData       = 0x40
+	softAuthenticatorFlags = flagUserPresent | flagUserVerified
+)
+
+func (a *softAuthenticator) authenticatorData(flags byte, attested []byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(a.rpID))
+	data := append(rpIDHash[:], flags)
+	data = binary.BigEndian.AppendUint32(data, a.signCount)
+	return append(data, attested...)
+}
+
+func (a *softAuthenticator) clientData(ceremony string, challenge protocol.URLEncodedBase64) []byte {
+	data, err := json.Marshal(map[string]string{
+		"type":      ceremony,
+		"challenge": base64.RawURLEncoding.EncodeToString(challenge),
+		"origin":    a.origin,
+	})
+	if err != nil {
+		panic(err)
+	}
+	return data
+}
+
+// register creates the credential for options and returns the body for
+// POST /user/passkeys.
+func (a *softAuthenticator) register(options protocol.PublicKeyCredentialCreationOptions) []byte {
+	userHandle, err := base64.RawURLEncoding.DecodeString(options.User.ID.(string))
+	if err != nil {
+		panic(err)
+	}
+	a.userHandle = userHandle
+
+	publicKey, err := webauthncbor.Marshal(webauthncose.EC2PublicKeyData{
+		PublicKeyData: webauthncose.PublicKeyData{
+			KeyType:   int64(webauthncose.EllipticKey),
+			Algorithm: int64(webauthncose.AlgES256),
+		},
+		Curve:  int64(webauthncose.P256),
+		XCoord: a.key.X.FillBytes(make([]byte, 32)),
+		YCoord: a.key.Y.FillBytes(make([]byte, 32)),
+	})
+	if err != nil {
+		panic(err)
+	}
+	attested := make([]byte, 16) // AAGUID
+	attested = binary.BigEndian.AppendUint16(attested, uint16(len(a.id)))
+	attested = append(attested, a.id...)
+	attested = append(attested, publicKey...)
+
+	attestation, err := webauthncbor.Marshal(map[string]interface{}{
+		"fmt":      "none",
+		"attStmt":  map[string]interface{}{},
+		"authData": a.authenticatorData(softAuthenticatorFlags|flagAttestedData, attested),
+	})
+	if err != nil {
+		panic(err)
+	}
+	return a.credential(map[string]interface{}{
+		"clientDataJSON":    protocol.URLEncodedBase64(a.clientData("webauthn.create", options.Challenge)),
+		"attestationObject": protocol.URLEncodedBase64(attestation),
+		"transports":        []string{"internal", "hybrid"},
+	})
+}
+
+// login signs the challenge of options and returns the body for
+// POST /login/passkey.
+func (a *softAuthenticator) login(options protocol.PublicKeyCredentialRequestOptions) []byte {
+	a.signCount++
+	authData := a.authenticatorData(softAuthenticatorFlags, nil)
+	clientData := a.clientData("webauthn.get", options.Challenge)
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		panic(err)
+	}
+	return a.credential(map[string]interface{}{
+		"clientDataJSON":    protocol.URLEncodedBase64(clientData),
+		"authenticatorData": protocol.URLEncodedBase64(authData),
+		"signature":         protocol.URLEncodedBase64(signature),
+		"userHandle":        protocol.URLEncodedBase64(a.userHandle),
+	})
+}
+
+func (a *softAuthenticator) credential(response map[string]interface{}) []byte {
+	id := base64.RawURLEncoding.EncodeToString(a.id)
+	body, err := json.Marshal(map[string]interface{}{
+		"id":                      id,
+		"rawId":                   id,
+		"type":                    "public-key",
+		"authenticatorAttachment": "platform",
+		"response":                response,
+	})
+	if err != nil {
+		panic(err)
+	}
+	return body
+}
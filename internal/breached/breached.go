@@ -0,0 +1,119 @@
+// Package breached checks passwords against a local copy of a breached
+// password list using the k-anonymity scheme of the Pwned Passwords range
+// API: a password is looked up by the first five hex characters of its SHA-1
+// hash and the remaining 35 are compared locally.
+package breached
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const prefixLen = 5
+
+// Source returns the upper case SHA-1 hash suffixes of breached passwords
+// whose hash starts with prefix.
+type Source interface {
+	Range(prefix string) ([]string, error)
+}
+
+// Contains reports whether password appears in src.
+func Contains(src Source, password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	suffixes, err := src.Range(hash[:prefixLen])
+	if err != nil {
+		return false, err
+	}
+	i := sort.SearchStrings(suffixes, hash[prefixLen:])
+	return i < len(suffixes) && suffixes[i] == hash[prefixLen:], nil
+}
+
+// Load opens the list at path. A directory is read as one file per prefix
+// named like "ABCDE.txt" holding "SUFFIX:COUNT" lines, the layout written by
+// the Pwned Passwords downloader, and files are only read when a password
+// with that prefix is checked. Any other file holds one full hash per line,
+// optionally followed by ":COUNT", and is loaded into memory.
+func Load(path string) (Source, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return dirSource(path), nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	src := memorySource{}
+	err = readHashes(f, func(hash string) error {
+		if len(hash) != sha1.Size*2 {
+			return fmt.Errorf("breached: invalid hash %q in %s", hash, path)
+		}
+		src[hash[:prefixLen]] = append(src[hash[:prefixLen]], hash[prefixLen:])
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, suffixes := range src {
+		sort.Strings(suffixes)
+	}
+	return src, nil
+}
+
+type memorySource map[string][]string
+
+func (m memorySource) Range(prefix string) ([]string, error) {
+	return m[prefix], nil
+}
+
+type dirSource string
+
+func (d dirSource) Range(prefix string) ([]string, error) {
+	f, err := os.Open(filepath.Join(string(d), prefix+".txt"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	var suffixes []string
+	err = readHashes(f, func(suffix string) error {
+		suffixes = append(suffixes, suffix)
+		return nil
+	})
+	sort.Strings(suffixes)
+	return suffixes, err
+}
+
+// readHashes calls fn with the upper cased hash of every non-empty line,
+// dropping the ":COUNT" suffix.
+func readHashes(r io.Reader, fn func(hash string) error) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		hash, _, _ := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if hash == "" {
+			continue
+		}
+		if err := fn(strings.ToUpper(hash)); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
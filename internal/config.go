@@ -1,21 +1,332 @@
 package internal
 
-import "github.com/spf13/viper"
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/SawitProRecruitment/UserService/internal/breached"
+	"github.com/SawitProRecruitment/UserService/internal/passhash"
+	"github.com/SawitProRecruitment/UserService/model"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/spf13/viper"
+)
 
 type Config struct {
-	App AppConfig `mapstructure:"app"`
-	DB  Database  `mapstructure:"database"`
+	App      AppConfig  `mapstructure:"app"`
+	DB       Database   `mapstructure:"database"`
+	Tracing  Tracing    `mapstructure:"tracing"`
+	Email    Email      `mapstructure:"email"`
+	Phone    Phone      `mapstructure:"phone"`
+	Password Password   `mapstructure:"password"`
+	Hashing  Hashing    `mapstructure:"password_hashing"`
+	MFA      MFA        `mapstructure:"mfa"`
+	WebAuthn WebAuthn   `mapstructure:"webauthn"`
+	OTP      OTP        `mapstructure:"otp"`
+	SMS      SMSGateway `mapstructure:"sms"`
+	OIDC     OIDC       `mapstructure:"oidc"`
+	Admin    Admin      `mapstructure:"admin"`
+	// ForwardAuth configures the endpoint reverse proxies check requests
+	// with.
+	ForwardAuth ForwardAuth `mapstructure:"forward_auth"`
+	ExtAuthz    ExtAuthz    `mapstructure:"ext_authz"`
+	GRPC        GRPC        `mapstructure:"grpc"`
+	// SessionCookie configures the cookie sessions of browsers.
+	SessionCookie SessionCookie `mapstructure:"session_cookie"`
 }
 type AppConfig struct {
 	Env string `mapstructure:"env"`
 }
 
+const (
+	DriverPostgres = "postgres"
+	DriverPgx      = "pgx"
+)
+
 type Database struct {
+	// Driver selects the repository implementation: DriverPostgres uses
+	// database/sql with lib/pq, DriverPgx uses a native pgx pool.
+	Driver       string `mapstructure:"driver"`
 	Host         string `mapstructure:"host"`
 	Port         int    `mapstructure:"port"`
 	User         string `mapstructure:"user"`
 	Password     string `mapstructure:"password"`
 	DatabaseName string `mapstructure:"database"`
+
+	MaxOpenConns    int           `mapstructure:"max_open_conns"`
+	MaxIdleConns    int           `mapstructure:"max_idle_conns"`
+	ConnMaxLifetime time.Duration `mapstructure:"conn_max_lifetime"`
+	ConnMaxIdleTime time.Duration `mapstructure:"conn_max_idle_time"`
+	ConnectRetries  int           `mapstructure:"connect_retries"`
+	ConnectBackoff  time.Duration `mapstructure:"connect_backoff"`
+}
+
+type Email struct {
+	// VerificationURL is the page the verification link points to; the
+	// token is appended as the "token" query parameter.
+	VerificationURL string        `mapstructure:"verification_url"`
+	VerificationTTL time.Duration `mapstructure:"verification_ttl"`
+}
+
+type Phone struct {
+	// DefaultCountry is the region of numbers written with a leading 0.
+	DefaultCountry   string   `mapstructure:"default_country"`
+	AllowedCountries []string `mapstructure:"allowed_countries"`
+	// Countries describes regions missing from model.KnownPhoneCountries or
+	// overrides their rules.
+	Countries []model.PhoneCountry `mapstructure:"countries"`
+}
+
+type Password struct {
+	MinLength      int  `mapstructure:"min_length"`
+	MaxLength      int  `mapstructure:"max_length"`
+	RequireUpper   bool `mapstructure:"require_upper"`
+	RequireLower   bool `mapstructure:"require_lower"`
+	RequireDigit   bool `mapstructure:"require_digit"`
+	RequireSpecial bool `mapstructure:"require_special"`
+	DisallowName   bool `mapstructure:"disallow_name"`
+	DisallowPhone  bool `mapstructure:"disallow_phone"`
+	// BreachedList is a breached password list as read by breached.Load;
+	// the check is skipped when empty.
+	BreachedList string `mapstructure:"breached_list"`
+}
+
+// PasswordPolicy builds the policy described by p, loading its breached
+// password list.
+func (p Password) PasswordPolicy() (model.PasswordPolicy, error) {
+	policy := model.PasswordPolicy{
+		MinLength:      p.MinLength,
+		MaxLength:      p.MaxLength,
+		RequireUpper:   p.RequireUpper,
+		RequireLower:   p.RequireLower,
+		RequireDigit:   p.RequireDigit,
+		RequireSpecial: p.RequireSpecial,
+		DisallowName:   p.DisallowName,
+		DisallowPhone:  p.DisallowPhone,
+	}
+	if p.BreachedList != "" {
+		src, err := breached.Load(p.BreachedList)
+		if err != nil {
+			return model.PasswordPolicy{}, err
+		}
+		policy.Breached = src
+	}
+	return policy, nil
+}
+
+const (
+	HashArgon2id = "argon2id"
+	HashBcrypt   = "bcrypt"
+)
+
+type Hashing struct {
+	// Algorithm new hashes are made with; hashes of the other algorithm are
+	// still accepted and upgraded on login, as are hashes with parameters
+	// differing from the ones below.
+	Algorithm string `mapstructure:"algorithm"`
+	Argon2id  struct {
+		Memory      uint32 `mapstructure:"memory"`
+		Iterations  uint32 `mapstructure:"iterations"`
+		Parallelism uint8  `mapstructure:"parallelism"`
+		SaltLength  uint32 `mapstructure:"salt_length"`
+		KeyLength   uint32 `mapstructure:"key_length"`
+	} `mapstructure:"argon2id"`
+	Bcrypt struct {
+		Cost int `mapstructure:"cost"`
+	} `mapstructure:"bcrypt"`
+}
+
+// Hasher builds the password hasher described by h.
+func (h Hashing) Hasher() (*passhash.Hasher, error) {
+	argon := passhash.Argon2id{
+		Memory:      h.Argon2id.Memory,
+		Iterations:  h.Argon2id.Iterations,
+		Parallelism: h.Argon2id.Parallelism,
+		SaltLength:  h.Argon2id.SaltLength,
+		KeyLength:   h.Argon2id.KeyLength,
+	}
+	bcrypt := passhash.Bcrypt{Cost: h.Bcrypt.Cost}
+
+	switch h.Algorithm {
+	case HashArgon2id:
+		return passhash.New(argon, bcrypt), nil
+	case HashBcrypt:
+		return passhash.New(bcrypt, argon), nil
+	default:
+		return nil, fmt.Errorf("unknown password hashing algorithm %q", h.Algorithm)
+	}
+}
+
+type MFA struct {
+	// Issuer is shown next to the account in authenticator apps.
+	Issuer string `mapstructure:"issuer"`
+	// ChallengeTTL is how long the mfa_token returned by login is valid.
+	ChallengeTTL time.Duration `mapstructure:"challenge_ttl"`
+	// MaxAttempts is how many codes may be tried per mfa_token.
+	MaxAttempts   int `mapstructure:"max_attempts"`
+	RecoveryCodes int `mapstructure:"recovery_codes"`
+	// Skew is how many 30 second steps a code may be off.
+	Skew int `mapstructure:"skew"`
+}
+
+type WebAuthn struct {
+	// RPID is the domain passkeys are bound to, e.g. "example.com".
+	RPID          string `mapstructure:"rp_id"`
+	RPDisplayName string `mapstructure:"rp_display_name"`
+	// RPOrigins are the origins ceremonies may run on, e.g.
+	// "https://example.com" or "android:apk-key-hash:..." for apps.
+	RPOrigins []string `mapstructure:"rp_origins"`
+	// ChallengeTTL is how long a registration or login ceremony may take.
+	ChallengeTTL time.Duration `mapstructure:"challenge_ttl"`
+	// LoginRateLimit limits the login ceremonies begun, as anyone may begin
+	// one.
+	LoginRateLimit RateLimit `mapstructure:"login_rate_limit"`
+}
+
+// RateLimit allows Rate requests per second from each client IP, in bursts
+// of up to Burst requests.
+type RateLimit struct {
+	Rate  float64 `mapstructure:"rate"`
+	Burst int     `mapstructure:"burst"`
+}
+
+// RelyingParty builds the WebAuthn relying party described by w.
+func (w WebAuthn) RelyingParty() (*webauthn.WebAuthn, error) {
+	timeout := webauthn.TimeoutConfig{Enforce: true, Timeout: w.ChallengeTTL, TimeoutUVD: w.ChallengeTTL}
+	return webauthn.New(&webauthn.Config{
+		RPID:          w.RPID,
+		RPDisplayName: w.RPDisplayName,
+		RPOrigins:     w.RPOrigins,
+		Timeouts:      webauthn.TimeoutsConfig{Login: timeout, Registration: timeout},
+	})
+}
+
+type OTP struct {
+	// Length is the number of digits of a texted login code.
+	Length int           `mapstructure:"length"`
+	TTL    time.Duration `mapstructure:"ttl"`
+	// MaxAttempts is how many codes may be tried per texted code.
+	MaxAttempts int `mapstructure:"max_attempts"`
+	// MaxSends is how many codes may be requested for a phone within
+	// SendWindow; with MaxAttempts it bounds the guesses per window.
+	MaxSends   int           `mapstructure:"max_sends"`
+	SendWindow time.Duration `mapstructure:"send_window"`
+}
+
+type SMSGateway struct {
+	// WebhookURL is where texts are posted for delivery, see
+	// WebhookSMSSender. Without it login codes cannot be texted and the
+	// OTP login routes are left out.
+	WebhookURL string        `mapstructure:"webhook_url"`
+	Timeout    time.Duration `mapstructure:"timeout"`
+}
+
+// Enabled reports whether a gateway is configured.
+func (g SMSGateway) Enabled() bool {
+	return g.WebhookURL != ""
+}
+
+// Sender builds the SMS sender described by g.
+func (g SMSGateway) Sender() (SMSSender, error) {
+	if !g.Enabled() {
+		return nil, errors.New("sms.webhook_url is required")
+	}
+	if _, err := url.ParseRequestURI(g.WebhookURL); err != nil {
+		return nil, fmt.Errorf("invalid sms.webhook_url: %w", err)
+	}
+	return WebhookSMSSender{URL: g.WebhookURL, Client: &http.Client{Timeout: g.Timeout}}, nil
+}
+
+type OIDC struct {
+	// Issuer is the public base URL of the service, e.g.
+	// "https://id.example.com". It names the ID tokens' issuer and prefixes
+	// the endpoints in the discovery document.
+	Issuer string `mapstructure:"issuer"`
+	// CodeTTL is how long an authorization code can be exchanged for tokens.
+	CodeTTL time.Duration `mapstructure:"code_ttl"`
+	// TokenTTL is how long access and ID tokens issued to clients last.
+	TokenTTL time.Duration `mapstructure:"token_ttl"`
+	// MachineTokenTTL is how long tokens of the client credentials grant
+	// last.
+	MachineTokenTTL time.Duration `mapstructure:"machine_token_ttl"`
+}
+
+type ForwardAuth struct {
+	// LoginURL is where users without a valid token are sent, with the URL
+	// they asked for in the "rd" query parameter. Without it they only get
+	// a 401.
+	LoginURL string `mapstructure:"login_url"`
+}
+
+type ExtAuthz struct {
+	// Address is where the Envoy ext_authz gRPC server listens, e.g.
+	// ":9191"; it is not started when empty.
+	Address string `mapstructure:"address"`
+}
+
+type GRPC struct {
+	// Address is where the gRPC UserService listens, e.g. ":9090"; it is
+	// not started when empty.
+	Address string `mapstructure:"address"`
+}
+
+type SessionCookie struct {
+	// Enabled makes logins also set the session cookie, along with a CSRF
+	// token cookie that requests authenticated by the session cookie have
+	// to repeat in the X-CSRF-Token header.
+	Enabled bool `mapstructure:"enabled"`
+	// SameSite is "strict", "lax" or "none".
+	SameSite string `mapstructure:"same_site"`
+	// Domain of the cookies, defaulting to the host of the request.
+	Domain string `mapstructure:"domain"`
+	// CSRFSecret derives the CSRF tokens from the sessions, see
+	// model.CSRFToken. It is required when Enabled.
+	CSRFSecret string `mapstructure:"csrf_secret"`
+}
+
+// minCSRFSecretLength is the length of a SHA-256 key.
+const minCSRFSecretLength = 32
+
+// Validate reports settings of c the service cannot run with.
+func (c SessionCookie) Validate() error {
+	if _, err := c.SameSiteMode(); err != nil {
+		return err
+	}
+	if c.Enabled && len(c.CSRFSecret) < minCSRFSecretLength {
+		return fmt.Errorf("session_cookie.csrf_secret needs at least %d characters", minCSRFSecretLength)
+	}
+	return nil
+}
+
+// SameSiteMode returns the SameSite attribute described by c, or
+// http.SameSiteLaxMode with an error for unknown ones.
+func (c SessionCookie) SameSiteMode() (http.SameSite, error) {
+	switch strings.ToLower(c.SameSite) {
+	case "strict":
+		return http.SameSiteStrictMode, nil
+	case "lax":
+		return http.SameSiteLaxMode, nil
+	case "none":
+		return http.SameSiteNoneMode, nil
+	default:
+		return http.SameSiteLaxMode, fmt.Errorf("unknown session_cookie.same_site %q", c.SameSite)
+	}
+}
+
+type Admin struct {
+	// UserIDs are the users who may manage machine clients.
+	UserIDs []string `mapstructure:"user_ids"`
+}
+
+type Tracing struct {
+	ServiceName string  `mapstructure:"service_name"`
+	Exporter    string  `mapstructure:"exporter"`
+	Endpoint    string  `mapstructure:"endpoint"`
+	Insecure    bool    `mapstructure:"insecure"`
+	SampleRatio float64 `mapstructure:"sample_ratio"`
 }
 
 func LoadConfig(path string) (Config, error) {
@@ -24,6 +335,64 @@ func LoadConfig(path string) (Config, error) {
 	viper.SetConfigName("config")
 	viper.SetConfigType("json")
 	viper.AutomaticEnv()
+	viper.SetDefault("database.driver", DriverPostgres)
+	viper.SetDefault("database.max_open_conns", 25)
+	viper.SetDefault("database.max_idle_conns", 25)
+	viper.SetDefault("database.conn_max_lifetime", "30m")
+	viper.SetDefault("database.conn_max_idle_time", "5m")
+	viper.SetDefault("database.connect_retries", 5)
+	viper.SetDefault("database.connect_backoff", "1s")
+	viper.SetDefault("email.verification_url", "http://localhost:8080/verify-email")
+	viper.SetDefault("email.verification_ttl", "24h")
+	viper.SetDefault("phone.default_country", "ID")
+	viper.SetDefault("phone.allowed_countries", []string{"ID"})
+	viper.SetDefault("password.min_length", model.DefaultPasswordPolicy.MinLength)
+	viper.SetDefault("password.max_length", model.DefaultPasswordPolicy.MaxLength)
+	viper.SetDefault("password.require_upper", model.DefaultPasswordPolicy.RequireUpper)
+	viper.SetDefault("password.require_lower", model.DefaultPasswordPolicy.RequireLower)
+	viper.SetDefault("password.require_digit", model.DefaultPasswordPolicy.RequireDigit)
+	viper.SetDefault("password.require_special", model.DefaultPasswordPolicy.RequireSpecial)
+	viper.SetDefault("password.disallow_name", model.DefaultPasswordPolicy.DisallowName)
+	viper.SetDefault("password.disallow_phone", model.DefaultPasswordPolicy.DisallowPhone)
+	viper.SetDefault("password_hashing.algorithm", HashArgon2id)
+	viper.SetDefault("password_hashing.argon2id.memory", passhash.DefaultArgon2id.Memory)
+	viper.SetDefault("password_hashing.argon2id.iterations", passhash.DefaultArgon2id.Iterations)
+	viper.SetDefault("password_hashing.argon2id.parallelism", passhash.DefaultArgon2id.Parallelism)
+	viper.SetDefault("password_hashing.argon2id.salt_length", passhash.DefaultArgon2id.SaltLength)
+	viper.SetDefault("password_hashing.argon2id.key_length", passhash.DefaultArgon2id.KeyLength)
+	viper.SetDefault("password_hashing.bcrypt.cost", 10)
+	viper.SetDefault("mfa.issuer", "UserService")
+	viper.SetDefault("mfa.challenge_ttl", "5m")
+	viper.SetDefault("mfa.max_attempts", 5)
+	viper.SetDefault("mfa.recovery_codes", 10)
+	viper.SetDefault("mfa.skew", 1)
+	viper.SetDefault("webauthn.rp_id", "localhost")
+	viper.SetDefault("webauthn.rp_display_name", "UserService")
+	viper.SetDefault("webauthn.rp_origins", []string{"http://localhost:8080"})
+	viper.SetDefault("webauthn.challenge_ttl", "5m")
+	viper.SetDefault("webauthn.login_rate_limit.rate", 1)
+	viper.SetDefault("webauthn.login_rate_limit.burst", 10)
+	viper.SetDefault("otp.length", 6)
+	viper.SetDefault("otp.ttl", "5m")
+	viper.SetDefault("otp.max_attempts", 5)
+	viper.SetDefault("otp.max_sends", 3)
+	viper.SetDefault("otp.send_window", "15m")
+	viper.SetDefault("sms.webhook_url", "")
+	viper.SetDefault("sms.timeout", "10s")
+	viper.SetDefault("oidc.issuer", "http://localhost:8080")
+	viper.SetDefault("oidc.code_ttl", "1m")
+	viper.SetDefault("oidc.token_ttl", "1h")
+	viper.SetDefault("oidc.machine_token_ttl", "15m")
+	viper.SetDefault("admin.user_ids", []string{})
+	viper.SetDefault("forward_auth.login_url", "")
+	viper.SetDefault("ext_authz.address", "")
+	viper.SetDefault("grpc.address", "")
+	viper.SetDefault("session_cookie.enabled", false)
+	viper.SetDefault("session_cookie.same_site", "lax")
+	viper.SetDefault("session_cookie.csrf_secret", "")
+	viper.SetDefault("tracing.service_name", "user-service")
+	viper.SetDefault("tracing.exporter", TraceExporterNone)
+	viper.SetDefault("tracing.sample_ratio", 1.0)
 	err := viper.ReadInConfig()
 	if err != nil {
 		return config, err
@@ -2,13 +2,20 @@ package internal
 
 import (
 	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
 	"github.com/SawitProRecruitment/UserService/model"
 	"github.com/dgrijalva/jwt-go"
+	"math/big"
 	"os"
 	"time"
 )
 
-func GenerateJWTToken(user model.User, env string) (string, error) {
+// TokenTTL is how long access tokens, and the sessions they belong to, last.
+const TokenTTL = 24 * time.Hour
+
+func GenerateJWTToken(user model.User, sessionID string, expiresAt time.Time, env string) (string, error) {
 	privateKey, err := loadPrivateKey(env)
 	if err != nil {
 		return "", err
@@ -16,15 +23,53 @@ func GenerateJWTToken(user model.User, env string) (string, error) {
 
 	claims := &model.Claims{
 		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: time.Now().Add(time.Hour * 24).Unix(),
+			ExpiresAt: expiresAt.Unix(),
 		},
-		Phone: user.Phone,
+		Phone:     user.Phone,
+		SessionID: sessionID,
 	}
 
+	return signToken(claims, privateKey)
+}
+
+// SignToken signs claims with our key, such as the tokens issued to OAuth
+// clients.
+func SignToken(claims jwt.Claims, env string) (string, error) {
+	privateKey, err := loadPrivateKey(env)
+	if err != nil {
+		return "", err
+	}
+	return signToken(claims, privateKey)
+}
+
+// signToken names the key in the kid header so that clients can pick it
+// from the JWKS.
+func signToken(claims jwt.Claims, privateKey *rsa.PrivateKey) (string, error) {
 	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = KeyID(&privateKey.PublicKey)
 	return token.SignedString(privateKey)
 }
 
+// SigningKey returns the public half of the key tokens are signed with.
+func SigningKey(env string) (*rsa.PublicKey, error) {
+	privateKey, err := loadPrivateKey(env)
+	if err != nil {
+		return nil, err
+	}
+	return &privateKey.PublicKey, nil
+}
+
+// KeyID returns the RFC 7638 thumbprint of key.
+func KeyID(key *rsa.PublicKey) string {
+	// The members are in lexicographic order without whitespace, as the
+	// thumbprint requires.
+	thumbprint := fmt.Sprintf(`{"e":"%s","kty":"RSA","n":"%s"}`,
+		base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		base64.RawURLEncoding.EncodeToString(key.N.Bytes()))
+	sum := sha256.Sum256([]byte(thumbprint))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
 func loadPrivateKey(env string) (*rsa.PrivateKey, error) {
 	if env == "unit_test" {
 		keyDer, err := os.ReadFile("../private.pem")
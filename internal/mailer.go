@@ -0,0 +1,27 @@
+package internal
+
+import (
+	"context"
+	"log"
+)
+
+type Mail struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers transactional emails such as address verifications.
+type Mailer interface {
+	Send(ctx context.Context, mail Mail) error
+}
+
+// LogMailer records that emails would have been sent instead of delivering
+// them. It is the default until a real provider is configured. The body is
+// left out, as it carries tokens such as the one verifying the address.
+type LogMailer struct{}
+
+func (LogMailer) Send(ctx context.Context, mail Mail) error {
+	log.Printf("mail to=%s subject=%q", mail.To, mail.Subject)
+	return nil
+}
@@ -0,0 +1,60 @@
+// Package passhash hashes passwords into self-describing strings in the PHC
+// string format, so the algorithm and parameters of a stored hash can be read
+// back to verify it and to tell whether it should be upgraded.
+package passhash
+
+import (
+	"errors"
+)
+
+// ErrUnknownFormat is returned for a hash no scheme recognizes.
+var ErrUnknownFormat = errors.New("passhash: unknown hash format")
+
+// Scheme is one hashing algorithm with its parameters.
+type Scheme interface {
+	// Recognizes reports whether encoded was produced by this algorithm.
+	Recognizes(encoded string) bool
+	Hash(password string) (string, error)
+	// Verify reports whether password matches encoded, which must be
+	// recognized by the scheme.
+	Verify(password, encoded string) (bool, error)
+	// Outdated reports whether encoded uses weaker or other parameters than
+	// the scheme's.
+	Outdated(encoded string) bool
+}
+
+// Hasher hashes with a preferred scheme and verifies hashes of any scheme it
+// knows.
+type Hasher struct {
+	preferred Scheme
+	schemes   []Scheme
+}
+
+// New returns a Hasher hashing with preferred and also accepting hashes of
+// legacy schemes.
+func New(preferred Scheme, legacy ...Scheme) *Hasher {
+	return &Hasher{
+		preferred: preferred,
+		schemes:   append([]Scheme{preferred}, legacy...),
+	}
+}
+
+func (h *Hasher) Hash(password string) (string, error) {
+	return h.preferred.Hash(password)
+}
+
+// Verify reports whether password matches encoded.
+func (h *Hasher) Verify(password, encoded string) (bool, error) {
+	for _, scheme := range h.schemes {
+		if scheme.Recognizes(encoded) {
+			return scheme.Verify(password, encoded)
+		}
+	}
+	return false, ErrUnknownFormat
+}
+
+// NeedsRehash reports whether encoded should be replaced by a hash from the
+// preferred scheme.
+func (h *Hasher) NeedsRehash(encoded string) bool {
+	return !h.preferred.Recognizes(encoded) || h.preferred.Outdated(encoded)
+}
@@ -0,0 +1,47 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+type SMS struct {
+	To   string
+	Body string
+}
+
+// SMSSender delivers text messages such as login codes.
+type SMSSender interface {
+	Send(ctx context.Context, sms SMS) error
+}
+
+// WebhookSMSSender posts text messages as {"to": ..., "body": ...} to URL,
+// where a gateway hands them to the SMS provider.
+type WebhookSMSSender struct {
+	URL    string
+	Client *http.Client
+}
+
+func (w WebhookSMSSender) Send(ctx context.Context, sms SMS) error {
+	payload, err := json.Marshal(map[string]string{"to": sms.To, "body": sms.Body})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := w.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("sms webhook answered %s", resp.Status)
+	}
+	return nil
+}
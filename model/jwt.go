@@ -1,8 +1,66 @@
 package model
 
-import "github.com/dgrijalva/jwt-go"
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+
+	"github.com/dgrijalva/jwt-go"
+)
 
 type Claims struct {
 	jwt.StandardClaims
 	Phone string `json:"phone"` // Add custom claims as needed
+	// SessionID names the session the token was issued for.
+	SessionID string `json:"sid,omitempty"`
+	// ClientID is set on tokens issued to OAuth clients, whose Subject is
+	// the user ID and Scope the space separated scopes granted.
+	ClientID string `json:"client_id,omitempty"`
+	Scope    string `json:"scope,omitempty"`
+	// UserID is the owner of the session, set once the middlewares found it
+	// live. It is not part of the token: users are known by their session,
+	// as their phone number may change hands.
+	UserID string `json:"-"`
+}
+
+// IDToken tells whether the token is an OpenID Connect ID token, which only
+// tells clients who logged in and is no access token. Only ID tokens name
+// an audience.
+func (c *Claims) IDToken() bool {
+	return c.Audience != ""
+}
+
+// SessionCookie is the cookie browsers carry their token in.
+const SessionCookie = "session"
+
+// Requests authenticated by SessionCookie that change state have to repeat
+// the value of CSRFCookie in CSRFHeader.
+const (
+	CSRFCookie = "csrf_token"
+	CSRFHeader = "X-CSRF-Token"
+)
+
+// CSRFToken returns the CSRF token of the session. It is derived from the
+// session with secret, so that a CSRF cookie planted by another site does
+// not match the session cookie.
+func CSRFToken(secret, sessionID string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(sessionID))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Scopes machine clients can be granted.
+const (
+	// ScopeUsersRead lets machine clients read the profile of any user.
+	ScopeUsersRead = "users:read"
+	// ScopeTokensIntrospect lets machine clients introspect tokens.
+	ScopeTokensIntrospect = "tokens:introspect"
+)
+
+// IDTokenClaims are the claims of OpenID Connect ID tokens.
+type IDTokenClaims struct {
+	jwt.StandardClaims
+	Nonce           string `json:"nonce,omitempty"`
+	AuthorizedParty string `json:"azp,omitempty"`
+	SessionID       string `json:"sid,omitempty"`
 }
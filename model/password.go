@@ -0,0 +1,189 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/SawitProRecruitment/UserService/internal/breached"
+	"github.com/SawitProRecruitment/UserService/internal/passhash"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// PasswordPolicy describes the passwords users may choose.
+type PasswordPolicy struct {
+	MinLength      int
+	MaxLength      int
+	RequireUpper   bool
+	RequireLower   bool
+	RequireDigit   bool
+	RequireSpecial bool
+	// DisallowName rejects passwords containing a word of three or more
+	// letters from the user's name.
+	DisallowName bool
+	// DisallowPhone rejects passwords containing the last six digits of the
+	// user's phone number.
+	DisallowPhone bool
+	// Breached, when set, rejects passwords found in a breached password list.
+	Breached breached.Source
+}
+
+// DefaultPasswordPolicy is the policy used until SetPasswordPolicy is called.
+var DefaultPasswordPolicy = PasswordPolicy{
+	MinLength:      6,
+	MaxLength:      64,
+	RequireUpper:   true,
+	RequireDigit:   true,
+	RequireSpecial: true,
+	DisallowName:   true,
+	DisallowPhone:  true,
+}
+
+// Check returns every rule password breaks for the user with the given name
+// and phone, as messages meant for the user. The error is only set when the
+// breached password list could not be read.
+func (p PasswordPolicy) Check(password, name, phone string) ([]string, error) {
+	var violations []string
+	length := utf8.RuneCountInString(password)
+	if length < p.MinLength {
+		violations = append(violations, fmt.Sprintf("must be at least %d characters", p.MinLength))
+	}
+	if p.MaxLength > 0 && length > p.MaxLength {
+		violations = append(violations, fmt.Sprintf("must be at most %d characters", p.MaxLength))
+	}
+
+	var hasUpper, hasLower, hasDigit, hasSpecial bool
+	for _, char := range password {
+		switch {
+		case unicode.IsDigit(char):
+			hasDigit = true
+		case unicode.IsUpper(char):
+			hasUpper = true
+		case unicode.IsLower(char):
+			hasLower = true
+		case unicode.IsPunct(char) || unicode.IsSymbol(char):
+			hasSpecial = true
+		}
+	}
+	for _, class := range []struct {
+		required, present bool
+		name              string
+	}{
+		{p.RequireUpper, hasUpper, "an uppercase letter"},
+		{p.RequireLower, hasLower, "a lowercase letter"},
+		{p.RequireDigit, hasDigit, "a number"},
+		{p.RequireSpecial, hasSpecial, "a special character"},
+	} {
+		if class.required && !class.present {
+			violations = append(violations, "must contain "+class.name)
+		}
+	}
+
+	lower := strings.ToLower(password)
+	if p.DisallowName {
+		for _, word := range strings.Fields(strings.ToLower(name)) {
+			if utf8.RuneCountInString(word) >= 3 && strings.Contains(lower, word) {
+				violations = append(violations, "must not contain your name")
+				break
+			}
+		}
+	}
+	if p.DisallowPhone {
+		digits := strings.TrimPrefix(phone, "+")
+		if len(digits) >= 6 && strings.Contains(password, digits[len(digits)-6:]) {
+			violations = append(violations, "must not contain your phone number")
+		}
+	}
+
+	if p.Breached != nil {
+		found, err := breached.Contains(p.Breached, password)
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			violations = append(violations, "has appeared in a data breach, choose another one")
+		}
+	}
+	return violations, nil
+}
+
+var (
+	passwordPolicyMu sync.RWMutex
+	passwordPolicy   = DefaultPasswordPolicy
+)
+
+// SetPasswordPolicy replaces the policy new passwords are checked against.
+func SetPasswordPolicy(policy PasswordPolicy) {
+	passwordPolicyMu.Lock()
+	defer passwordPolicyMu.Unlock()
+	passwordPolicy = policy
+}
+
+func currentPasswordPolicy() PasswordPolicy {
+	passwordPolicyMu.RLock()
+	defer passwordPolicyMu.RUnlock()
+	return passwordPolicy
+}
+
+var (
+	passwordHasherMu sync.RWMutex
+	passwordHasher   = passhash.New(passhash.DefaultArgon2id, passhash.Bcrypt{Cost: bcrypt.DefaultCost})
+	// dummyHash returns the hash made by passwordHasher that is verified for
+	// unknown users.
+	dummyHash = newDummyHash(passwordHasher)
+)
+
+// newDummyHash returns a function making a hash with hasher once.
+func newDummyHash(hasher *passhash.Hasher) func() (string, error) {
+	return sync.OnceValues(func() (string, error) {
+		return hasher.Hash(uuid.NewString())
+	})
+}
+
+// SetPasswordHasher replaces the hasher passwords are hashed and verified
+// with, argon2id accepting bcrypt hashes by default.
+func SetPasswordHasher(hasher *passhash.Hasher) error {
+	// The dummy hash is made up front so that logins of unknown users do
+	// not wait for it.
+	dummy := newDummyHash(hasher)
+	if _, err := dummy(); err != nil {
+		return err
+	}
+
+	passwordHasherMu.Lock()
+	defer passwordHasherMu.Unlock()
+	passwordHasher = hasher
+	dummyHash = dummy
+	return nil
+}
+
+// CheckUnknownLogin verifies password against a throwaway hash, taking as
+// long as checking the password of an existing user, and always returns
+// ErrPasswordMismatch. It keeps response times from telling which users
+// exist.
+func CheckUnknownLogin(password string) error {
+	passwordHasherMu.RLock()
+	hasher, dummy := passwordHasher, dummyHash
+	passwordHasherMu.RUnlock()
+
+	hash, err := dummy()
+	if err != nil {
+		return err
+	}
+	_, _ = hasher.Verify(password, hash)
+	return ErrPasswordMismatch
+}
+
+func currentPasswordHasher() *passhash.Hasher {
+	passwordHasherMu.RLock()
+	defer passwordHasherMu.RUnlock()
+	return passwordHasher
+}
+
+// HashPassword hashes password with the preferred scheme.
+func HashPassword(password string) (string, error) {
+	return currentPasswordHasher().Hash(password)
+}
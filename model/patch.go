@@ -0,0 +1,190 @@
+package model
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/SawitProRecruitment/UserService/repository"
+	"github.com/go-playground/validator/v10"
+)
+
+const MIMEMergePatchJSON = "application/merge-patch+json"
+
+// PatchField is a member of a JSON Merge Patch (RFC 7396) document. It tells
+// apart a member that is absent (Set is false), explicitly null (Null is
+// true) and one carrying a value.
+type PatchField[T any] struct {
+	Set   bool
+	Null  bool
+	Value T
+}
+
+func (f *PatchField[T]) UnmarshalJSON(data []byte) error {
+	f.Set = true
+	if string(data) == "null" {
+		f.Null = true
+		return nil
+	}
+	return json.Unmarshal(data, &f.Value)
+}
+
+// FieldErrors maps a JSON member name to the reason it was rejected.
+type FieldErrors map[string]string
+
+func (f FieldErrors) Error() string {
+	fields := make([]string, 0, len(f))
+	for field := range f {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	msgs := make([]string, 0, len(fields))
+	for _, field := range fields {
+		msgs = append(msgs, fmt.Sprintf("%s: %s", field, f[field]))
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// jsonFieldName names struct fields in validation errors after their JSON
+// member.
+func jsonFieldName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "" || name == "-" {
+		return field.Name
+	}
+	return name
+}
+
+// toFieldErrors turns validator errors into FieldErrors, leaving other errors
+// as they are.
+func toFieldErrors(err error) error {
+	var validationErrs validator.ValidationErrors
+	if !errors.As(err, &validationErrs) {
+		return err
+	}
+
+	errs := FieldErrors{}
+	for _, fe := range validationErrs {
+		if _, ok := errs[fe.Field()]; !ok {
+			errs[fe.Field()] = validationMessage(fe)
+		}
+	}
+	return errs
+}
+
+func fieldErrorMessage(err error) string {
+	var validationErrs validator.ValidationErrors
+	if !errors.As(err, &validationErrs) || len(validationErrs) == 0 {
+		return err.Error()
+	}
+	return validationMessage(validationErrs[0])
+}
+
+func validationMessage(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "min":
+		return fmt.Sprintf("must be at least %s characters", fe.Param())
+	case "max":
+		return fmt.Sprintf("must be at most %s characters", fe.Param())
+	case "phone_prefix":
+		return "must be a phone number from one of the accepted countries: " + currentPhoneNumbering().Countries()
+	case "email":
+		return "must be a valid email address"
+	case "http_url":
+		return "must be an http or https URL"
+	case "bcp47_language_tag":
+		return "must be a BCP 47 language tag such as id-ID"
+	case "timezone":
+		return "must be an IANA time zone such as Asia/Jakarta"
+	default:
+		return fmt.Sprintf("failed %s validation", fe.Tag())
+	}
+}
+
+type PatchUserReq struct {
+	Name      PatchField[string] `json:"name"`
+	Phone     PatchField[string] `json:"phone"`
+	Email     PatchField[string] `json:"email"`
+	AvatarURL PatchField[string] `json:"avatar_url"`
+	Locale    PatchField[string] `json:"locale"`
+	Timezone  PatchField[string] `json:"timezone"`
+}
+
+// Validate checks every member present in the patch and reports all invalid
+// members at once. Optional profile members may be null to remove them.
+func (p *PatchUserReq) Validate() error {
+	validate := validator.New()
+	registerCustomValidators(validate)
+
+	errs := FieldErrors{}
+	for _, member := range []struct {
+		name     string
+		field    PatchField[string]
+		nullable bool
+		validate interface{}
+	}{
+		{"name", p.Name, false, ValidateUpdateUserName{Name: p.Name.Value}},
+		{"phone", p.Phone, false, ValidateUpdateUserPhone{Phone: p.Phone.Value}},
+		{"email", p.Email, true, ValidateUpdateUserEmail{Email: strings.TrimSpace(p.Email.Value)}},
+		{"avatar_url", p.AvatarURL, true, ValidateUpdateUserAvatarURL{AvatarURL: p.AvatarURL.Value}},
+		{"locale", p.Locale, true, ValidateUpdateUserLocale{Locale: p.Locale.Value}},
+		{"timezone", p.Timezone, true, ValidateUpdateUserTimezone{Timezone: p.Timezone.Value}},
+	} {
+		switch {
+		case !member.field.Set:
+		case member.field.Null:
+			if !member.nullable {
+				errs[member.name] = "cannot be removed"
+			}
+		default:
+			if err := validate.Struct(member.validate); err != nil {
+				errs[member.name] = fieldErrorMessage(err)
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// Normalize rewrites the phone number into the form it is stored in.
+func (p *PatchUserReq) Normalize() {
+	if p.Phone.Set && !p.Phone.Null {
+		p.Phone.Value = NormalizePhone(p.Phone.Value)
+	}
+}
+
+// IsEmpty reports whether the patch leaves the user unchanged.
+func (p *PatchUserReq) IsEmpty() bool {
+	return !p.Name.Set && !p.Phone.Set && !p.Email.Set && !p.AvatarURL.Set && !p.Locale.Set && !p.Timezone.Set
+}
+
+func (p *PatchUserReq) ToDAO() repository.UpdateUser {
+	email := p.Email
+	email.Value = strings.TrimSpace(email.Value)
+	return repository.UpdateUser{
+		Name:      p.Name.Value,
+		Phone:     p.Phone.Value,
+		Email:     patchNullString(email),
+		AvatarURL: patchNullString(p.AvatarURL),
+		Locale:    patchNullString(p.Locale),
+		Timezone:  patchNullString(p.Timezone),
+	}
+}
+
+// patchNullString maps a merge patch member onto a nullable column update.
+func patchNullString(field PatchField[string]) *sql.NullString {
+	if !field.Set {
+		return nil
+	}
+	return &sql.NullString{String: field.Value, Valid: !field.Null}
+}
@@ -0,0 +1,191 @@
+package model
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// PhoneCountry describes the phone numbers of one country in the spirit of
+// libphonenumber metadata: the calling code and the lengths and pattern of
+// the national significant number, which is everything after the calling
+// code.
+type PhoneCountry struct {
+	Region      string `mapstructure:"region"`
+	Name        string `mapstructure:"name"`
+	CallingCode string `mapstructure:"calling_code"`
+	MinLength   int    `mapstructure:"min_length"`
+	MaxLength   int    `mapstructure:"max_length"`
+	Pattern     string `mapstructure:"pattern"`
+}
+
+// KnownPhoneCountries are the countries that can be allowed by region alone.
+var KnownPhoneCountries = map[string]PhoneCountry{
+	"AU": {Region: "AU", Name: "Australia", CallingCode: "61", MinLength: 9, MaxLength: 9, Pattern: `[2-478]\d{8}`},
+	"GB": {Region: "GB", Name: "United Kingdom", CallingCode: "44", MinLength: 9, MaxLength: 10, Pattern: `[1-9]\d{8,9}`},
+	"ID": {Region: "ID", Name: "Indonesia", CallingCode: "62", MinLength: 7, MaxLength: 12, Pattern: `[1-9]\d{6,11}`},
+	"IN": {Region: "IN", Name: "India", CallingCode: "91", MinLength: 10, MaxLength: 10, Pattern: `[1-9]\d{9}`},
+	"MY": {Region: "MY", Name: "Malaysia", CallingCode: "60", MinLength: 8, MaxLength: 10, Pattern: `1\d{8,9}|(?:3\d|[4-9])\d{7}`},
+	"PH": {Region: "PH", Name: "Philippines", CallingCode: "63", MinLength: 8, MaxLength: 10, Pattern: `[2-9]\d{7,9}`},
+	"SG": {Region: "SG", Name: "Singapore", CallingCode: "65", MinLength: 8, MaxLength: 8, Pattern: `[3689]\d{7}`},
+	"TH": {Region: "TH", Name: "Thailand", CallingCode: "66", MinLength: 8, MaxLength: 9, Pattern: `[689]\d{8}|[2-7]\d{7}`},
+	"US": {Region: "US", Name: "United States", CallingCode: "1", MinLength: 10, MaxLength: 10, Pattern: `[2-9]\d{2}[2-9]\d{6}`},
+	"VN": {Region: "VN", Name: "Vietnam", CallingCode: "84", MinLength: 9, MaxLength: 10, Pattern: `[1-9]\d{8,9}`},
+}
+
+type phoneRule struct {
+	PhoneCountry
+	pattern *regexp.Regexp
+}
+
+func (r phoneRule) matches(nsn string) bool {
+	return len(nsn) >= r.MinLength && len(nsn) <= r.MaxLength && r.pattern.MatchString(nsn)
+}
+
+// PhoneNumbering holds the countries phone numbers are accepted from.
+type PhoneNumbering struct {
+	rules []phoneRule
+	// national is the country a number written with a leading 0 belongs to.
+	national phoneRule
+}
+
+// NewPhoneNumbering allows the given regions, looked up in
+// KnownPhoneCountries unless described by one of custom. Numbers written in
+// national form, with a leading 0, are taken to be from defaultRegion.
+func NewPhoneNumbering(defaultRegion string, regions []string, custom ...PhoneCountry) (*PhoneNumbering, error) {
+	described := make(map[string]PhoneCountry, len(custom))
+	for _, country := range custom {
+		described[strings.ToUpper(country.Region)] = country
+	}
+
+	numbering := &PhoneNumbering{}
+	var hasDefault bool
+	for _, region := range regions {
+		region = strings.ToUpper(region)
+		country, ok := described[region]
+		if !ok {
+			country, ok = KnownPhoneCountries[region]
+		}
+		if !ok {
+			return nil, fmt.Errorf("phone: no numbering rules for region %q", region)
+		}
+		if country.CallingCode == "" || country.MinLength < 1 || country.MaxLength < country.MinLength {
+			return nil, fmt.Errorf("phone: incomplete numbering rules for region %q", region)
+		}
+
+		pattern := `\d+`
+		if country.Pattern != "" {
+			pattern = country.Pattern
+		}
+		compiled, err := regexp.Compile(`^(?:` + pattern + `)$`)
+		if err != nil {
+			return nil, fmt.Errorf("phone: pattern for region %q: %w", region, err)
+		}
+
+		country.Region = region
+		rule := phoneRule{PhoneCountry: country, pattern: compiled}
+		numbering.rules = append(numbering.rules, rule)
+		if region == strings.ToUpper(defaultRegion) {
+			numbering.national, hasDefault = rule, true
+		}
+	}
+	if !hasDefault {
+		return nil, fmt.Errorf("phone: default region %q is not allowed", defaultRegion)
+	}
+
+	sort.Slice(numbering.rules, func(i, j int) bool {
+		return numbering.rules[i].Name < numbering.rules[j].Name
+	})
+	return numbering, nil
+}
+
+// Normalize brings a phone number typed by a user into E.164 form: it drops
+// spaces and dashes and replaces a national leading 0 with the calling code
+// of the default region.
+func (n *PhoneNumbering) Normalize(phone string) string {
+	phone = strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) || r == '-' {
+			return -1
+		}
+		return r
+	}, phone)
+	if strings.HasPrefix(phone, "0") {
+		phone = "+" + n.national.CallingCode + phone[1:]
+	}
+	return phone
+}
+
+// Valid reports whether phone is an E.164 number of an allowed country.
+func (n *PhoneNumbering) Valid(phone string) bool {
+	digits, ok := strings.CutPrefix(phone, "+")
+	if !ok || strings.TrimFunc(digits, isASCIIDigit) != "" {
+		return false
+	}
+	for _, rule := range n.rules {
+		nsn, ok := strings.CutPrefix(digits, rule.CallingCode)
+		if ok && rule.matches(nsn) {
+			return true
+		}
+	}
+	return false
+}
+
+// Countries lists the accepted countries for error messages, such as
+// "Indonesia (+62), Malaysia (+60)".
+func (n *PhoneNumbering) Countries() string {
+	names := make([]string, 0, len(n.rules))
+	for _, rule := range n.rules {
+		names = append(names, fmt.Sprintf("%s (+%s)", rule.Name, rule.CallingCode))
+	}
+	return strings.Join(names, ", ")
+}
+
+func isASCIIDigit(r rune) bool {
+	return r >= '0' && r <= '9'
+}
+
+var (
+	phoneNumberingMu sync.RWMutex
+	phoneNumbering   = mustPhoneNumbering(NewPhoneNumbering("ID", []string{"ID"}))
+)
+
+func mustPhoneNumbering(numbering *PhoneNumbering, err error) *PhoneNumbering {
+	if err != nil {
+		panic(err)
+	}
+	return numbering
+}
+
+// SetPhoneNumbering replaces the countries phone numbers are accepted from,
+// Indonesia only by default.
+func SetPhoneNumbering(numbering *PhoneNumbering) {
+	phoneNumberingMu.Lock()
+	defer phoneNumberingMu.Unlock()
+	phoneNumbering = numbering
+}
+
+func currentPhoneNumbering() *PhoneNumbering {
+	phoneNumberingMu.RLock()
+	defer phoneNumberingMu.RUnlock()
+	return phoneNumbering
+}
+
+// NormalizePhone normalizes phone with the configured PhoneNumbering.
+func NormalizePhone(phone string) string {
+	return currentPhoneNumbering().Normalize(phone)
+}
+
+// ValidPhone reports whether phone, as returned by NormalizePhone, is a
+// number of an allowed country.
+func ValidPhone(phone string) bool {
+	return currentPhoneNumbering().Valid(phone)
+}
+
+func validatePhonePrefix(fl validator.FieldLevel) bool {
+	return currentPhoneNumbering().Valid(fl.Field().String())
+}
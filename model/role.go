@@ -0,0 +1,20 @@
+package model
+
+import "slices"
+
+// Roles of users, as told to the services in front of which the user
+// service authenticates requests.
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+// UserRoles returns the roles of the user; adminIDs are the configured
+// admins.
+func UserRoles(userID string, adminIDs []string) []string {
+	roles := []string{RoleUser}
+	if slices.Contains(adminIDs, userID) {
+		roles = append(roles, RoleAdmin)
+	}
+	return roles
+}
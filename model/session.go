@@ -0,0 +1,82 @@
+package model
+
+import (
+	"strings"
+	"time"
+
+	"github.com/SawitProRecruitment/UserService/repository"
+)
+
+type SessionResp struct {
+	ID         string    `json:"id"`
+	DeviceName string    `json:"device_name"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	// Current marks the session of the token the list was requested with.
+	Current bool `json:"current"`
+}
+
+func FromRepoSession(session repository.Session, currentID string) SessionResp {
+	return SessionResp{
+		ID:         session.SessionID,
+		DeviceName: session.DeviceName,
+		UserAgent:  session.UserAgent,
+		IP:         session.IP,
+		CreatedAt:  session.CreatedAt,
+		LastSeenAt: session.LastSeenAt,
+		Current:    session.SessionID == currentID,
+	}
+}
+
+// The first matching token wins, so more specific ones come first: Android
+// and ChromeOS user agents also mention Linux, and most browsers claim to be
+// Safari.
+var (
+	devicePlatforms = []struct{ token, name string }{
+		{"iPhone", "iPhone"},
+		{"iPad", "iPad"},
+		{"Android", "Android"},
+		{"CrOS", "ChromeOS"},
+		{"Windows", "Windows"},
+		{"Mac OS X", "macOS"},
+		{"Linux", "Linux"},
+	}
+	deviceClients = []struct{ token, name string }{
+		{"Edg/", "Edge"},
+		{"OPR/", "Opera"},
+		{"Firefox/", "Firefox"},
+		{"Chrome/", "Chrome"},
+		{"Safari/", "Safari"},
+		{"curl/", "curl"},
+	}
+)
+
+// DescribeDevice names a device after its user agent, e.g. "Chrome on
+// Windows", for sessions logged in without a device name. It returns an empty
+// string for user agents it does not recognize.
+func DescribeDevice(userAgent string) string {
+	var platform, client string
+	for _, p := range devicePlatforms {
+		if strings.Contains(userAgent, p.token) {
+			platform = p.name
+			break
+		}
+	}
+	for _, c := range deviceClients {
+		if strings.Contains(userAgent, c.token) {
+			client = c.name
+			break
+		}
+	}
+
+	switch {
+	case platform != "" && client != "":
+		return client + " on " + platform
+	case platform != "":
+		return platform
+	default:
+		return client
+	}
+}
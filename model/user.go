@@ -1,69 +1,69 @@
 package model
 
 import (
+	"database/sql"
 	"errors"
 	"github.com/SawitProRecruitment/UserService/repository"
 	"github.com/go-playground/validator/v10"
 	"github.com/google/uuid"
-	"golang.org/x/crypto/bcrypt"
 	"strings"
 	"time"
-	"unicode"
 )
 
+var ErrPasswordMismatch = errors.New("password does not match")
+
 type RegisterUserReq struct {
-	Phone    string `json:"phone" validate:"required,min=10,max=13,phone_prefix=+62"`
+	Phone    string `json:"phone" validate:"required,phone_prefix"`
 	Name     string `json:"name" validate:"required,min=3,max=60"`
-	Password string `json:"password" validate:"required,min=6,max=64,password"`
-}
-
-func validatePhonePrefix(fl validator.FieldLevel) bool {
-	phone := fl.Field().String()
-	return strings.HasPrefix(phone, "+62")
+	Password string `json:"password" validate:"required"`
 }
 
 func registerCustomValidators(validate *validator.Validate) {
+	validate.RegisterTagNameFunc(jsonFieldName)
 	err := validate.RegisterValidation("phone_prefix", validatePhonePrefix)
 	if err != nil {
 		return
 	}
-	err = validate.RegisterValidation("password", validatePassword)
-	if err != nil {
-		return
-	}
 }
 
-func validatePassword(fl validator.FieldLevel) bool {
-	password := fl.Field().String()
-
-	var (
-		hasSpecialChar bool
-		hasCapital     bool
-		hasNumeric     bool
-	)
-
-	for _, char := range password {
-		switch {
-		case unicode.IsDigit(char):
-			hasNumeric = true
-		case unicode.IsUpper(char):
-			hasCapital = true
-		case unicode.IsPunct(char) || unicode.IsSymbol(char):
-			hasSpecialChar = true
-		}
-	}
-
-	return hasSpecialChar && hasCapital && hasNumeric
+// Normalize rewrites the phone number into the form it is stored in.
+func (r *RegisterUserReq) Normalize() {
+	r.Phone = NormalizePhone(r.Phone)
 }
 
+// Validate returns FieldErrors for invalid members, including every password
+// policy rule the password breaks, or another error when the policy could
+// not be checked.
 func (r *RegisterUserReq) Validate() error {
 	validate := validator.New()
 	registerCustomValidators(validate)
-	return validate.Struct(r)
+	err := toFieldErrors(validate.Struct(r))
+	errs, ok := err.(FieldErrors)
+	if err != nil && !ok {
+		return err
+	}
+	if errs == nil {
+		errs = FieldErrors{}
+	}
+
+	if _, invalid := errs["password"]; !invalid {
+		violations, err := currentPasswordPolicy().Check(r.Password, r.Name, r.Phone)
+		if err != nil {
+			return err
+		}
+		if len(violations) > 0 {
+			errs["password"] = strings.Join(violations, ", ")
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
 }
 
 func (r *RegisterUserReq) ToDAO() (repository.RegisterUser, error) {
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(r.Password), bcrypt.DefaultCost)
+	hashedPassword, err := HashPassword(r.Password)
 	if err != nil {
 		return repository.RegisterUser{}, err
 	}
@@ -71,74 +71,178 @@ func (r *RegisterUserReq) ToDAO() (repository.RegisterUser, error) {
 		ID:       uuid.New().String(),
 		Phone:    r.Phone,
 		Name:     r.Name,
-		Password: string(hashedPassword),
+		Password: hashedPassword,
 	}, nil
 }
 
 type User struct {
-	UserID    string    `json:"userID" db:"id"`
-	Phone     string    `json:"phone" db:"phone"`
-	Name      string    `json:"name" db:"name"`
-	Password  string    `json:"password" db:"password"`
-	CreatedAt time.Time `json:"createdAt" db:"created_at"`
-	UpdatedAt time.Time `json:"updatedAt" db:"updated_at"`
+	UserID          string    `json:"userID" db:"id"`
+	Phone           string    `json:"phone" db:"phone"`
+	Name            string    `json:"name" db:"name"`
+	Password        string    `json:"password" db:"password"`
+	Email           string    `json:"email" db:"email"`
+	EmailVerifiedAt time.Time `json:"emailVerifiedAt" db:"email_verified_at"`
+	AvatarURL       string    `json:"avatarUrl" db:"avatar_url"`
+	Locale          string    `json:"locale" db:"locale"`
+	Timezone        string    `json:"timezone" db:"timezone"`
+	LastLoginAt     time.Time `json:"lastLoginAt" db:"last_login_at"`
+	Version         int64     `json:"version" db:"version"`
+	CreatedAt       time.Time `json:"createdAt" db:"created_at"`
+	UpdatedAt       time.Time `json:"updatedAt" db:"updated_at"`
 }
 
 func (u *User) CheckLogin(password string) error {
-	if err := bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(password)); err != nil {
-		return errors.New("password does not match")
+	ok, err := currentPasswordHasher().Verify(password, u.Password)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrPasswordMismatch
 	}
 	return nil
 }
 
+// PasswordOutdated reports whether the stored password hash should be
+// replaced by one from the preferred hashing scheme.
+func (u *User) PasswordOutdated() bool {
+	return currentPasswordHasher().NeedsRehash(u.Password)
+}
+
 func (u *User) ToProfileResp() GetProfileResp {
-	return GetProfileResp{
-		Name:  u.Name,
-		Phone: u.Phone,
+	resp := GetProfileResp{
+		Name:          u.Name,
+		Phone:         u.Phone,
+		Email:         optionalString(u.Email),
+		EmailVerified: u.Email != "" && !u.EmailVerifiedAt.IsZero(),
+		AvatarURL:     optionalString(u.AvatarURL),
+		Locale:        optionalString(u.Locale),
+		Timezone:      optionalString(u.Timezone),
+	}
+	if !u.LastLoginAt.IsZero() {
+		resp.LastLoginAt = &u.LastLoginAt
 	}
+	return resp
+}
+
+func optionalString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
 }
 
 type LoginRequest struct {
-	Phone    string `json:"phone"`
+	// Identifier is either the phone number or the email of the user.
+	Identifier string `json:"identifier"`
+	// Phone is still accepted from clients predating Identifier.
+	Phone    string `json:"phone,omitempty"`
 	Password string `json:"password"`
+	// DeviceName is shown in the session list, defaulting to a name derived
+	// from the user agent.
+	DeviceName string `json:"device_name,omitempty"`
+}
+
+// Lookup tells how the user logging in should be looked up: by email when the
+// identifier looks like one, otherwise by its normalized phone number.
+func (r *LoginRequest) Lookup() (phone, email string) {
+	identifier := strings.TrimSpace(r.Identifier)
+	if identifier == "" {
+		identifier = strings.TrimSpace(r.Phone)
+	}
+	if strings.Contains(identifier, "@") {
+		return "", identifier
+	}
+	return NormalizePhone(identifier), ""
 }
 
 func FromRepoUser(repoUser repository.User) User {
 	return User{
-		UserID:    repoUser.UserID,
-		Phone:     repoUser.Phone,
-		Name:      repoUser.Name,
-		Password:  repoUser.Password,
-		CreatedAt: repoUser.CreatedAt,
-		UpdatedAt: repoUser.UpdatedAt.Time,
+		UserID:          repoUser.UserID,
+		Phone:           repoUser.Phone,
+		Name:            repoUser.Name,
+		Password:        repoUser.Password,
+		Email:           repoUser.Email.String,
+		EmailVerifiedAt: repoUser.EmailVerifiedAt.Time,
+		AvatarURL:       repoUser.AvatarURL.String,
+		Locale:          repoUser.Locale.String,
+		Timezone:        repoUser.Timezone.String,
+		LastLoginAt:     repoUser.LastLoginAt.Time,
+		Version:         repoUser.Version,
+		CreatedAt:       repoUser.CreatedAt,
+		UpdatedAt:       repoUser.UpdatedAt.Time,
 	}
 }
 
 type GetProfileResp struct {
-	Name  string `json:"name"`
-	Phone string `json:"phone"`
+	Name          string     `json:"name"`
+	Phone         string     `json:"phone"`
+	Email         *string    `json:"email"`
+	EmailVerified bool       `json:"email_verified"`
+	AvatarURL     *string    `json:"avatar_url"`
+	Locale        *string    `json:"locale"`
+	Timezone      *string    `json:"timezone"`
+	LastLoginAt   *time.Time `json:"last_login_at"`
 }
 
 type UpdateUserReq struct {
-	Phone string `json:"phone,omitempty"`
-	Name  string `json:"name,omitempty"`
+	Phone     string `json:"phone,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Email     string `json:"email,omitempty"`
+	AvatarURL string `json:"avatar_url,omitempty"`
+	Locale    string `json:"locale,omitempty"`
+	Timezone  string `json:"timezone,omitempty"`
 }
 
 type ValidateUpdateUserPhone struct {
-	Phone string `json:"phone" validate:"required,min=10,max=13,phone_prefix=+62"`
+	Phone string `json:"phone" validate:"required,phone_prefix"`
 }
 
 type ValidateUpdateUserName struct {
 	Name string `json:"name" validate:"required,min=3,max=60"`
 }
 
+type ValidateUpdateUserEmail struct {
+	Email string `json:"email" validate:"required,max=254,email"`
+}
+
+type ValidateUpdateUserAvatarURL struct {
+	AvatarURL string `json:"avatar_url" validate:"required,max=2048,http_url"`
+}
+
+type ValidateUpdateUserLocale struct {
+	Locale string `json:"locale" validate:"required,bcp47_language_tag"`
+}
+
+type ValidateUpdateUserTimezone struct {
+	Timezone string `json:"timezone" validate:"required,timezone"`
+}
+
+// Normalize rewrites the phone number into the form it is stored in.
+func (u *UpdateUserReq) Normalize() {
+	if u.Phone != "" {
+		u.Phone = NormalizePhone(u.Phone)
+	}
+}
+
 func (u *UpdateUserReq) ToDAO() repository.UpdateUser {
 	return repository.UpdateUser{
-		Phone: u.Phone,
-		Name:  u.Name,
+		Phone:     u.Phone,
+		Name:      u.Name,
+		Email:     setNullString(strings.TrimSpace(u.Email)),
+		AvatarURL: setNullString(u.AvatarURL),
+		Locale:    setNullString(u.Locale),
+		Timezone:  setNullString(u.Timezone),
 	}
 }
 
+// setNullString returns nil, leaving the column unchanged, for an empty value.
+func setNullString(value string) *sql.NullString {
+	if value == "" {
+		return nil
+	}
+	return &sql.NullString{String: value, Valid: true}
+}
+
 func (u *UpdateUserReq) Validate() error {
 	validate := validator.New()
 	registerCustomValidators(validate)
@@ -159,9 +263,26 @@ func (u *UpdateUserReq) Validate() error {
 			return err
 		}
 	}
+	for _, optional := range []struct {
+		value    string
+		validate interface{}
+	}{
+		{u.Email, ValidateUpdateUserEmail{Email: strings.TrimSpace(u.Email)}},
+		{u.AvatarURL, ValidateUpdateUserAvatarURL{AvatarURL: u.AvatarURL}},
+		{u.Locale, ValidateUpdateUserLocale{Locale: u.Locale}},
+		{u.Timezone, ValidateUpdateUserTimezone{Timezone: u.Timezone}},
+	} {
+		if optional.value == "" {
+			continue
+		}
+		eitherExists = true
+		if err := validate.Struct(optional.validate); err != nil {
+			return err
+		}
+	}
 
 	if !eitherExists {
-		return errors.New("phone or name should exists")
+		return errors.New("at least one profile field should exists")
 	}
 	return nil
 }
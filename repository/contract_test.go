@@ -0,0 +1,81 @@
+package repository_test
+
+import (
+	"database/sql"
+	"os"
+	"testing"
+
+	"github.com/SawitProRecruitment/UserService/repository"
+	"github.com/SawitProRecruitment/UserService/repository/repotest"
+)
+
+func TestMemoryRepositoryContract(t *testing.T) {
+	repotest.RunContract(t, func(t *testing.T) repository.RepositoryInterface {
+		return repository.NewMemoryRepository()
+	})
+}
+
+// The Postgres implementations run the same contract when TEST_DATABASE_URL
+// points to a disposable database. The schema from database.sql is applied
+// once and the tables are truncated before every case.
+func postgresTestDsn(t *testing.T) string {
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" || testing.Short() {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+
+	schema, err := os.ReadFile("../database.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err = db.Exec(string(schema)); err != nil {
+		t.Fatal(err)
+	}
+	return dsn
+}
+
+func truncate(t *testing.T, dsn string) {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err = db.Exec("TRUNCATE users CASCADE"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRepositoryContract(t *testing.T) {
+	dsn := postgresTestDsn(t)
+	repotest.RunContract(t, func(t *testing.T) repository.RepositoryInterface {
+		truncate(t, dsn)
+		repo, err := repository.NewRepository(repository.NewRepositoryOptions{Dsn: dsn})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			_ = repo.Close()
+		})
+		return repo
+	})
+}
+
+func TestPgxRepositoryContract(t *testing.T) {
+	dsn := postgresTestDsn(t)
+	repotest.RunContract(t, func(t *testing.T) repository.RepositoryInterface {
+		truncate(t, dsn)
+		repo, err := repository.NewPgxRepository(repository.NewRepositoryOptions{Dsn: dsn})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			_ = repo.Close()
+		})
+		return repo
+	})
+}
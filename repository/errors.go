@@ -0,0 +1,64 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/lib/pq"
+)
+
+var (
+	ErrUserNotFound = errors.New("user not exists")
+	// ErrConflict is returned when a write violates a unique constraint,
+	// e.g. registering or updating to a phone that is already taken.
+	ErrConflict = errors.New("already exists")
+	// ErrVersionConflict is returned when a conditional update targets a
+	// version that is no longer current.
+	ErrVersionConflict = errors.New("version mismatch")
+	// ErrVerificationNotFound is returned for unknown, expired or already
+	// used email verification tokens.
+	ErrVerificationNotFound = errors.New("verification not found or expired")
+	// ErrMFANotFound is returned when there is no matching TOTP enrollment,
+	// usable time step, unused recovery code or live MFA challenge.
+	ErrMFANotFound = errors.New("mfa not found or expired")
+	// ErrSessionNotFound is returned for unknown, revoked or expired sessions.
+	ErrSessionNotFound = errors.New("session not found, revoked or expired")
+	// ErrPasskeyNotFound is returned for unknown passkeys and for unknown or
+	// expired WebAuthn challenges.
+	ErrPasskeyNotFound = errors.New("passkey not found or expired")
+	// ErrOTPNotFound is returned when a phone has no live login code left to
+	// try.
+	ErrOTPNotFound = errors.New("otp not found or expired")
+	// ErrOAuthNotFound is returned for unknown OAuth and machine clients,
+	// unknown, used or expired authorization codes and missing consents.
+	ErrOAuthNotFound = errors.New("oauth client, code or consent not found or expired")
+)
+
+const pgUniqueViolation = "23505"
+
+// pgErrorCode returns the SQLSTATE of err for both the lib/pq and pgx drivers.
+func pgErrorCode(err error) string {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return string(pqErr.Code)
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code
+	}
+	return ""
+}
+
+// mapError wraps driver errors with the matching repository sentinel while
+// keeping the original error in the chain.
+func mapError(err error) error {
+	if err == nil {
+		return nil
+	}
+	switch pgErrorCode(err) {
+	case pgUniqueViolation:
+		return fmt.Errorf("%w: %w", ErrConflict, err)
+	}
+	return err
+}
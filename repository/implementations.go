@@ -4,23 +4,39 @@ import (
 	"context"
 	"database/sql"
 	"errors"
-	"fmt"
-	"strings"
 	"time"
+
+	"github.com/lib/pq"
 )
 
 func (r *Repository) GetTestById(ctx context.Context, input GetTestByIdInput) (output GetTestByIdOutput, err error) {
-	err = r.Db.QueryRowContext(ctx, "SELECT name FROM test WHERE id = $1", input.Id).Scan(&output.Name)
+	ctx, span := startSpan(ctx, "repository.GetTestById", "SELECT name FROM test WHERE id = $1")
+	defer func() { endSpan(span, err) }()
+
+	var row *sql.Row
+	if r.tx != nil {
+		row = r.tx.QueryRowContext(ctx, "SELECT name FROM test WHERE id = $1", input.Id)
+	} else {
+		row = r.Db.QueryRowContext(ctx, "SELECT name FROM test WHERE id = $1", input.Id)
+	}
+	err = row.Scan(&output.Name)
 	if err != nil {
 		return
 	}
 	return
 }
 
-func (r *Repository) RegisterUser(ctx context.Context, input RegisterUser) (string, error) {
-	res, err := r.Db.ExecContext(ctx, qInsertUser, input.ID, input.Phone, input.Name, input.Password)
+func (r *Repository) RegisterUser(ctx context.Context, input RegisterUser) (id string, err error) {
+	ctx, span := startSpan(ctx, "repository.RegisterUser", qInsertUser)
+	defer func() { endSpan(span, err) }()
+
+	var res sql.Result
+	err = r.withStmt(ctx, qInsertUser, func(stmt *sql.Stmt) error {
+		res, err = stmt.ExecContext(ctx, input.ID, input.Phone, input.Name, input.Password)
+		return err
+	})
 	if err != nil {
-		return "", err
+		return "", mapError(err)
 	}
 
 	if count, _ := res.RowsAffected(); count < 1 {
@@ -30,87 +46,595 @@ func (r *Repository) RegisterUser(ctx context.Context, input RegisterUser) (stri
 	return input.ID, nil
 }
 
-func (r *Repository) GetUserByPhone(ctx context.Context, phone string) (User, error) {
-	var user User
-	stmt, err := r.Db.PrepareContext(ctx, qGetUserByPhone)
+func (r *Repository) GetUserByPhone(ctx context.Context, phone string) (user User, err error) {
+	ctx, span := startSpan(ctx, "repository.GetUserByPhone", qGetUserByPhone)
+	defer func() { endSpan(span, err) }()
+
+	err = r.withStmt(ctx, qGetUserByPhone, func(stmt *sql.Stmt) error {
+		user, err = scanUser(stmt.QueryRowContext(ctx, phone))
+		return err
+	})
 	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return User{}, ErrUserNotFound
+		}
 		return User{}, err
 	}
-	defer stmt.Close()
+	return user, err
+}
+
+func (r *Repository) GetUserByEmail(ctx context.Context, email string) (user User, err error) {
+	ctx, span := startSpan(ctx, "repository.GetUserByEmail", qGetUserByEmail)
+	defer func() { endSpan(span, err) }()
 
-	err = stmt.QueryRow(phone).
-		Scan(&user.UserID, &user.Phone, &user.Name, &user.Password, &user.CreatedAt, &user.UpdatedAt)
+	err = r.withStmt(ctx, qGetUserByEmail, func(stmt *sql.Stmt) error {
+		user, err = scanUser(stmt.QueryRowContext(ctx, email))
+		return err
+	})
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return User{}, errors.New("user not exists")
+			return User{}, ErrUserNotFound
 		}
 		return User{}, err
 	}
 	return user, err
 }
 
-func (r *Repository) IncrSuccessLogin(ctx context.Context, phone string) error {
-	tx, err := r.Db.BeginTx(ctx, nil)
+func (r *Repository) IncrSuccessLogin(ctx context.Context, phone string) (err error) {
+	ctx, span := startSpan(ctx, "repository.IncrSuccessLogin", qIncrementLoginCount)
+	defer func() { endSpan(span, err) }()
+
+	return r.execInTx(ctx, func(tx *sql.Tx) error {
+		stmt, err := r.stmts.get(ctx, qIncrementLoginCount)
+		if err != nil {
+			return err
+		}
+
+		res, err := tx.StmtContext(ctx, stmt).ExecContext(ctx, phone)
+		if err != nil {
+			return err
+		}
+
+		if affected, _ := res.RowsAffected(); affected < 1 {
+			return errors.New("login tracking failed")
+		}
+		return nil
+	})
+}
+
+func (r *Repository) UpdateUser(ctx context.Context, input UpdateUser, identifier string) (err error) {
+	query, args := buildUpdateUserQuery(input, identifier)
+
+	ctx, span := startSpan(ctx, "repository.UpdateUser", query)
+	defer func() { endSpan(span, err) }()
+
+	return r.execInTx(ctx, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, query, args...)
+		if err != nil {
+			return mapError(err)
+		}
+
+		if affected, _ := res.RowsAffected(); affected < 1 {
+			var exists bool
+			if input.Version > 0 {
+				if err = tx.QueryRowContext(ctx, qUserExists, identifier).Scan(&exists); err != nil {
+					return err
+				}
+			}
+			if exists {
+				return ErrVersionConflict
+			}
+			return errors.New("update user error")
+		}
+		return nil
+	})
+}
+
+func (r *Repository) UpdatePassword(ctx context.Context, phone, password string) (err error) {
+	ctx, span := startSpan(ctx, "repository.UpdatePassword", qUpdatePassword)
+	defer func() { endSpan(span, err) }()
+
+	var res sql.Result
+	err = r.withStmt(ctx, qUpdatePassword, func(stmt *sql.Stmt) error {
+		res, err = stmt.ExecContext(ctx, phone, password)
+		return err
+	})
 	if err != nil {
 		return err
 	}
-	defer func() {
-		_ = tx.Rollback()
-	}()
+	if affected, _ := res.RowsAffected(); affected < 1 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+func (r *Repository) CreateEmailVerification(ctx context.Context, input EmailVerification) (err error) {
+	ctx, span := startSpan(ctx, "repository.CreateEmailVerification", qUpsertEmailVerification)
+	defer func() { endSpan(span, err) }()
 
-	res, err := tx.ExecContext(ctx, qIncrementLoginCount, phone)
+	return r.withStmt(ctx, qUpsertEmailVerification, func(stmt *sql.Stmt) error {
+		_, err := stmt.ExecContext(ctx, input.UserID, input.Email, input.TokenHash, input.ExpiresAt)
+		return err
+	})
+}
+
+func (r *Repository) ConfirmEmailVerification(ctx context.Context, tokenHash string) (userID string, err error) {
+	ctx, span := startSpan(ctx, "repository.ConfirmEmailVerification", qConfirmEmailVerification)
+	defer func() { endSpan(span, err) }()
+
+	err = r.withStmt(ctx, qConfirmEmailVerification, func(stmt *sql.Stmt) error {
+		return stmt.QueryRowContext(ctx, tokenHash).Scan(&userID)
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrVerificationNotFound
+	}
+	return userID, err
+}
+
+func (r *Repository) GetUserByID(ctx context.Context, id string) (user User, err error) {
+	ctx, span := startSpan(ctx, "repository.GetUserByID", qGetUserByID)
+	defer func() { endSpan(span, err) }()
+
+	err = r.withStmt(ctx, qGetUserByID, func(stmt *sql.Stmt) error {
+		user, err = scanUser(stmt.QueryRowContext(ctx, id))
+		return err
+	})
 	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return User{}, ErrUserNotFound
+		}
+		return User{}, err
+	}
+	return user, nil
+}
+
+func (r *Repository) SaveTOTP(ctx context.Context, userID, secret string) (err error) {
+	ctx, span := startSpan(ctx, "repository.SaveTOTP", qSaveTOTP)
+	defer func() { endSpan(span, err) }()
+
+	return r.execAffectingOne(ctx, qSaveTOTP, ErrConflict, userID, secret)
+}
+
+func (r *Repository) GetTOTP(ctx context.Context, userID string) (totp TOTP, err error) {
+	ctx, span := startSpan(ctx, "repository.GetTOTP", qGetTOTP)
+	defer func() { endSpan(span, err) }()
+
+	err = r.withStmt(ctx, qGetTOTP, func(stmt *sql.Stmt) error {
+		return stmt.QueryRowContext(ctx, userID).Scan(&totp.UserID, &totp.Secret, &totp.ConfirmedAt, &totp.LastUsedStep)
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return TOTP{}, ErrMFANotFound
+	}
+	return totp, err
+}
+
+func (r *Repository) ConfirmTOTP(ctx context.Context, userID string, step int64, recoveryCodeHashes []string) (err error) {
+	ctx, span := startSpan(ctx, "repository.ConfirmTOTP", qConfirmTOTP)
+	defer func() { endSpan(span, err) }()
+
+	return r.execInTx(ctx, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, qConfirmTOTP, userID, step)
+		if err != nil {
+			return err
+		}
+		if affected, _ := res.RowsAffected(); affected < 1 {
+			return ErrMFANotFound
+		}
+
+		if _, err = tx.ExecContext(ctx, qDeleteRecoveryCodes, userID); err != nil {
+			return err
+		}
+		for _, hash := range recoveryCodeHashes {
+			if _, err = tx.ExecContext(ctx, qInsertRecoveryCode, userID, hash); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (r *Repository) UseTOTPStep(ctx context.Context, userID string, step int64) (err error) {
+	ctx, span := startSpan(ctx, "repository.UseTOTPStep", qUseTOTPStep)
+	defer func() { endSpan(span, err) }()
+
+	return r.execAffectingOne(ctx, qUseTOTPStep, ErrMFANotFound, userID, step)
+}
+
+func (r *Repository) UseRecoveryCode(ctx context.Context, userID, codeHash string) (err error) {
+	ctx, span := startSpan(ctx, "repository.UseRecoveryCode", qUseRecoveryCode)
+	defer func() { endSpan(span, err) }()
+
+	return r.execAffectingOne(ctx, qUseRecoveryCode, ErrMFANotFound, userID, codeHash)
+}
+
+func (r *Repository) CreateMFAChallenge(ctx context.Context, input MFAChallenge) (err error) {
+	ctx, span := startSpan(ctx, "repository.CreateMFAChallenge", qInsertMFAChallenge)
+	defer func() { endSpan(span, err) }()
+
+	return r.withStmt(ctx, qInsertMFAChallenge, func(stmt *sql.Stmt) error {
+		_, err := stmt.ExecContext(ctx, input.TokenHash, input.UserID, input.ExpiresAt)
 		return err
+	})
+}
+
+func (r *Repository) RecordMFAAttempt(ctx context.Context, tokenHash string, maxAttempts int) (userID string, err error) {
+	ctx, span := startSpan(ctx, "repository.RecordMFAAttempt", qRecordMFAAttempt)
+	defer func() { endSpan(span, err) }()
+
+	err = r.withStmt(ctx, qRecordMFAAttempt, func(stmt *sql.Stmt) error {
+		return stmt.QueryRowContext(ctx, tokenHash, maxAttempts).Scan(&userID)
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrMFANotFound
 	}
+	return userID, err
+}
 
-	if affected, _ := res.RowsAffected(); affected < 1 {
-		return errors.New("login tracking failed")
+func (r *Repository) DeleteMFAChallenge(ctx context.Context, tokenHash string) (err error) {
+	ctx, span := startSpan(ctx, "repository.DeleteMFAChallenge", qDeleteMFAChallenge)
+	defer func() { endSpan(span, err) }()
+
+	return r.withStmt(ctx, qDeleteMFAChallenge, func(stmt *sql.Stmt) error {
+		_, err := stmt.ExecContext(ctx, tokenHash)
+		return err
+	})
+}
+
+func (r *Repository) CreateWebAuthnChallenge(ctx context.Context, input WebAuthnChallenge) (err error) {
+	ctx, span := startSpan(ctx, "repository.CreateWebAuthnChallenge", qInsertWebAuthnChallenge)
+	defer func() { endSpan(span, err) }()
+
+	return r.withStmt(ctx, qInsertWebAuthnChallenge, func(stmt *sql.Stmt) error {
+		_, err := stmt.ExecContext(ctx, input.Challenge, input.Ceremony, input.UserID, input.SessionData, input.ExpiresAt)
+		return err
+	})
+}
+
+func (r *Repository) ConsumeWebAuthnChallenge(ctx context.Context, challenge, ceremony string) (output WebAuthnChallenge, err error) {
+	ctx, span := startSpan(ctx, "repository.ConsumeWebAuthnChallenge", qConsumeWebAuthnChallenge)
+	defer func() { endSpan(span, err) }()
+
+	err = r.withStmt(ctx, qConsumeWebAuthnChallenge, func(stmt *sql.Stmt) error {
+		return stmt.QueryRowContext(ctx, challenge, ceremony).
+			Scan(&output.Challenge, &output.Ceremony, &output.UserID, &output.SessionData, &output.ExpiresAt)
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return WebAuthnChallenge{}, ErrPasskeyNotFound
 	}
+	return output, err
+}
+
+func (r *Repository) CreatePasskey(ctx context.Context, input Passkey) (err error) {
+	ctx, span := startSpan(ctx, "repository.CreatePasskey", qInsertPasskey)
+	defer func() { endSpan(span, err) }()
 
-	return tx.Commit()
+	err = r.withStmt(ctx, qInsertPasskey, func(stmt *sql.Stmt) error {
+		_, err := stmt.ExecContext(ctx, input.CredentialID, input.UserID, input.PublicKey, input.AttestationType,
+			pq.Array(stringArray(input.Transports)), input.AAGUID, input.SignCount,
+			input.BackupEligible, input.BackupState)
+		return err
+	})
+	return mapError(err)
 }
 
-func (r *Repository) UpdateUser(ctx context.Context, input UpdateUser, identifier string) error {
-	tx, err := r.Db.BeginTx(ctx, nil)
+func (r *Repository) ListPasskeys(ctx context.Context, userID string) (passkeys []Passkey, err error) {
+	ctx, span := startSpan(ctx, "repository.ListPasskeys", qListPasskeys)
+	defer func() { endSpan(span, err) }()
+
+	err = r.withStmt(ctx, qListPasskeys, func(stmt *sql.Stmt) error {
+		rows, err := stmt.QueryContext(ctx, userID)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			passkey, err := scanPasskey(rows, func(dest any) any { return pq.Array(dest) })
+			if err != nil {
+				return err
+			}
+			passkeys = append(passkeys, passkey)
+		}
+		return rows.Err()
+	})
 	if err != nil {
+		return nil, err
+	}
+	return passkeys, nil
+}
+
+func (r *Repository) UpdatePasskeyUse(ctx context.Context, input Passkey) (err error) {
+	ctx, span := startSpan(ctx, "repository.UpdatePasskeyUse", qUpdatePasskeyUse)
+	defer func() { endSpan(span, err) }()
+
+	return r.execAffectingOne(ctx, qUpdatePasskeyUse, ErrPasskeyNotFound,
+		input.CredentialID, input.SignCount, input.BackupState, input.CloneWarning)
+}
+
+func (r *Repository) CreateLoginOTP(ctx context.Context, input LoginOTP) (err error) {
+	ctx, span := startSpan(ctx, "repository.CreateLoginOTP", qInsertLoginOTP)
+	defer func() { endSpan(span, err) }()
+
+	return r.withStmt(ctx, qInsertLoginOTP, func(stmt *sql.Stmt) error {
+		_, err := stmt.ExecContext(ctx, input.ID, input.Phone, input.UserID, input.CodeHash, input.ExpiresAt)
+		return err
+	})
+}
+
+func (r *Repository) CountLoginOTPs(ctx context.Context, phone string, window time.Duration) (count int, err error) {
+	ctx, span := startSpan(ctx, "repository.CountLoginOTPs", qCountLoginOTPs)
+	defer func() { endSpan(span, err) }()
+
+	err = r.withStmt(ctx, qCountLoginOTPs, func(stmt *sql.Stmt) error {
+		return stmt.QueryRowContext(ctx, phone, window.Seconds()).Scan(&count)
+	})
+	return count, err
+}
+
+func (r *Repository) RecordLoginOTPAttempt(ctx context.Context, phone string, maxAttempts int) (otp LoginOTP, err error) {
+	ctx, span := startSpan(ctx, "repository.RecordLoginOTPAttempt", qRecordLoginOTPAttempt)
+	defer func() { endSpan(span, err) }()
+
+	err = r.withStmt(ctx, qRecordLoginOTPAttempt, func(stmt *sql.Stmt) error {
+		return stmt.QueryRowContext(ctx, phone, maxAttempts).
+			Scan(&otp.ID, &otp.Phone, &otp.UserID, &otp.CodeHash, &otp.Attempts, &otp.ExpiresAt)
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return LoginOTP{}, ErrOTPNotFound
+	}
+	return otp, err
+}
+
+func (r *Repository) ConsumeLoginOTP(ctx context.Context, id string) (err error) {
+	ctx, span := startSpan(ctx, "repository.ConsumeLoginOTP", qConsumeLoginOTP)
+	defer func() { endSpan(span, err) }()
+
+	return r.execAffectingOne(ctx, qConsumeLoginOTP, ErrOTPNotFound, id)
+}
+
+func (r *Repository) DeleteExpiredChallenges(ctx context.Context, otpWindow time.Duration) (err error) {
+	ctx, span := startSpan(ctx, "repository.DeleteExpiredChallenges", qDeleteExpiredChallenges)
+	defer func() { endSpan(span, err) }()
+
+	return r.withStmt(ctx, qDeleteExpiredChallenges, func(stmt *sql.Stmt) error {
+		_, err := stmt.ExecContext(ctx, otpWindow.Seconds())
+		return err
+	})
+}
+
+func (r *Repository) CreateOAuthClient(ctx context.Context, input OAuthClient) (err error) {
+	ctx, span := startSpan(ctx, "repository.CreateOAuthClient", qInsertOAuthClient)
+	defer func() { endSpan(span, err) }()
+
+	err = r.withStmt(ctx, qInsertOAuthClient, func(stmt *sql.Stmt) error {
+		_, err := stmt.ExecContext(ctx, input.ClientID, input.SecretHash, input.Name,
+			pq.Array(stringArray(input.RedirectURIs)), input.OwnerID)
+		return err
+	})
+	return mapError(err)
+}
+
+func (r *Repository) GetOAuthClient(ctx context.Context, clientID string) (client OAuthClient, err error) {
+	ctx, span := startSpan(ctx, "repository.GetOAuthClient", qGetOAuthClient)
+	defer func() { endSpan(span, err) }()
+
+	err = r.withStmt(ctx, qGetOAuthClient, func(stmt *sql.Stmt) error {
+		client, err = scanOAuthClient(stmt.QueryRowContext(ctx, clientID), func(dest any) any { return pq.Array(dest) })
 		return err
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return OAuthClient{}, ErrOAuthNotFound
 	}
-	defer func() {
-		_ = tx.Rollback()
-	}()
+	return client, err
+}
+
+func (r *Repository) CreateAuthorizationCode(ctx context.Context, input AuthorizationCode) (err error) {
+	ctx, span := startSpan(ctx, "repository.CreateAuthorizationCode", qInsertAuthorizationCode)
+	defer func() { endSpan(span, err) }()
+
+	return r.withStmt(ctx, qInsertAuthorizationCode, func(stmt *sql.Stmt) error {
+		_, err := stmt.ExecContext(ctx, input.CodeHash, input.ClientID, input.UserID, input.RedirectURI,
+			input.Scope, input.Nonce, input.CodeChallenge, input.ExpiresAt)
+		return err
+	})
+}
+
+func (r *Repository) ConsumeAuthorizationCode(ctx context.Context, codeHash string) (code AuthorizationCode, err error) {
+	ctx, span := startSpan(ctx, "repository.ConsumeAuthorizationCode", qConsumeAuthorizationCode)
+	defer func() { endSpan(span, err) }()
+
+	err = r.withStmt(ctx, qConsumeAuthorizationCode, func(stmt *sql.Stmt) error {
+		code, err = scanAuthorizationCode(stmt.QueryRowContext(ctx, codeHash))
+		return err
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return AuthorizationCode{}, ErrOAuthNotFound
+	}
+	return code, err
+}
+
+func (r *Repository) GetOAuthConsent(ctx context.Context, userID, clientID string) (consent OAuthConsent, err error) {
+	ctx, span := startSpan(ctx, "repository.GetOAuthConsent", qGetOAuthConsent)
+	defer func() { endSpan(span, err) }()
+
+	err = r.withStmt(ctx, qGetOAuthConsent, func(stmt *sql.Stmt) error {
+		return stmt.QueryRowContext(ctx, userID, clientID).
+			Scan(&consent.UserID, &consent.ClientID, pq.Array(&consent.Scopes))
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return OAuthConsent{}, ErrOAuthNotFound
+	}
+	return consent, err
+}
+
+func (r *Repository) SaveOAuthConsent(ctx context.Context, input OAuthConsent) (err error) {
+	ctx, span := startSpan(ctx, "repository.SaveOAuthConsent", qSaveOAuthConsent)
+	defer func() { endSpan(span, err) }()
+
+	return r.withStmt(ctx, qSaveOAuthConsent, func(stmt *sql.Stmt) error {
+		_, err := stmt.ExecContext(ctx, input.UserID, input.ClientID, pq.Array(stringArray(input.Scopes)))
+		return err
+	})
+}
+
+func (r *Repository) CreateMachineClient(ctx context.Context, input MachineClient) (err error) {
+	ctx, span := startSpan(ctx, "repository.CreateMachineClient", qInsertMachineClient)
+	defer func() { endSpan(span, err) }()
+
+	err = r.withStmt(ctx, qInsertMachineClient, func(stmt *sql.Stmt) error {
+		_, err := stmt.ExecContext(ctx, input.ClientID, input.SecretHash, input.Name,
+			pq.Array(stringArray(input.Scopes)), input.CreatedBy)
+		return err
+	})
+	return mapError(err)
+}
 
-	column := 1
-	query := `UPDATE users SET `
+func (r *Repository) GetMachineClient(ctx context.Context, clientID string) (client MachineClient, err error) {
+	ctx, span := startSpan(ctx, "repository.GetMachineClient", qGetMachineClient)
+	defer func() { endSpan(span, err) }()
 
-	updateCol := make([]string, 0)
-	valueUpdate := make([]interface{}, 0)
-	if len(strings.TrimSpace(input.Phone)) > 0 {
-		valueUpdate = append(valueUpdate, input.Phone)
-		updateCol = append(updateCol, fmt.Sprintf("phone = $%d", column))
-		column++
+	err = r.withStmt(ctx, qGetMachineClient, func(stmt *sql.Stmt) error {
+		client, err = scanMachineClient(stmt.QueryRowContext(ctx, clientID), func(dest any) any { return pq.Array(dest) })
+		return err
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return MachineClient{}, ErrOAuthNotFound
 	}
-	if len(strings.TrimSpace(input.Name)) > 0 {
-		valueUpdate = append(valueUpdate, input.Name)
-		updateCol = append(updateCol, fmt.Sprintf("name = $%d", column))
-		column++
+	return client, err
+}
+
+func (r *Repository) ListMachineClients(ctx context.Context) (clients []MachineClient, err error) {
+	ctx, span := startSpan(ctx, "repository.ListMachineClients", qListMachineClients)
+	defer func() { endSpan(span, err) }()
+
+	err = r.withStmt(ctx, qListMachineClients, func(stmt *sql.Stmt) error {
+		rows, err := stmt.QueryContext(ctx)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			client, err := scanMachineClient(rows, func(dest any) any { return pq.Array(dest) })
+			if err != nil {
+				return err
+			}
+			clients = append(clients, client)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
 	}
+	return clients, nil
+}
+
+func (r *Repository) DeleteMachineClient(ctx context.Context, clientID string) (err error) {
+	ctx, span := startSpan(ctx, "repository.DeleteMachineClient", qDeleteMachineClient)
+	defer func() { endSpan(span, err) }()
 
-	valueUpdate = append(valueUpdate, time.Now())
-	updateCol = append(updateCol, fmt.Sprintf("updated_at = $%d", column))
-	column++
+	return r.execAffectingOne(ctx, qDeleteMachineClient, ErrOAuthNotFound, clientID)
+}
 
-	query += strings.Join(updateCol, ",")
-	query += fmt.Sprintf(" WHERE phone = $%d", column)
+func (r *Repository) CreateSession(ctx context.Context, input Session) (err error) {
+	ctx, span := startSpan(ctx, "repository.CreateSession", qInsertSession)
+	defer func() { endSpan(span, err) }()
 
-	valueUpdate = append(valueUpdate, identifier)
-	res, err := tx.ExecContext(ctx, query, valueUpdate...)
+	return r.withStmt(ctx, qInsertSession, func(stmt *sql.Stmt) error {
+		_, err := stmt.ExecContext(ctx, input.SessionID, input.UserID, input.UserAgent, input.IP, input.DeviceName, input.ExpiresAt)
+		return err
+	})
+}
+
+func (r *Repository) ListSessions(ctx context.Context, userID string) (sessions []Session, err error) {
+	ctx, span := startSpan(ctx, "repository.ListSessions", qListSessions)
+	defer func() { endSpan(span, err) }()
+
+	err = r.withStmt(ctx, qListSessions, func(stmt *sql.Stmt) error {
+		rows, err := stmt.QueryContext(ctx, userID)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			session, err := scanSession(rows)
+			if err != nil {
+				return err
+			}
+			sessions = append(sessions, session)
+		}
+		return rows.Err()
+	})
 	if err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+func (r *Repository) GetSession(ctx context.Context, sessionID string) (session Session, err error) {
+	ctx, span := startSpan(ctx, "repository.GetSession", qGetSession)
+	defer func() { endSpan(span, err) }()
+
+	err = r.withStmt(ctx, qGetSession, func(stmt *sql.Stmt) error {
+		session, err = scanSession(stmt.QueryRowContext(ctx, sessionID, SessionSeenInterval.Seconds()))
 		return err
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return Session{}, ErrSessionNotFound
 	}
+	return session, err
+}
 
-	if affected, _ := res.RowsAffected(); affected < 1 {
-		return errors.New("update user error")
+func (r *Repository) TouchSession(ctx context.Context, sessionID string) (session Session, err error) {
+	ctx, span := startSpan(ctx, "repository.TouchSession", qTouchSession)
+	defer func() { endSpan(span, err) }()
+
+	err = r.withStmt(ctx, qTouchSession, func(stmt *sql.Stmt) error {
+		session, err = scanSession(stmt.QueryRowContext(ctx, sessionID, SessionSeenInterval.Seconds()))
+		return err
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return Session{}, ErrSessionNotFound
 	}
+	return session, err
+}
+
+func (r *Repository) RevokeSession(ctx context.Context, userID, sessionID string) (err error) {
+	ctx, span := startSpan(ctx, "repository.RevokeSession", qRevokeSession)
+	defer func() { endSpan(span, err) }()
+
+	return r.execAffectingOne(ctx, qRevokeSession, ErrSessionNotFound, userID, sessionID)
+}
 
-	return tx.Commit()
+func (r *Repository) RevokeOtherSessions(ctx context.Context, userID, keepSessionID string) (revoked int64, err error) {
+	ctx, span := startSpan(ctx, "repository.RevokeOtherSessions", qRevokeOtherSessions)
+	defer func() { endSpan(span, err) }()
+
+	err = r.withStmt(ctx, qRevokeOtherSessions, func(stmt *sql.Stmt) error {
+		res, err := stmt.ExecContext(ctx, userID, keepSessionID)
+		if err != nil {
+			return err
+		}
+		revoked, err = res.RowsAffected()
+		return err
+	})
+	return revoked, err
+}
+
+// execAffectingOne runs the cached statement for query and returns notFound
+// when it changed no row.
+func (r *Repository) execAffectingOne(ctx context.Context, query string, notFound error, args ...any) error {
+	var res sql.Result
+	err := r.withStmt(ctx, query, func(stmt *sql.Stmt) (err error) {
+		res, err = stmt.ExecContext(ctx, args...)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if affected, _ := res.RowsAffected(); affected < 1 {
+		return notFound
+	}
+	return nil
 }
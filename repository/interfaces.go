@@ -6,12 +6,103 @@ package repository
 
 import (
 	"context"
+	"time"
 )
 
 type RepositoryInterface interface {
 	GetTestById(ctx context.Context, input GetTestByIdInput) (output GetTestByIdOutput, err error)
 	RegisterUser(ctx context.Context, input RegisterUser) (string, error)
 	GetUserByPhone(ctx context.Context, phone string) (User, error)
+	// GetUserByEmail looks the user up by email, ignoring case.
+	GetUserByEmail(ctx context.Context, email string) (User, error)
+	GetUserByID(ctx context.Context, id string) (User, error)
 	IncrSuccessLogin(ctx context.Context, phone string) error
 	UpdateUser(ctx context.Context, input UpdateUser, identifier string) error
+	// UpdatePassword replaces the password hash without changing the
+	// profile version.
+	UpdatePassword(ctx context.Context, phone, password string) error
+	CreateEmailVerification(ctx context.Context, input EmailVerification) error
+	// ConfirmEmailVerification consumes the token and marks the email it was
+	// issued for as verified, returning the owning user ID.
+	ConfirmEmailVerification(ctx context.Context, tokenHash string) (string, error)
+	// SaveTOTP stores a pending TOTP secret, replacing a previous pending one.
+	// It fails with ErrConflict when the user already confirmed TOTP.
+	SaveTOTP(ctx context.Context, userID, secret string) error
+	GetTOTP(ctx context.Context, userID string) (TOTP, error)
+	// ConfirmTOTP enables the pending TOTP secret after a code of the given
+	// step was accepted and replaces the recovery codes.
+	ConfirmTOTP(ctx context.Context, userID string, step int64, recoveryCodeHashes []string) error
+	// UseTOTPStep records that a code of step was accepted, failing with
+	// ErrMFANotFound when a code of that or a later step was already used.
+	UseTOTPStep(ctx context.Context, userID string, step int64) error
+	// UseRecoveryCode marks an unused recovery code as used.
+	UseRecoveryCode(ctx context.Context, userID, codeHash string) error
+	CreateMFAChallenge(ctx context.Context, input MFAChallenge) error
+	// RecordMFAAttempt counts an attempt at answering a live challenge that
+	// had fewer than maxAttempts attempts and returns its user ID.
+	RecordMFAAttempt(ctx context.Context, tokenHash string, maxAttempts int) (string, error)
+	DeleteMFAChallenge(ctx context.Context, tokenHash string) error
+	// CreateSession stores a new session; CreatedAt and LastSeenAt are set to
+	// the current time.
+	CreateSession(ctx context.Context, input Session) error
+	// ListSessions returns the live sessions of the user, most recently seen
+	// first.
+	ListSessions(ctx context.Context, userID string) ([]Session, error)
+	// GetSession returns a live session, failing with ErrSessionNotFound
+	// when it was revoked or expired. Unlike TouchSession it leaves
+	// LastSeenAt alone.
+	GetSession(ctx context.Context, sessionID string) (Session, error)
+	// TouchSession records that a live session was used and returns it,
+	// failing with ErrSessionNotFound when it was revoked or expired.
+	// LastSeenAt is only written once it is older than SessionSeenInterval.
+	TouchSession(ctx context.Context, sessionID string) (Session, error)
+	// RevokeSession revokes a live session of the user.
+	RevokeSession(ctx context.Context, userID, sessionID string) error
+	// RevokeOtherSessions revokes every live session of the user but
+	// keepSessionID and returns how many were revoked.
+	RevokeOtherSessions(ctx context.Context, userID, keepSessionID string) (int64, error)
+	CreateWebAuthnChallenge(ctx context.Context, input WebAuthnChallenge) error
+	// ConsumeWebAuthnChallenge deletes the challenge of the given ceremony
+	// and returns it, failing with ErrPasskeyNotFound when it is unknown or
+	// expired.
+	ConsumeWebAuthnChallenge(ctx context.Context, challenge, ceremony string) (WebAuthnChallenge, error)
+	// CreatePasskey stores a new passkey, failing with ErrConflict when the
+	// credential ID is already registered.
+	CreatePasskey(ctx context.Context, input Passkey) error
+	ListPasskeys(ctx context.Context, userID string) ([]Passkey, error)
+	// UpdatePasskeyUse records a login with the passkey and the counters and
+	// flags reported by the authenticator.
+	UpdatePasskeyUse(ctx context.Context, input Passkey) error
+	CreateLoginOTP(ctx context.Context, input LoginOTP) error
+	// CountLoginOTPs returns how many codes were requested for the phone
+	// within the last window.
+	CountLoginOTPs(ctx context.Context, phone string, window time.Duration) (int, error)
+	// RecordLoginOTPAttempt counts an attempt at the most recent code of the
+	// phone and returns it. It fails with ErrOTPNotFound when that code was
+	// used, expired or already had maxAttempts attempts.
+	RecordLoginOTPAttempt(ctx context.Context, phone string, maxAttempts int) (LoginOTP, error)
+	// ConsumeLoginOTP marks a code as used, failing with ErrOTPNotFound when
+	// it already was.
+	ConsumeLoginOTP(ctx context.Context, id string) error
+	// DeleteExpiredChallenges deletes the MFA and WebAuthn challenges past
+	// their expiry, and the login codes past theirs that were requested
+	// before the last otpWindow and so no longer count for CountLoginOTPs.
+	DeleteExpiredChallenges(ctx context.Context, otpWindow time.Duration) error
+	CreateOAuthClient(ctx context.Context, input OAuthClient) error
+	GetOAuthClient(ctx context.Context, clientID string) (OAuthClient, error)
+	CreateAuthorizationCode(ctx context.Context, input AuthorizationCode) error
+	// ConsumeAuthorizationCode deletes the code and returns it, failing with
+	// ErrOAuthNotFound when it is unknown or expired.
+	ConsumeAuthorizationCode(ctx context.Context, codeHash string) (AuthorizationCode, error)
+	GetOAuthConsent(ctx context.Context, userID, clientID string) (OAuthConsent, error)
+	// SaveOAuthConsent stores the scopes granted to the client, replacing
+	// the ones granted before.
+	SaveOAuthConsent(ctx context.Context, input OAuthConsent) error
+	CreateMachineClient(ctx context.Context, input MachineClient) error
+	GetMachineClient(ctx context.Context, clientID string) (MachineClient, error)
+	ListMachineClients(ctx context.Context) ([]MachineClient, error)
+	DeleteMachineClient(ctx context.Context, clientID string) error
+	// WithTx runs fn with a repository whose operations share one
+	// transaction, committed when fn returns nil.
+	WithTx(ctx context.Context, fn TxFunc) error
 }
@@ -7,6 +7,7 @@ package repository
 import (
 	context "context"
 	reflect "reflect"
+	time "time"
 
 	gomock "github.com/golang/mock/gomock"
 )
@@ -34,6 +35,337 @@ func (m *MockRepositoryInterface) EXPECT() *MockRepositoryInterfaceMockRecorder
 	return m.recorder
 }
 
+// ConfirmEmailVerification mocks base method.
+func (m *MockRepositoryInterface) ConfirmEmailVerification(ctx context.Context, tokenHash string) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ConfirmEmailVerification", ctx, tokenHash)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ConfirmEmailVerification indicates an expected call of ConfirmEmailVerification.
+func (mr *MockRepositoryInterfaceMockRecorder) ConfirmEmailVerification(ctx, tokenHash interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ConfirmEmailVerification", reflect.TypeOf((*MockRepositoryInterface)(nil).ConfirmEmailVerification), ctx, tokenHash)
+}
+
+// ConfirmTOTP mocks base method.
+func (m *MockRepositoryInterface) ConfirmTOTP(ctx context.Context, userID string, step int64, recoveryCodeHashes []string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ConfirmTOTP", ctx, userID, step, recoveryCodeHashes)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ConfirmTOTP indicates an expected call of ConfirmTOTP.
+func (mr *MockRepositoryInterfaceMockRecorder) ConfirmTOTP(ctx, userID, step, recoveryCodeHashes interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ConfirmTOTP", reflect.TypeOf((*MockRepositoryInterface)(nil).ConfirmTOTP), ctx, userID, step, recoveryCodeHashes)
+}
+
+// ConsumeAuthorizationCode mocks base method.
+func (m *MockRepositoryInterface) ConsumeAuthorizationCode(ctx context.Context, codeHash string) (AuthorizationCode, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ConsumeAuthorizationCode", ctx, codeHash)
+	ret0, _ := ret[0].(AuthorizationCode)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ConsumeAuthorizationCode indicates an expected call of ConsumeAuthorizationCode.
+func (mr *MockRepositoryInterfaceMockRecorder) ConsumeAuthorizationCode(ctx, codeHash interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ConsumeAuthorizationCode", reflect.TypeOf((*MockRepositoryInterface)(nil).ConsumeAuthorizationCode), ctx, codeHash)
+}
+
+// ConsumeLoginOTP mocks base method.
+func (m *MockRepositoryInterface) ConsumeLoginOTP(ctx context.Context, id string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ConsumeLoginOTP", ctx, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ConsumeLoginOTP indicates an expected call of ConsumeLoginOTP.
+func (mr *MockRepositoryInterfaceMockRecorder) ConsumeLoginOTP(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ConsumeLoginOTP", reflect.TypeOf((*MockRepositoryInterface)(nil).ConsumeLoginOTP), ctx, id)
+}
+
+// ConsumeWebAuthnChallenge mocks base method.
+func (m *MockRepositoryInterface) ConsumeWebAuthnChallenge(ctx context.Context, challenge, ceremony string) (WebAuthnChallenge, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ConsumeWebAuthnChallenge", ctx, challenge, ceremony)
+	ret0, _ := ret[0].(WebAuthnChallenge)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ConsumeWebAuthnChallenge indicates an expected call of ConsumeWebAuthnChallenge.
+func (mr *MockRepositoryInterfaceMockRecorder) ConsumeWebAuthnChallenge(ctx, challenge, ceremony interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ConsumeWebAuthnChallenge", reflect.TypeOf((*MockRepositoryInterface)(nil).ConsumeWebAuthnChallenge), ctx, challenge, ceremony)
+}
+
+// CountLoginOTPs mocks base method.
+func (m *MockRepositoryInterface) CountLoginOTPs(ctx context.Context, phone string, window time.Duration) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CountLoginOTPs", ctx, phone, window)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CountLoginOTPs indicates an expected call of CountLoginOTPs.
+func (mr *MockRepositoryInterfaceMockRecorder) CountLoginOTPs(ctx, phone, window interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CountLoginOTPs", reflect.TypeOf((*MockRepositoryInterface)(nil).CountLoginOTPs), ctx, phone, window)
+}
+
+// CreateAuthorizationCode mocks base method.
+func (m *MockRepositoryInterface) CreateAuthorizationCode(ctx context.Context, input AuthorizationCode) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateAuthorizationCode", ctx, input)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateAuthorizationCode indicates an expected call of CreateAuthorizationCode.
+func (mr *MockRepositoryInterfaceMockRecorder) CreateAuthorizationCode(ctx, input interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateAuthorizationCode", reflect.TypeOf((*MockRepositoryInterface)(nil).CreateAuthorizationCode), ctx, input)
+}
+
+// CreateEmailVerification mocks base method.
+func (m *MockRepositoryInterface) CreateEmailVerification(ctx context.Context, input EmailVerification) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateEmailVerification", ctx, input)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateEmailVerification indicates an expected call of CreateEmailVerification.
+func (mr *MockRepositoryInterfaceMockRecorder) CreateEmailVerification(ctx, input interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateEmailVerification", reflect.TypeOf((*MockRepositoryInterface)(nil).CreateEmailVerification), ctx, input)
+}
+
+// CreateLoginOTP mocks base method.
+func (m *MockRepositoryInterface) CreateLoginOTP(ctx context.Context, input LoginOTP) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateLoginOTP", ctx, input)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateLoginOTP indicates an expected call of CreateLoginOTP.
+func (mr *MockRepositoryInterfaceMockRecorder) CreateLoginOTP(ctx, input interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateLoginOTP", reflect.TypeOf((*MockRepositoryInterface)(nil).CreateLoginOTP), ctx, input)
+}
+
+// CreateMFAChallenge mocks base method.
+func (m *MockRepositoryInterface) CreateMFAChallenge(ctx context.Context, input MFAChallenge) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateMFAChallenge", ctx, input)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateMFAChallenge indicates an expected call of CreateMFAChallenge.
+func (mr *MockRepositoryInterfaceMockRecorder) CreateMFAChallenge(ctx, input interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateMFAChallenge", reflect.TypeOf((*MockRepositoryInterface)(nil).CreateMFAChallenge), ctx, input)
+}
+
+// CreateMachineClient mocks base method.
+func (m *MockRepositoryInterface) CreateMachineClient(ctx context.Context, input MachineClient) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateMachineClient", ctx, input)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateMachineClient indicates an expected call of CreateMachineClient.
+func (mr *MockRepositoryInterfaceMockRecorder) CreateMachineClient(ctx, input interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateMachineClient", reflect.TypeOf((*MockRepositoryInterface)(nil).CreateMachineClient), ctx, input)
+}
+
+// CreateOAuthClient mocks base method.
+func (m *MockRepositoryInterface) CreateOAuthClient(ctx context.Context, input OAuthClient) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateOAuthClient", ctx, input)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateOAuthClient indicates an expected call of CreateOAuthClient.
+func (mr *MockRepositoryInterfaceMockRecorder) CreateOAuthClient(ctx, input interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateOAuthClient", reflect.TypeOf((*MockRepositoryInterface)(nil).CreateOAuthClient), ctx, input)
+}
+
+// CreatePasskey mocks base method.
+func (m *MockRepositoryInterface) CreatePasskey(ctx context.Context, input Passkey) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreatePasskey", ctx, input)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreatePasskey indicates an expected call of CreatePasskey.
+func (mr *MockRepositoryInterfaceMockRecorder) CreatePasskey(ctx, input interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreatePasskey", reflect.TypeOf((*MockRepositoryInterface)(nil).CreatePasskey), ctx, input)
+}
+
+// CreateSession mocks base method.
+func (m *MockRepositoryInterface) CreateSession(ctx context.Context, input Session) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateSession", ctx, input)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateSession indicates an expected call of CreateSession.
+func (mr *MockRepositoryInterfaceMockRecorder) CreateSession(ctx, input interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateSession", reflect.TypeOf((*MockRepositoryInterface)(nil).CreateSession), ctx, input)
+}
+
+// CreateWebAuthnChallenge mocks base method.
+func (m *MockRepositoryInterface) CreateWebAuthnChallenge(ctx context.Context, input WebAuthnChallenge) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateWebAuthnChallenge", ctx, input)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateWebAuthnChallenge indicates an expected call of CreateWebAuthnChallenge.
+func (mr *MockRepositoryInterfaceMockRecorder) CreateWebAuthnChallenge(ctx, input interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateWebAuthnChallenge", reflect.TypeOf((*MockRepositoryInterface)(nil).CreateWebAuthnChallenge), ctx, input)
+}
+
+// DeleteExpiredChallenges mocks base method.
+func (m *MockRepositoryInterface) DeleteExpiredChallenges(ctx context.Context, otpWindow time.Duration) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteExpiredChallenges", ctx, otpWindow)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteExpiredChallenges indicates an expected call of DeleteExpiredChallenges.
+func (mr *MockRepositoryInterfaceMockRecorder) DeleteExpiredChallenges(ctx, otpWindow interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteExpiredChallenges", reflect.TypeOf((*MockRepositoryInterface)(nil).DeleteExpiredChallenges), ctx, otpWindow)
+}
+
+// DeleteMFAChallenge mocks base method.
+func (m *MockRepositoryInterface) DeleteMFAChallenge(ctx context.Context, tokenHash string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteMFAChallenge", ctx, tokenHash)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteMFAChallenge indicates an expected call of DeleteMFAChallenge.
+func (mr *MockRepositoryInterfaceMockRecorder) DeleteMFAChallenge(ctx, tokenHash interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteMFAChallenge", reflect.TypeOf((*MockRepositoryInterface)(nil).DeleteMFAChallenge), ctx, tokenHash)
+}
+
+// DeleteMachineClient mocks base method.
+func (m *MockRepositoryInterface) DeleteMachineClient(ctx context.Context, clientID string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteMachineClient", ctx, clientID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteMachineClient indicates an expected call of DeleteMachineClient.
+func (mr *MockRepositoryInterfaceMockRecorder) DeleteMachineClient(ctx, clientID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteMachineClient", reflect.TypeOf((*MockRepositoryInterface)(nil).DeleteMachineClient), ctx, clientID)
+}
+
+// GetMachineClient mocks base method.
+func (m *MockRepositoryInterface) GetMachineClient(ctx context.Context, clientID string) (MachineClient, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetMachineClient", ctx, clientID)
+	ret0, _ := ret[0].(MachineClient)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetMachineClient indicates an expected call of GetMachineClient.
+func (mr *MockRepositoryInterfaceMockRecorder) GetMachineClient(ctx, clientID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetMachineClient", reflect.TypeOf((*MockRepositoryInterface)(nil).GetMachineClient), ctx, clientID)
+}
+
+// GetOAuthClient mocks base method.
+func (m *MockRepositoryInterface) GetOAuthClient(ctx context.Context, clientID string) (OAuthClient, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetOAuthClient", ctx, clientID)
+	ret0, _ := ret[0].(OAuthClient)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetOAuthClient indicates an expected call of GetOAuthClient.
+func (mr *MockRepositoryInterfaceMockRecorder) GetOAuthClient(ctx, clientID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetOAuthClient", reflect.TypeOf((*MockRepositoryInterface)(nil).GetOAuthClient), ctx, clientID)
+}
+
+// GetOAuthConsent mocks base method.
+func (m *MockRepositoryInterface) GetOAuthConsent(ctx context.Context, userID, clientID string) (OAuthConsent, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetOAuthConsent", ctx, userID, clientID)
+	ret0, _ := ret[0].(OAuthConsent)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetOAuthConsent indicates an expected call of GetOAuthConsent.
+func (mr *MockRepositoryInterfaceMockRecorder) GetOAuthConsent(ctx, userID, clientID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetOAuthConsent", reflect.TypeOf((*MockRepositoryInterface)(nil).GetOAuthConsent), ctx, userID, clientID)
+}
+
+// GetSession mocks base method.
+func (m *MockRepositoryInterface) GetSession(ctx context.Context, sessionID string) (Session, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetSession", ctx, sessionID)
+	ret0, _ := ret[0].(Session)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetSession indicates an expected call of GetSession.
+func (mr *MockRepositoryInterfaceMockRecorder) GetSession(ctx, sessionID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSession", reflect.TypeOf((*MockRepositoryInterface)(nil).GetSession), ctx, sessionID)
+}
+
+// GetTOTP mocks base method.
+func (m *MockRepositoryInterface) GetTOTP(ctx context.Context, userID string) (TOTP, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetTOTP", ctx, userID)
+	ret0, _ := ret[0].(TOTP)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetTOTP indicates an expected call of GetTOTP.
+func (mr *MockRepositoryInterfaceMockRecorder) GetTOTP(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTOTP", reflect.TypeOf((*MockRepositoryInterface)(nil).GetTOTP), ctx, userID)
+}
+
 // GetTestById mocks base method.
 func (m *MockRepositoryInterface) GetTestById(ctx context.Context, input GetTestByIdInput) (GetTestByIdOutput, error) {
 	m.ctrl.T.Helper()
@@ -49,6 +381,36 @@ func (mr *MockRepositoryInterfaceMockRecorder) GetTestById(ctx, input interface{
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTestById", reflect.TypeOf((*MockRepositoryInterface)(nil).GetTestById), ctx, input)
 }
 
+// GetUserByEmail mocks base method.
+func (m *MockRepositoryInterface) GetUserByEmail(ctx context.Context, email string) (User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserByEmail", ctx, email)
+	ret0, _ := ret[0].(User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserByEmail indicates an expected call of GetUserByEmail.
+func (mr *MockRepositoryInterfaceMockRecorder) GetUserByEmail(ctx, email interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserByEmail", reflect.TypeOf((*MockRepositoryInterface)(nil).GetUserByEmail), ctx, email)
+}
+
+// GetUserByID mocks base method.
+func (m *MockRepositoryInterface) GetUserByID(ctx context.Context, id string) (User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserByID", ctx, id)
+	ret0, _ := ret[0].(User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserByID indicates an expected call of GetUserByID.
+func (mr *MockRepositoryInterfaceMockRecorder) GetUserByID(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserByID", reflect.TypeOf((*MockRepositoryInterface)(nil).GetUserByID), ctx, id)
+}
+
 // GetUserByPhone mocks base method.
 func (m *MockRepositoryInterface) GetUserByPhone(ctx context.Context, phone string) (User, error) {
 	m.ctrl.T.Helper()
@@ -78,6 +440,81 @@ func (mr *MockRepositoryInterfaceMockRecorder) IncrSuccessLogin(ctx, phone inter
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IncrSuccessLogin", reflect.TypeOf((*MockRepositoryInterface)(nil).IncrSuccessLogin), ctx, phone)
 }
 
+// ListMachineClients mocks base method.
+func (m *MockRepositoryInterface) ListMachineClients(ctx context.Context) ([]MachineClient, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListMachineClients", ctx)
+	ret0, _ := ret[0].([]MachineClient)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListMachineClients indicates an expected call of ListMachineClients.
+func (mr *MockRepositoryInterfaceMockRecorder) ListMachineClients(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListMachineClients", reflect.TypeOf((*MockRepositoryInterface)(nil).ListMachineClients), ctx)
+}
+
+// ListPasskeys mocks base method.
+func (m *MockRepositoryInterface) ListPasskeys(ctx context.Context, userID string) ([]Passkey, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListPasskeys", ctx, userID)
+	ret0, _ := ret[0].([]Passkey)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListPasskeys indicates an expected call of ListPasskeys.
+func (mr *MockRepositoryInterfaceMockRecorder) ListPasskeys(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListPasskeys", reflect.TypeOf((*MockRepositoryInterface)(nil).ListPasskeys), ctx, userID)
+}
+
+// ListSessions mocks base method.
+func (m *MockRepositoryInterface) ListSessions(ctx context.Context, userID string) ([]Session, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListSessions", ctx, userID)
+	ret0, _ := ret[0].([]Session)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListSessions indicates an expected call of ListSessions.
+func (mr *MockRepositoryInterfaceMockRecorder) ListSessions(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListSessions", reflect.TypeOf((*MockRepositoryInterface)(nil).ListSessions), ctx, userID)
+}
+
+// RecordLoginOTPAttempt mocks base method.
+func (m *MockRepositoryInterface) RecordLoginOTPAttempt(ctx context.Context, phone string, maxAttempts int) (LoginOTP, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RecordLoginOTPAttempt", ctx, phone, maxAttempts)
+	ret0, _ := ret[0].(LoginOTP)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RecordLoginOTPAttempt indicates an expected call of RecordLoginOTPAttempt.
+func (mr *MockRepositoryInterfaceMockRecorder) RecordLoginOTPAttempt(ctx, phone, maxAttempts interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RecordLoginOTPAttempt", reflect.TypeOf((*MockRepositoryInterface)(nil).RecordLoginOTPAttempt), ctx, phone, maxAttempts)
+}
+
+// RecordMFAAttempt mocks base method.
+func (m *MockRepositoryInterface) RecordMFAAttempt(ctx context.Context, tokenHash string, maxAttempts int) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RecordMFAAttempt", ctx, tokenHash, maxAttempts)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RecordMFAAttempt indicates an expected call of RecordMFAAttempt.
+func (mr *MockRepositoryInterfaceMockRecorder) RecordMFAAttempt(ctx, tokenHash, maxAttempts interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RecordMFAAttempt", reflect.TypeOf((*MockRepositoryInterface)(nil).RecordMFAAttempt), ctx, tokenHash, maxAttempts)
+}
+
 // RegisterUser mocks base method.
 func (m *MockRepositoryInterface) RegisterUser(ctx context.Context, input RegisterUser) (string, error) {
 	m.ctrl.T.Helper()
@@ -93,6 +530,106 @@ func (mr *MockRepositoryInterfaceMockRecorder) RegisterUser(ctx, input interface
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RegisterUser", reflect.TypeOf((*MockRepositoryInterface)(nil).RegisterUser), ctx, input)
 }
 
+// RevokeOtherSessions mocks base method.
+func (m *MockRepositoryInterface) RevokeOtherSessions(ctx context.Context, userID, keepSessionID string) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeOtherSessions", ctx, userID, keepSessionID)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RevokeOtherSessions indicates an expected call of RevokeOtherSessions.
+func (mr *MockRepositoryInterfaceMockRecorder) RevokeOtherSessions(ctx, userID, keepSessionID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeOtherSessions", reflect.TypeOf((*MockRepositoryInterface)(nil).RevokeOtherSessions), ctx, userID, keepSessionID)
+}
+
+// RevokeSession mocks base method.
+func (m *MockRepositoryInterface) RevokeSession(ctx context.Context, userID, sessionID string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeSession", ctx, userID, sessionID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RevokeSession indicates an expected call of RevokeSession.
+func (mr *MockRepositoryInterfaceMockRecorder) RevokeSession(ctx, userID, sessionID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeSession", reflect.TypeOf((*MockRepositoryInterface)(nil).RevokeSession), ctx, userID, sessionID)
+}
+
+// SaveOAuthConsent mocks base method.
+func (m *MockRepositoryInterface) SaveOAuthConsent(ctx context.Context, input OAuthConsent) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveOAuthConsent", ctx, input)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveOAuthConsent indicates an expected call of SaveOAuthConsent.
+func (mr *MockRepositoryInterfaceMockRecorder) SaveOAuthConsent(ctx, input interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveOAuthConsent", reflect.TypeOf((*MockRepositoryInterface)(nil).SaveOAuthConsent), ctx, input)
+}
+
+// SaveTOTP mocks base method.
+func (m *MockRepositoryInterface) SaveTOTP(ctx context.Context, userID, secret string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveTOTP", ctx, userID, secret)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveTOTP indicates an expected call of SaveTOTP.
+func (mr *MockRepositoryInterfaceMockRecorder) SaveTOTP(ctx, userID, secret interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveTOTP", reflect.TypeOf((*MockRepositoryInterface)(nil).SaveTOTP), ctx, userID, secret)
+}
+
+// TouchSession mocks base method.
+func (m *MockRepositoryInterface) TouchSession(ctx context.Context, sessionID string) (Session, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "TouchSession", ctx, sessionID)
+	ret0, _ := ret[0].(Session)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// TouchSession indicates an expected call of TouchSession.
+func (mr *MockRepositoryInterfaceMockRecorder) TouchSession(ctx, sessionID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TouchSession", reflect.TypeOf((*MockRepositoryInterface)(nil).TouchSession), ctx, sessionID)
+}
+
+// UpdatePasskeyUse mocks base method.
+func (m *MockRepositoryInterface) UpdatePasskeyUse(ctx context.Context, input Passkey) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdatePasskeyUse", ctx, input)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdatePasskeyUse indicates an expected call of UpdatePasskeyUse.
+func (mr *MockRepositoryInterfaceMockRecorder) UpdatePasskeyUse(ctx, input interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdatePasskeyUse", reflect.TypeOf((*MockRepositoryInterface)(nil).UpdatePasskeyUse), ctx, input)
+}
+
+// UpdatePassword mocks base method.
+func (m *MockRepositoryInterface) UpdatePassword(ctx context.Context, phone, password string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdatePassword", ctx, phone, password)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdatePassword indicates an expected call of UpdatePassword.
+func (mr *MockRepositoryInterfaceMockRecorder) UpdatePassword(ctx, phone, password interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdatePassword", reflect.TypeOf((*MockRepositoryInterface)(nil).UpdatePassword), ctx, phone, password)
+}
+
 // UpdateUser mocks base method.
 func (m *MockRepositoryInterface) UpdateUser(ctx context.Context, input UpdateUser, identifier string) error {
 	m.ctrl.T.Helper()
@@ -106,3 +643,45 @@ func (mr *MockRepositoryInterfaceMockRecorder) UpdateUser(ctx, input, identifier
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateUser", reflect.TypeOf((*MockRepositoryInterface)(nil).UpdateUser), ctx, input, identifier)
 }
+
+// UseRecoveryCode mocks base method.
+func (m *MockRepositoryInterface) UseRecoveryCode(ctx context.Context, userID, codeHash string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UseRecoveryCode", ctx, userID, codeHash)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UseRecoveryCode indicates an expected call of UseRecoveryCode.
+func (mr *MockRepositoryInterfaceMockRecorder) UseRecoveryCode(ctx, userID, codeHash interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UseRecoveryCode", reflect.TypeOf((*MockRepositoryInterface)(nil).UseRecoveryCode), ctx, userID, codeHash)
+}
+
+// UseTOTPStep mocks base method.
+func (m *MockRepositoryInterface) UseTOTPStep(ctx context.Context, userID string, step int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UseTOTPStep", ctx, userID, step)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UseTOTPStep indicates an expected call of UseTOTPStep.
+func (mr *MockRepositoryInterfaceMockRecorder) UseTOTPStep(ctx, userID, step interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UseTOTPStep", reflect.TypeOf((*MockRepositoryInterface)(nil).UseTOTPStep), ctx, userID, step)
+}
+
+// WithTx mocks base method.
+func (m *MockRepositoryInterface) WithTx(ctx context.Context, fn TxFunc) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "WithTx", ctx, fn)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// WithTx indicates an expected call of WithTx.
+func (mr *MockRepositoryInterfaceMockRecorder) WithTx(ctx, fn interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WithTx", reflect.TypeOf((*MockRepositoryInterface)(nil).WithTx), ctx, fn)
+}
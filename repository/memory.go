@@ -0,0 +1,841 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryRepository is an in-memory RepositoryInterface that follows the same
+// contract as the Postgres implementations. It is meant for tests and local
+// experiments, not for production use.
+type MemoryRepository struct {
+	mu    *sync.RWMutex
+	store *memoryStore
+	// inTx is set on the repository handed to a WithTx callback, which runs
+	// while the parent holds the write lock.
+	inTx bool
+}
+
+type memoryStore struct {
+	// users is keyed by phone, which is unique like in the users table.
+	users map[string]User
+	// emailVerifications is keyed by user ID.
+	emailVerifications map[string]EmailVerification
+	// totp is keyed by user ID.
+	totp map[string]TOTP
+	// recoveryCodes maps a user ID to its code hashes and whether they were
+	// used.
+	recoveryCodes map[string]map[string]bool
+	// mfaChallenges is keyed by token hash.
+	mfaChallenges map[string]memoryMFAChallenge
+	// sessions is keyed by session ID.
+	sessions map[string]memorySession
+	// webAuthnChallenges is keyed by challenge.
+	webAuthnChallenges map[string]WebAuthnChallenge
+	// passkeys is keyed by credential ID.
+	passkeys map[string]Passkey
+	// loginOTPs maps a phone to its codes, oldest first.
+	loginOTPs map[string][]memoryLoginOTP
+	// oauthClients is keyed by client ID.
+	oauthClients map[string]OAuthClient
+	// authorizationCodes is keyed by code hash.
+	authorizationCodes map[string]AuthorizationCode
+	oauthConsents      map[memoryConsentKey]OAuthConsent
+	// machineClients is keyed by client ID.
+	machineClients map[string]MachineClient
+}
+
+type memoryConsentKey struct {
+	userID   string
+	clientID string
+}
+
+type memorySession struct {
+	Session
+	revoked bool
+}
+
+// live reports whether the session can still be used at now.
+func (s memorySession) live(now time.Time) bool {
+	return !s.revoked && s.ExpiresAt.After(now)
+}
+
+type memoryLoginOTP struct {
+	LoginOTP
+	createdAt time.Time
+	consumed  bool
+}
+
+type memoryMFAChallenge struct {
+	MFAChallenge
+	attempts int
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{
+		users:              make(map[string]User),
+		emailVerifications: make(map[string]EmailVerification),
+		totp:               make(map[string]TOTP),
+		recoveryCodes:      make(map[string]map[string]bool),
+		mfaChallenges:      make(map[string]memoryMFAChallenge),
+		sessions:           make(map[string]memorySession),
+		webAuthnChallenges: make(map[string]WebAuthnChallenge),
+		passkeys:           make(map[string]Passkey),
+		loginOTPs:          make(map[string][]memoryLoginOTP),
+		oauthClients:       make(map[string]OAuthClient),
+		authorizationCodes: make(map[string]AuthorizationCode),
+		oauthConsents:      make(map[memoryConsentKey]OAuthConsent),
+		machineClients:     make(map[string]MachineClient),
+	}
+}
+
+func (s *memoryStore) clone() *memoryStore {
+	c := newMemoryStore()
+	for k, v := range s.users {
+		c.users[k] = v
+	}
+	for k, v := range s.emailVerifications {
+		c.emailVerifications[k] = v
+	}
+	for k, v := range s.totp {
+		c.totp[k] = v
+	}
+	for k, v := range s.recoveryCodes {
+		codes := make(map[string]bool, len(v))
+		for hash, used := range v {
+			codes[hash] = used
+		}
+		c.recoveryCodes[k] = codes
+	}
+	for k, v := range s.mfaChallenges {
+		c.mfaChallenges[k] = v
+	}
+	for k, v := range s.sessions {
+		c.sessions[k] = v
+	}
+	for k, v := range s.webAuthnChallenges {
+		c.webAuthnChallenges[k] = v
+	}
+	for k, v := range s.passkeys {
+		c.passkeys[k] = v
+	}
+	for k, v := range s.loginOTPs {
+		c.loginOTPs[k] = append([]memoryLoginOTP(nil), v...)
+	}
+	for k, v := range s.oauthClients {
+		c.oauthClients[k] = v
+	}
+	for k, v := range s.authorizationCodes {
+		c.authorizationCodes[k] = v
+	}
+	for k, v := range s.oauthConsents {
+		c.oauthConsents[k] = v
+	}
+	for k, v := range s.machineClients {
+		c.machineClients[k] = v
+	}
+	return c
+}
+
+// restore replaces the content of s with the content of snapshot.
+func (s *memoryStore) restore(snapshot *memoryStore) {
+	*s = *snapshot
+}
+
+func (s *memoryStore) userByID(id string) (User, bool) {
+	for _, user := range s.users {
+		if user.UserID == id {
+			return user, true
+		}
+	}
+	return User{}, false
+}
+
+func (s *memoryStore) emailTaken(email, exceptPhone string) bool {
+	for phone, user := range s.users {
+		if phone != exceptPhone && user.Email.Valid && strings.EqualFold(user.Email.String, email) {
+			return true
+		}
+	}
+	return false
+}
+
+func NewMemoryRepository() *MemoryRepository {
+	return &MemoryRepository{
+		mu:    &sync.RWMutex{},
+		store: newMemoryStore(),
+	}
+}
+
+func (r *MemoryRepository) Close() error {
+	return nil
+}
+
+func (r *MemoryRepository) lock() func() {
+	if r.inTx {
+		return func() {}
+	}
+	r.mu.Lock()
+	return r.mu.Unlock
+}
+
+func (r *MemoryRepository) rlock() func() {
+	if r.inTx {
+		return func() {}
+	}
+	r.mu.RLock()
+	return r.mu.RUnlock
+}
+
+// WithTx runs fn with exclusive access to the store and restores the previous
+// state when fn fails.
+func (r *MemoryRepository) WithTx(ctx context.Context, fn TxFunc) error {
+	if r.inTx {
+		return fn(r)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	snapshot := r.store.clone()
+	if err := fn(&MemoryRepository{mu: r.mu, store: r.store, inTx: true}); err != nil {
+		r.store.restore(snapshot)
+		return err
+	}
+	return nil
+}
+
+func (r *MemoryRepository) GetTestById(ctx context.Context, input GetTestByIdInput) (GetTestByIdOutput, error) {
+	return GetTestByIdOutput{}, sql.ErrNoRows
+}
+
+func (r *MemoryRepository) RegisterUser(ctx context.Context, input RegisterUser) (string, error) {
+	defer r.lock()()
+
+	if _, ok := r.store.users[input.Phone]; ok {
+		return "", ErrConflict
+	}
+	r.store.users[input.Phone] = User{
+		UserID:    input.ID,
+		Phone:     input.Phone,
+		Name:      input.Name,
+		Password:  input.Password,
+		Version:   1,
+		CreatedAt: time.Now(),
+	}
+	return input.ID, nil
+}
+
+func (r *MemoryRepository) GetUserByPhone(ctx context.Context, phone string) (User, error) {
+	defer r.rlock()()
+
+	user, ok := r.store.users[phone]
+	if !ok {
+		return User{}, ErrUserNotFound
+	}
+	return user, nil
+}
+
+func (r *MemoryRepository) GetUserByEmail(ctx context.Context, email string) (User, error) {
+	defer r.rlock()()
+
+	for _, user := range r.store.users {
+		if user.Email.Valid && strings.EqualFold(user.Email.String, email) {
+			return user, nil
+		}
+	}
+	return User{}, ErrUserNotFound
+}
+
+func (r *MemoryRepository) IncrSuccessLogin(ctx context.Context, phone string) error {
+	defer r.lock()()
+
+	user, ok := r.store.users[phone]
+	if !ok {
+		return errors.New("login tracking failed")
+	}
+	user.SuccessLogin++
+	user.LastLoginAt = sql.NullTime{Time: time.Now(), Valid: true}
+	user.UpdatedAt = sql.NullTime{Time: time.Now(), Valid: true}
+	r.store.users[phone] = user
+	return nil
+}
+
+func (r *MemoryRepository) UpdateUser(ctx context.Context, input UpdateUser, identifier string) error {
+	defer r.lock()()
+
+	user, ok := r.store.users[identifier]
+	if !ok {
+		return errors.New("update user error")
+	}
+	if input.Version > 0 && input.Version != user.Version {
+		return ErrVersionConflict
+	}
+
+	if len(strings.TrimSpace(input.Phone)) > 0 && input.Phone != identifier {
+		if _, taken := r.store.users[input.Phone]; taken {
+			return ErrConflict
+		}
+		user.Phone = input.Phone
+	}
+	if len(strings.TrimSpace(input.Name)) > 0 {
+		user.Name = input.Name
+	}
+	if input.Email != nil {
+		if input.Email.Valid && r.store.emailTaken(input.Email.String, identifier) {
+			return ErrConflict
+		}
+		if input.Email.Valid != user.Email.Valid || !strings.EqualFold(input.Email.String, user.Email.String) {
+			user.EmailVerifiedAt = sql.NullTime{}
+		}
+		user.Email = *input.Email
+	}
+	if input.AvatarURL != nil {
+		user.AvatarURL = *input.AvatarURL
+	}
+	if input.Locale != nil {
+		user.Locale = *input.Locale
+	}
+	if input.Timezone != nil {
+		user.Timezone = *input.Timezone
+	}
+	user.UpdatedAt = sql.NullTime{Time: time.Now(), Valid: true}
+	user.Version++
+
+	delete(r.store.users, identifier)
+	r.store.users[user.Phone] = user
+	return nil
+}
+
+func (r *MemoryRepository) UpdatePassword(ctx context.Context, phone, password string) error {
+	defer r.lock()()
+
+	user, ok := r.store.users[phone]
+	if !ok {
+		return ErrUserNotFound
+	}
+	user.Password = password
+	user.UpdatedAt = sql.NullTime{Time: time.Now(), Valid: true}
+	r.store.users[phone] = user
+	return nil
+}
+
+func (r *MemoryRepository) CreateEmailVerification(ctx context.Context, input EmailVerification) error {
+	defer r.lock()()
+
+	if _, ok := r.store.userByID(input.UserID); !ok {
+		return errors.New("user not exists")
+	}
+	r.store.emailVerifications[input.UserID] = input
+	return nil
+}
+
+func (r *MemoryRepository) ConfirmEmailVerification(ctx context.Context, tokenHash string) (string, error) {
+	defer r.lock()()
+
+	for userID, verification := range r.store.emailVerifications {
+		if verification.TokenHash != tokenHash {
+			continue
+		}
+		delete(r.store.emailVerifications, userID)
+
+		user, ok := r.store.userByID(userID)
+		if !ok || !user.Email.Valid || !strings.EqualFold(user.Email.String, verification.Email) ||
+			!verification.ExpiresAt.After(time.Now()) {
+			return "", ErrVerificationNotFound
+		}
+		now := time.Now()
+		user.EmailVerifiedAt = sql.NullTime{Time: now, Valid: true}
+		user.UpdatedAt = sql.NullTime{Time: now, Valid: true}
+		user.Version++
+		r.store.users[user.Phone] = user
+		return userID, nil
+	}
+	return "", ErrVerificationNotFound
+}
+
+func (r *MemoryRepository) GetUserByID(ctx context.Context, id string) (User, error) {
+	defer r.rlock()()
+
+	user, ok := r.store.userByID(id)
+	if !ok {
+		return User{}, ErrUserNotFound
+	}
+	return user, nil
+}
+
+func (r *MemoryRepository) SaveTOTP(ctx context.Context, userID, secret string) error {
+	defer r.lock()()
+
+	if _, ok := r.store.userByID(userID); !ok {
+		return errors.New("user not exists")
+	}
+	if r.store.totp[userID].ConfirmedAt.Valid {
+		return ErrConflict
+	}
+	r.store.totp[userID] = TOTP{UserID: userID, Secret: secret}
+	return nil
+}
+
+func (r *MemoryRepository) GetTOTP(ctx context.Context, userID string) (TOTP, error) {
+	defer r.rlock()()
+
+	totp, ok := r.store.totp[userID]
+	if !ok {
+		return TOTP{}, ErrMFANotFound
+	}
+	return totp, nil
+}
+
+func (r *MemoryRepository) ConfirmTOTP(ctx context.Context, userID string, step int64, recoveryCodeHashes []string) error {
+	defer r.lock()()
+
+	totp, ok := r.store.totp[userID]
+	if !ok || totp.ConfirmedAt.Valid {
+		return ErrMFANotFound
+	}
+	totp.ConfirmedAt = sql.NullTime{Time: time.Now(), Valid: true}
+	totp.LastUsedStep = step
+	r.store.totp[userID] = totp
+
+	codes := make(map[string]bool, len(recoveryCodeHashes))
+	for _, hash := range recoveryCodeHashes {
+		codes[hash] = false
+	}
+	r.store.recoveryCodes[userID] = codes
+	return nil
+}
+
+func (r *MemoryRepository) UseTOTPStep(ctx context.Context, userID string, step int64) error {
+	defer r.lock()()
+
+	totp, ok := r.store.totp[userID]
+	if !ok || !totp.ConfirmedAt.Valid || totp.LastUsedStep >= step {
+		return ErrMFANotFound
+	}
+	totp.LastUsedStep = step
+	r.store.totp[userID] = totp
+	return nil
+}
+
+func (r *MemoryRepository) UseRecoveryCode(ctx context.Context, userID, codeHash string) error {
+	defer r.lock()()
+
+	used, ok := r.store.recoveryCodes[userID][codeHash]
+	if !ok || used {
+		return ErrMFANotFound
+	}
+	r.store.recoveryCodes[userID][codeHash] = true
+	return nil
+}
+
+func (r *MemoryRepository) CreateMFAChallenge(ctx context.Context, input MFAChallenge) error {
+	defer r.lock()()
+
+	if _, ok := r.store.userByID(input.UserID); !ok {
+		return errors.New("user not exists")
+	}
+	if _, ok := r.store.mfaChallenges[input.TokenHash]; ok {
+		return ErrConflict
+	}
+	r.store.mfaChallenges[input.TokenHash] = memoryMFAChallenge{MFAChallenge: input}
+	return nil
+}
+
+func (r *MemoryRepository) RecordMFAAttempt(ctx context.Context, tokenHash string, maxAttempts int) (string, error) {
+	defer r.lock()()
+
+	challenge, ok := r.store.mfaChallenges[tokenHash]
+	if !ok || !challenge.ExpiresAt.After(time.Now()) || challenge.attempts >= maxAttempts {
+		return "", ErrMFANotFound
+	}
+	challenge.attempts++
+	r.store.mfaChallenges[tokenHash] = challenge
+	return challenge.UserID, nil
+}
+
+func (r *MemoryRepository) DeleteMFAChallenge(ctx context.Context, tokenHash string) error {
+	defer r.lock()()
+
+	delete(r.store.mfaChallenges, tokenHash)
+	return nil
+}
+
+func (r *MemoryRepository) CreateSession(ctx context.Context, input Session) error {
+	defer r.lock()()
+
+	if _, ok := r.store.sessions[input.SessionID]; ok {
+		return ErrConflict
+	}
+	now := time.Now()
+	input.CreatedAt = now
+	input.LastSeenAt = now
+	r.store.sessions[input.SessionID] = memorySession{Session: input}
+	return nil
+}
+
+func (r *MemoryRepository) ListSessions(ctx context.Context, userID string) ([]Session, error) {
+	defer r.rlock()()
+
+	var sessions []Session
+	now := time.Now()
+	for _, session := range r.store.sessions {
+		if session.UserID == userID && session.live(now) {
+			sessions = append(sessions, session.Session)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		if !sessions[i].LastSeenAt.Equal(sessions[j].LastSeenAt) {
+			return sessions[i].LastSeenAt.After(sessions[j].LastSeenAt)
+		}
+		return sessions[i].CreatedAt.After(sessions[j].CreatedAt)
+	})
+	return sessions, nil
+}
+
+func (r *MemoryRepository) GetSession(ctx context.Context, sessionID string) (Session, error) {
+	defer r.rlock()()
+
+	session, ok := r.store.sessions[sessionID]
+	if !ok || !session.live(time.Now()) {
+		return Session{}, ErrSessionNotFound
+	}
+	return session.Session, nil
+}
+
+func (r *MemoryRepository) TouchSession(ctx context.Context, sessionID string) (Session, error) {
+	defer r.lock()()
+
+	now := time.Now()
+	session, ok := r.store.sessions[sessionID]
+	if !ok || !session.live(now) {
+		return Session{}, ErrSessionNotFound
+	}
+	if now.Sub(session.LastSeenAt) >= SessionSeenInterval {
+		session.LastSeenAt = now
+		r.store.sessions[sessionID] = session
+	}
+	return session.Session, nil
+}
+
+func (r *MemoryRepository) RevokeSession(ctx context.Context, userID, sessionID string) error {
+	defer r.lock()()
+
+	session, ok := r.store.sessions[sessionID]
+	if !ok || session.UserID != userID || !session.live(time.Now()) {
+		return ErrSessionNotFound
+	}
+	session.revoked = true
+	r.store.sessions[sessionID] = session
+	return nil
+}
+
+func (r *MemoryRepository) RevokeOtherSessions(ctx context.Context, userID, keepSessionID string) (int64, error) {
+	defer r.lock()()
+
+	var revoked int64
+	now := time.Now()
+	for id, session := range r.store.sessions {
+		if session.UserID != userID || id == keepSessionID || !session.live(now) {
+			continue
+		}
+		session.revoked = true
+		r.store.sessions[id] = session
+		revoked++
+	}
+	return revoked, nil
+}
+
+func (r *MemoryRepository) CreateWebAuthnChallenge(ctx context.Context, input WebAuthnChallenge) error {
+	defer r.lock()()
+
+	if _, ok := r.store.webAuthnChallenges[input.Challenge]; ok {
+		return ErrConflict
+	}
+	input.SessionData = append([]byte(nil), input.SessionData...)
+	r.store.webAuthnChallenges[input.Challenge] = input
+	return nil
+}
+
+func (r *MemoryRepository) ConsumeWebAuthnChallenge(ctx context.Context, challenge, ceremony string) (WebAuthnChallenge, error) {
+	defer r.lock()()
+
+	stored, ok := r.store.webAuthnChallenges[challenge]
+	if !ok || stored.Ceremony != ceremony {
+		return WebAuthnChallenge{}, ErrPasskeyNotFound
+	}
+	delete(r.store.webAuthnChallenges, challenge)
+	if !stored.ExpiresAt.After(time.Now()) {
+		return WebAuthnChallenge{}, ErrPasskeyNotFound
+	}
+	return stored, nil
+}
+
+func (r *MemoryRepository) CreatePasskey(ctx context.Context, input Passkey) error {
+	defer r.lock()()
+
+	key := string(input.CredentialID)
+	if _, ok := r.store.passkeys[key]; ok {
+		return ErrConflict
+	}
+	if _, ok := r.store.userByID(input.UserID); !ok {
+		return ErrUserNotFound
+	}
+	input.CredentialID = append([]byte(nil), input.CredentialID...)
+	input.PublicKey = append([]byte(nil), input.PublicKey...)
+	input.AAGUID = append([]byte(nil), input.AAGUID...)
+	input.Transports = append([]string{}, input.Transports...)
+	input.CloneWarning = false
+	input.CreatedAt = time.Now()
+	input.LastUsedAt = sql.NullTime{}
+	r.store.passkeys[key] = input
+	return nil
+}
+
+func (r *MemoryRepository) ListPasskeys(ctx context.Context, userID string) ([]Passkey, error) {
+	defer r.rlock()()
+
+	var passkeys []Passkey
+	for _, passkey := range r.store.passkeys {
+		if passkey.UserID == userID {
+			passkeys = append(passkeys, passkey)
+		}
+	}
+	sort.Slice(passkeys, func(i, j int) bool {
+		return passkeys[i].CreatedAt.Before(passkeys[j].CreatedAt)
+	})
+	return passkeys, nil
+}
+
+func (r *MemoryRepository) UpdatePasskeyUse(ctx context.Context, input Passkey) error {
+	defer r.lock()()
+
+	key := string(input.CredentialID)
+	passkey, ok := r.store.passkeys[key]
+	if !ok {
+		return ErrPasskeyNotFound
+	}
+	passkey.SignCount = input.SignCount
+	passkey.BackupState = input.BackupState
+	passkey.CloneWarning = input.CloneWarning
+	passkey.LastUsedAt = sql.NullTime{Time: time.Now(), Valid: true}
+	r.store.passkeys[key] = passkey
+	return nil
+}
+
+func (r *MemoryRepository) CreateLoginOTP(ctx context.Context, input LoginOTP) error {
+	defer r.lock()()
+
+	if input.UserID.Valid {
+		if _, ok := r.store.userByID(input.UserID.String); !ok {
+			return errors.New("user not exists")
+		}
+	}
+	input.Attempts = 0
+	r.store.loginOTPs[input.Phone] = append(r.store.loginOTPs[input.Phone],
+		memoryLoginOTP{LoginOTP: input, createdAt: time.Now()})
+	return nil
+}
+
+func (r *MemoryRepository) CountLoginOTPs(ctx context.Context, phone string, window time.Duration) (int, error) {
+	defer r.rlock()()
+
+	since := time.Now().Add(-window)
+	count := 0
+	for _, otp := range r.store.loginOTPs[phone] {
+		if otp.createdAt.After(since) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (r *MemoryRepository) RecordLoginOTPAttempt(ctx context.Context, phone string, maxAttempts int) (LoginOTP, error) {
+	defer r.lock()()
+
+	otps := r.store.loginOTPs[phone]
+	if len(otps) == 0 {
+		return LoginOTP{}, ErrOTPNotFound
+	}
+	otp := &otps[len(otps)-1]
+	if otp.consumed || !otp.ExpiresAt.After(time.Now()) || otp.Attempts >= maxAttempts {
+		return LoginOTP{}, ErrOTPNotFound
+	}
+	otp.Attempts++
+	return otp.LoginOTP, nil
+}
+
+func (r *MemoryRepository) ConsumeLoginOTP(ctx context.Context, id string) error {
+	defer r.lock()()
+
+	for _, otps := range r.store.loginOTPs {
+		for i := range otps {
+			if otps[i].ID == id && !otps[i].consumed {
+				otps[i].consumed = true
+				return nil
+			}
+		}
+	}
+	return ErrOTPNotFound
+}
+
+func (r *MemoryRepository) DeleteExpiredChallenges(ctx context.Context, otpWindow time.Duration) error {
+	defer r.lock()()
+
+	now := time.Now()
+	for tokenHash, challenge := range r.store.mfaChallenges {
+		if !challenge.ExpiresAt.After(now) {
+			delete(r.store.mfaChallenges, tokenHash)
+		}
+	}
+	for key, challenge := range r.store.webAuthnChallenges {
+		if !challenge.ExpiresAt.After(now) {
+			delete(r.store.webAuthnChallenges, key)
+		}
+	}
+	since := now.Add(-otpWindow)
+	for phone, otps := range r.store.loginOTPs {
+		kept := otps[:0]
+		for _, otp := range otps {
+			if otp.ExpiresAt.After(now) || otp.createdAt.After(since) {
+				kept = append(kept, otp)
+			}
+		}
+		if len(kept) == 0 {
+			delete(r.store.loginOTPs, phone)
+		} else {
+			r.store.loginOTPs[phone] = kept
+		}
+	}
+	return nil
+}
+
+func (r *MemoryRepository) CreateOAuthClient(ctx context.Context, input OAuthClient) error {
+	defer r.lock()()
+
+	if _, ok := r.store.oauthClients[input.ClientID]; ok {
+		return ErrConflict
+	}
+	if _, ok := r.store.userByID(input.OwnerID); !ok {
+		return ErrUserNotFound
+	}
+	input.RedirectURIs = append([]string{}, input.RedirectURIs...)
+	input.CreatedAt = time.Now()
+	r.store.oauthClients[input.ClientID] = input
+	return nil
+}
+
+func (r *MemoryRepository) GetOAuthClient(ctx context.Context, clientID string) (OAuthClient, error) {
+	defer r.rlock()()
+
+	client, ok := r.store.oauthClients[clientID]
+	if !ok {
+		return OAuthClient{}, ErrOAuthNotFound
+	}
+	client.RedirectURIs = append([]string{}, client.RedirectURIs...)
+	return client, nil
+}
+
+func (r *MemoryRepository) CreateAuthorizationCode(ctx context.Context, input AuthorizationCode) error {
+	defer r.lock()()
+
+	if _, ok := r.store.oauthClients[input.ClientID]; !ok {
+		return ErrOAuthNotFound
+	}
+	if _, ok := r.store.authorizationCodes[input.CodeHash]; ok {
+		return ErrConflict
+	}
+	r.store.authorizationCodes[input.CodeHash] = input
+	return nil
+}
+
+func (r *MemoryRepository) ConsumeAuthorizationCode(ctx context.Context, codeHash string) (AuthorizationCode, error) {
+	defer r.lock()()
+
+	code, ok := r.store.authorizationCodes[codeHash]
+	if !ok {
+		return AuthorizationCode{}, ErrOAuthNotFound
+	}
+	delete(r.store.authorizationCodes, codeHash)
+	if !code.ExpiresAt.After(time.Now()) {
+		return AuthorizationCode{}, ErrOAuthNotFound
+	}
+	return code, nil
+}
+
+func (r *MemoryRepository) GetOAuthConsent(ctx context.Context, userID, clientID string) (OAuthConsent, error) {
+	defer r.rlock()()
+
+	consent, ok := r.store.oauthConsents[memoryConsentKey{userID: userID, clientID: clientID}]
+	if !ok {
+		return OAuthConsent{}, ErrOAuthNotFound
+	}
+	consent.Scopes = append([]string{}, consent.Scopes...)
+	return consent, nil
+}
+
+func (r *MemoryRepository) SaveOAuthConsent(ctx context.Context, input OAuthConsent) error {
+	defer r.lock()()
+
+	if _, ok := r.store.oauthClients[input.ClientID]; !ok {
+		return ErrOAuthNotFound
+	}
+	input.Scopes = append([]string{}, input.Scopes...)
+	r.store.oauthConsents[memoryConsentKey{userID: input.UserID, clientID: input.ClientID}] = input
+	return nil
+}
+
+func (r *MemoryRepository) CreateMachineClient(ctx context.Context, input MachineClient) error {
+	defer r.lock()()
+
+	if _, ok := r.store.machineClients[input.ClientID]; ok {
+		return ErrConflict
+	}
+	input.Scopes = append([]string{}, input.Scopes...)
+	input.CreatedAt = time.Now()
+	r.store.machineClients[input.ClientID] = input
+	return nil
+}
+
+func (r *MemoryRepository) GetMachineClient(ctx context.Context, clientID string) (MachineClient, error) {
+	defer r.rlock()()
+
+	client, ok := r.store.machineClients[clientID]
+	if !ok {
+		return MachineClient{}, ErrOAuthNotFound
+	}
+	client.Scopes = append([]string{}, client.Scopes...)
+	return client, nil
+}
+
+func (r *MemoryRepository) ListMachineClients(ctx context.Context) ([]MachineClient, error) {
+	defer r.rlock()()
+
+	var clients []MachineClient
+	for _, client := range r.store.machineClients {
+		client.Scopes = append([]string{}, client.Scopes...)
+		clients = append(clients, client)
+	}
+	sort.Slice(clients, func(i, j int) bool {
+		if !clients[i].CreatedAt.Equal(clients[j].CreatedAt) {
+			return clients[i].CreatedAt.Before(clients[j].CreatedAt)
+		}
+		return clients[i].ClientID < clients[j].ClientID
+	})
+	return clients, nil
+}
+
+func (r *MemoryRepository) DeleteMachineClient(ctx context.Context, clientID string) error {
+	defer r.lock()()
+
+	if _, ok := r.store.machineClients[clientID]; !ok {
+		return ErrOAuthNotFound
+	}
+	delete(r.store.machineClients, clientID)
+	return nil
+}
@@ -0,0 +1,641 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// PgxRepository implements RepositoryInterface on a native pgx connection
+// pool. pgx prepares and caches statements per connection on its own, so the
+// fixed queries are passed as plain SQL.
+type PgxRepository struct {
+	Pool *pgxpool.Pool
+	// tx is set on the repository handed to a WithTx callback.
+	tx pgx.Tx
+}
+
+// pgxQuerier is implemented by both *pgxpool.Pool and pgx.Tx.
+type pgxQuerier interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
+
+func NewPgxRepository(opts NewRepositoryOptions) (*PgxRepository, error) {
+	cfg, err := pgxpool.ParseConfig(opts.Dsn)
+	if err != nil {
+		return nil, err
+	}
+	if opts.MaxOpenConns > 0 {
+		cfg.MaxConns = int32(opts.MaxOpenConns)
+	}
+	if opts.ConnMaxLifetime > 0 {
+		cfg.MaxConnLifetime = opts.ConnMaxLifetime
+	}
+	if opts.ConnMaxIdleTime > 0 {
+		cfg.MaxConnIdleTime = opts.ConnMaxIdleTime
+	}
+
+	pool, err := pgxpool.NewWithConfig(context.Background(), cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = pingWithRetry(pool.Ping, opts.ConnectRetries, opts.ConnectBackoff); err != nil {
+		pool.Close()
+		return nil, err
+	}
+
+	return &PgxRepository{
+		Pool: pool,
+	}, nil
+}
+
+func (r *PgxRepository) Close() error {
+	r.Pool.Close()
+	return nil
+}
+
+func (r *PgxRepository) querier() pgxQuerier {
+	if r.tx != nil {
+		return r.tx
+	}
+	return r.Pool
+}
+
+// WithTx runs fn in a serializable transaction, committing when fn returns
+// nil and retrying on serialization failures and deadlocks. Calling WithTx on
+// a repository that is already scoped to a transaction joins it.
+func (r *PgxRepository) WithTx(ctx context.Context, fn TxFunc) (err error) {
+	if r.tx != nil {
+		return fn(r)
+	}
+
+	ctx, span := tracer.Start(ctx, "repository.WithTx")
+	defer func() { endSpan(span, err) }()
+
+	return retryTx(ctx, func() error {
+		tx, err := r.Pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.Serializable})
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = tx.Rollback(ctx)
+		}()
+
+		if err = fn(&PgxRepository{Pool: r.Pool, tx: tx}); err != nil {
+			return err
+		}
+		return tx.Commit(ctx)
+	})
+}
+
+// execInTx runs fn in the transaction the repository is scoped to, or in a new
+// transaction that is committed when fn succeeds.
+func (r *PgxRepository) execInTx(ctx context.Context, fn func(tx pgx.Tx) error) error {
+	if r.tx != nil {
+		return fn(r.tx)
+	}
+
+	tx, err := r.Pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	if err = fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+func (r *PgxRepository) GetTestById(ctx context.Context, input GetTestByIdInput) (output GetTestByIdOutput, err error) {
+	ctx, span := startSpan(ctx, "repository.GetTestById", "SELECT name FROM test WHERE id = $1")
+	defer func() { endSpan(span, err) }()
+
+	err = r.querier().QueryRow(ctx, "SELECT name FROM test WHERE id = $1", input.Id).Scan(&output.Name)
+	return
+}
+
+func (r *PgxRepository) RegisterUser(ctx context.Context, input RegisterUser) (id string, err error) {
+	ctx, span := startSpan(ctx, "repository.RegisterUser", qInsertUser)
+	defer func() { endSpan(span, err) }()
+
+	tag, err := r.querier().Exec(ctx, qInsertUser, input.ID, input.Phone, input.Name, input.Password)
+	if err != nil {
+		return "", mapError(err)
+	}
+
+	if tag.RowsAffected() < 1 {
+		return "", errors.New("fail register")
+	}
+
+	return input.ID, nil
+}
+
+func (r *PgxRepository) GetUserByPhone(ctx context.Context, phone string) (user User, err error) {
+	ctx, span := startSpan(ctx, "repository.GetUserByPhone", qGetUserByPhone)
+	defer func() { endSpan(span, err) }()
+
+	user, err = scanUser(r.querier().QueryRow(ctx, qGetUserByPhone, phone))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return User{}, ErrUserNotFound
+		}
+		return User{}, err
+	}
+	return user, nil
+}
+
+func (r *PgxRepository) GetUserByEmail(ctx context.Context, email string) (user User, err error) {
+	ctx, span := startSpan(ctx, "repository.GetUserByEmail", qGetUserByEmail)
+	defer func() { endSpan(span, err) }()
+
+	user, err = scanUser(r.querier().QueryRow(ctx, qGetUserByEmail, email))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return User{}, ErrUserNotFound
+		}
+		return User{}, err
+	}
+	return user, nil
+}
+
+func (r *PgxRepository) IncrSuccessLogin(ctx context.Context, phone string) (err error) {
+	ctx, span := startSpan(ctx, "repository.IncrSuccessLogin", qIncrementLoginCount)
+	defer func() { endSpan(span, err) }()
+
+	return r.execInTx(ctx, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx, qIncrementLoginCount, phone)
+		if err != nil {
+			return err
+		}
+
+		if tag.RowsAffected() < 1 {
+			return errors.New("login tracking failed")
+		}
+		return nil
+	})
+}
+
+func (r *PgxRepository) UpdateUser(ctx context.Context, input UpdateUser, identifier string) (err error) {
+	query, args := buildUpdateUserQuery(input, identifier)
+
+	ctx, span := startSpan(ctx, "repository.UpdateUser", query)
+	defer func() { endSpan(span, err) }()
+
+	return r.execInTx(ctx, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx, query, args...)
+		if err != nil {
+			return mapError(err)
+		}
+
+		if tag.RowsAffected() < 1 {
+			var exists bool
+			if input.Version > 0 {
+				if err = tx.QueryRow(ctx, qUserExists, identifier).Scan(&exists); err != nil {
+					return err
+				}
+			}
+			if exists {
+				return ErrVersionConflict
+			}
+			return errors.New("update user error")
+		}
+		return nil
+	})
+}
+
+func (r *PgxRepository) UpdatePassword(ctx context.Context, phone, password string) (err error) {
+	ctx, span := startSpan(ctx, "repository.UpdatePassword", qUpdatePassword)
+	defer func() { endSpan(span, err) }()
+
+	tag, err := r.querier().Exec(ctx, qUpdatePassword, phone, password)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() < 1 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+func (r *PgxRepository) CreateEmailVerification(ctx context.Context, input EmailVerification) (err error) {
+	ctx, span := startSpan(ctx, "repository.CreateEmailVerification", qUpsertEmailVerification)
+	defer func() { endSpan(span, err) }()
+
+	_, err = r.querier().Exec(ctx, qUpsertEmailVerification, input.UserID, input.Email, input.TokenHash, input.ExpiresAt)
+	return err
+}
+
+func (r *PgxRepository) ConfirmEmailVerification(ctx context.Context, tokenHash string) (userID string, err error) {
+	ctx, span := startSpan(ctx, "repository.ConfirmEmailVerification", qConfirmEmailVerification)
+	defer func() { endSpan(span, err) }()
+
+	err = r.querier().QueryRow(ctx, qConfirmEmailVerification, tokenHash).Scan(&userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", ErrVerificationNotFound
+	}
+	return userID, err
+}
+
+func (r *PgxRepository) GetUserByID(ctx context.Context, id string) (user User, err error) {
+	ctx, span := startSpan(ctx, "repository.GetUserByID", qGetUserByID)
+	defer func() { endSpan(span, err) }()
+
+	user, err = scanUser(r.querier().QueryRow(ctx, qGetUserByID, id))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return User{}, ErrUserNotFound
+		}
+		return User{}, err
+	}
+	return user, nil
+}
+
+func (r *PgxRepository) SaveTOTP(ctx context.Context, userID, secret string) (err error) {
+	ctx, span := startSpan(ctx, "repository.SaveTOTP", qSaveTOTP)
+	defer func() { endSpan(span, err) }()
+
+	return r.execAffectingOne(ctx, qSaveTOTP, ErrConflict, userID, secret)
+}
+
+func (r *PgxRepository) GetTOTP(ctx context.Context, userID string) (totp TOTP, err error) {
+	ctx, span := startSpan(ctx, "repository.GetTOTP", qGetTOTP)
+	defer func() { endSpan(span, err) }()
+
+	err = r.querier().QueryRow(ctx, qGetTOTP, userID).Scan(&totp.UserID, &totp.Secret, &totp.ConfirmedAt, &totp.LastUsedStep)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return TOTP{}, ErrMFANotFound
+	}
+	return totp, err
+}
+
+func (r *PgxRepository) ConfirmTOTP(ctx context.Context, userID string, step int64, recoveryCodeHashes []string) (err error) {
+	ctx, span := startSpan(ctx, "repository.ConfirmTOTP", qConfirmTOTP)
+	defer func() { endSpan(span, err) }()
+
+	return r.execInTx(ctx, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx, qConfirmTOTP, userID, step)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() < 1 {
+			return ErrMFANotFound
+		}
+
+		if _, err = tx.Exec(ctx, qDeleteRecoveryCodes, userID); err != nil {
+			return err
+		}
+		for _, hash := range recoveryCodeHashes {
+			if _, err = tx.Exec(ctx, qInsertRecoveryCode, userID, hash); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (r *PgxRepository) UseTOTPStep(ctx context.Context, userID string, step int64) (err error) {
+	ctx, span := startSpan(ctx, "repository.UseTOTPStep", qUseTOTPStep)
+	defer func() { endSpan(span, err) }()
+
+	return r.execAffectingOne(ctx, qUseTOTPStep, ErrMFANotFound, userID, step)
+}
+
+func (r *PgxRepository) UseRecoveryCode(ctx context.Context, userID, codeHash string) (err error) {
+	ctx, span := startSpan(ctx, "repository.UseRecoveryCode", qUseRecoveryCode)
+	defer func() { endSpan(span, err) }()
+
+	return r.execAffectingOne(ctx, qUseRecoveryCode, ErrMFANotFound, userID, codeHash)
+}
+
+func (r *PgxRepository) CreateMFAChallenge(ctx context.Context, input MFAChallenge) (err error) {
+	ctx, span := startSpan(ctx, "repository.CreateMFAChallenge", qInsertMFAChallenge)
+	defer func() { endSpan(span, err) }()
+
+	_, err = r.querier().Exec(ctx, qInsertMFAChallenge, input.TokenHash, input.UserID, input.ExpiresAt)
+	return err
+}
+
+func (r *PgxRepository) RecordMFAAttempt(ctx context.Context, tokenHash string, maxAttempts int) (userID string, err error) {
+	ctx, span := startSpan(ctx, "repository.RecordMFAAttempt", qRecordMFAAttempt)
+	defer func() { endSpan(span, err) }()
+
+	err = r.querier().QueryRow(ctx, qRecordMFAAttempt, tokenHash, maxAttempts).Scan(&userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", ErrMFANotFound
+	}
+	return userID, err
+}
+
+func (r *PgxRepository) DeleteMFAChallenge(ctx context.Context, tokenHash string) (err error) {
+	ctx, span := startSpan(ctx, "repository.DeleteMFAChallenge", qDeleteMFAChallenge)
+	defer func() { endSpan(span, err) }()
+
+	_, err = r.querier().Exec(ctx, qDeleteMFAChallenge, tokenHash)
+	return err
+}
+
+func (r *PgxRepository) CreateWebAuthnChallenge(ctx context.Context, input WebAuthnChallenge) (err error) {
+	ctx, span := startSpan(ctx, "repository.CreateWebAuthnChallenge", qInsertWebAuthnChallenge)
+	defer func() { endSpan(span, err) }()
+
+	_, err = r.querier().Exec(ctx, qInsertWebAuthnChallenge, input.Challenge, input.Ceremony, input.UserID, input.SessionData, input.ExpiresAt)
+	return err
+}
+
+func (r *PgxRepository) ConsumeWebAuthnChallenge(ctx context.Context, challenge, ceremony string) (output WebAuthnChallenge, err error) {
+	ctx, span := startSpan(ctx, "repository.ConsumeWebAuthnChallenge", qConsumeWebAuthnChallenge)
+	defer func() { endSpan(span, err) }()
+
+	err = r.querier().QueryRow(ctx, qConsumeWebAuthnChallenge, challenge, ceremony).
+		Scan(&output.Challenge, &output.Ceremony, &output.UserID, &output.SessionData, &output.ExpiresAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return WebAuthnChallenge{}, ErrPasskeyNotFound
+	}
+	return output, err
+}
+
+func (r *PgxRepository) CreatePasskey(ctx context.Context, input Passkey) (err error) {
+	ctx, span := startSpan(ctx, "repository.CreatePasskey", qInsertPasskey)
+	defer func() { endSpan(span, err) }()
+
+	_, err = r.querier().Exec(ctx, qInsertPasskey, input.CredentialID, input.UserID, input.PublicKey, input.AttestationType,
+		stringArray(input.Transports), input.AAGUID, input.SignCount, input.BackupEligible, input.BackupState)
+	return mapError(err)
+}
+
+func (r *PgxRepository) ListPasskeys(ctx context.Context, userID string) (passkeys []Passkey, err error) {
+	ctx, span := startSpan(ctx, "repository.ListPasskeys", qListPasskeys)
+	defer func() { endSpan(span, err) }()
+
+	rows, err := r.querier().Query(ctx, qListPasskeys, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		passkey, err := scanPasskey(rows, func(dest any) any { return dest })
+		if err != nil {
+			return nil, err
+		}
+		passkeys = append(passkeys, passkey)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return passkeys, nil
+}
+
+func (r *PgxRepository) UpdatePasskeyUse(ctx context.Context, input Passkey) (err error) {
+	ctx, span := startSpan(ctx, "repository.UpdatePasskeyUse", qUpdatePasskeyUse)
+	defer func() { endSpan(span, err) }()
+
+	return r.execAffectingOne(ctx, qUpdatePasskeyUse, ErrPasskeyNotFound,
+		input.CredentialID, input.SignCount, input.BackupState, input.CloneWarning)
+}
+
+func (r *PgxRepository) CreateLoginOTP(ctx context.Context, input LoginOTP) (err error) {
+	ctx, span := startSpan(ctx, "repository.CreateLoginOTP", qInsertLoginOTP)
+	defer func() { endSpan(span, err) }()
+
+	_, err = r.querier().Exec(ctx, qInsertLoginOTP, input.ID, input.Phone, input.UserID, input.CodeHash, input.ExpiresAt)
+	return err
+}
+
+func (r *PgxRepository) CountLoginOTPs(ctx context.Context, phone string, window time.Duration) (count int, err error) {
+	ctx, span := startSpan(ctx, "repository.CountLoginOTPs", qCountLoginOTPs)
+	defer func() { endSpan(span, err) }()
+
+	err = r.querier().QueryRow(ctx, qCountLoginOTPs, phone, window.Seconds()).Scan(&count)
+	return count, err
+}
+
+func (r *PgxRepository) RecordLoginOTPAttempt(ctx context.Context, phone string, maxAttempts int) (otp LoginOTP, err error) {
+	ctx, span := startSpan(ctx, "repository.RecordLoginOTPAttempt", qRecordLoginOTPAttempt)
+	defer func() { endSpan(span, err) }()
+
+	err = r.querier().QueryRow(ctx, qRecordLoginOTPAttempt, phone, maxAttempts).
+		Scan(&otp.ID, &otp.Phone, &otp.UserID, &otp.CodeHash, &otp.Attempts, &otp.ExpiresAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return LoginOTP{}, ErrOTPNotFound
+	}
+	return otp, err
+}
+
+func (r *PgxRepository) ConsumeLoginOTP(ctx context.Context, id string) (err error) {
+	ctx, span := startSpan(ctx, "repository.ConsumeLoginOTP", qConsumeLoginOTP)
+	defer func() { endSpan(span, err) }()
+
+	return r.execAffectingOne(ctx, qConsumeLoginOTP, ErrOTPNotFound, id)
+}
+
+func (r *PgxRepository) DeleteExpiredChallenges(ctx context.Context, otpWindow time.Duration) (err error) {
+	ctx, span := startSpan(ctx, "repository.DeleteExpiredChallenges", qDeleteExpiredChallenges)
+	defer func() { endSpan(span, err) }()
+
+	_, err = r.querier().Exec(ctx, qDeleteExpiredChallenges, otpWindow.Seconds())
+	return err
+}
+
+func (r *PgxRepository) CreateOAuthClient(ctx context.Context, input OAuthClient) (err error) {
+	ctx, span := startSpan(ctx, "repository.CreateOAuthClient", qInsertOAuthClient)
+	defer func() { endSpan(span, err) }()
+
+	_, err = r.querier().Exec(ctx, qInsertOAuthClient, input.ClientID, input.SecretHash, input.Name,
+		stringArray(input.RedirectURIs), input.OwnerID)
+	return mapError(err)
+}
+
+func (r *PgxRepository) GetOAuthClient(ctx context.Context, clientID string) (client OAuthClient, err error) {
+	ctx, span := startSpan(ctx, "repository.GetOAuthClient", qGetOAuthClient)
+	defer func() { endSpan(span, err) }()
+
+	client, err = scanOAuthClient(r.querier().QueryRow(ctx, qGetOAuthClient, clientID), func(dest any) any { return dest })
+	if errors.Is(err, pgx.ErrNoRows) {
+		return OAuthClient{}, ErrOAuthNotFound
+	}
+	return client, err
+}
+
+func (r *PgxRepository) CreateAuthorizationCode(ctx context.Context, input AuthorizationCode) (err error) {
+	ctx, span := startSpan(ctx, "repository.CreateAuthorizationCode", qInsertAuthorizationCode)
+	defer func() { endSpan(span, err) }()
+
+	_, err = r.querier().Exec(ctx, qInsertAuthorizationCode, input.CodeHash, input.ClientID, input.UserID,
+		input.RedirectURI, input.Scope, input.Nonce, input.CodeChallenge, input.ExpiresAt)
+	return err
+}
+
+func (r *PgxRepository) ConsumeAuthorizationCode(ctx context.Context, codeHash string) (code AuthorizationCode, err error) {
+	ctx, span := startSpan(ctx, "repository.ConsumeAuthorizationCode", qConsumeAuthorizationCode)
+	defer func() { endSpan(span, err) }()
+
+	code, err = scanAuthorizationCode(r.querier().QueryRow(ctx, qConsumeAuthorizationCode, codeHash))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return AuthorizationCode{}, ErrOAuthNotFound
+	}
+	return code, err
+}
+
+func (r *PgxRepository) GetOAuthConsent(ctx context.Context, userID, clientID string) (consent OAuthConsent, err error) {
+	ctx, span := startSpan(ctx, "repository.GetOAuthConsent", qGetOAuthConsent)
+	defer func() { endSpan(span, err) }()
+
+	err = r.querier().QueryRow(ctx, qGetOAuthConsent, userID, clientID).
+		Scan(&consent.UserID, &consent.ClientID, &consent.Scopes)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return OAuthConsent{}, ErrOAuthNotFound
+	}
+	return consent, err
+}
+
+func (r *PgxRepository) SaveOAuthConsent(ctx context.Context, input OAuthConsent) (err error) {
+	ctx, span := startSpan(ctx, "repository.SaveOAuthConsent", qSaveOAuthConsent)
+	defer func() { endSpan(span, err) }()
+
+	_, err = r.querier().Exec(ctx, qSaveOAuthConsent, input.UserID, input.ClientID, stringArray(input.Scopes))
+	return err
+}
+
+func (r *PgxRepository) CreateSession(ctx context.Context, input Session) (err error) {
+	ctx, span := startSpan(ctx, "repository.CreateSession", qInsertSession)
+	defer func() { endSpan(span, err) }()
+
+	_, err = r.querier().Exec(ctx, qInsertSession, input.SessionID, input.UserID, input.UserAgent, input.IP, input.DeviceName, input.ExpiresAt)
+	return err
+}
+
+func (r *PgxRepository) CreateMachineClient(ctx context.Context, input MachineClient) (err error) {
+	ctx, span := startSpan(ctx, "repository.CreateMachineClient", qInsertMachineClient)
+	defer func() { endSpan(span, err) }()
+
+	_, err = r.querier().Exec(ctx, qInsertMachineClient, input.ClientID, input.SecretHash, input.Name,
+		stringArray(input.Scopes), input.CreatedBy)
+	return mapError(err)
+}
+
+func (r *PgxRepository) GetMachineClient(ctx context.Context, clientID string) (client MachineClient, err error) {
+	ctx, span := startSpan(ctx, "repository.GetMachineClient", qGetMachineClient)
+	defer func() { endSpan(span, err) }()
+
+	client, err = scanMachineClient(r.querier().QueryRow(ctx, qGetMachineClient, clientID), func(dest any) any { return dest })
+	if errors.Is(err, pgx.ErrNoRows) {
+		return MachineClient{}, ErrOAuthNotFound
+	}
+	return client, err
+}
+
+func (r *PgxRepository) ListMachineClients(ctx context.Context) (clients []MachineClient, err error) {
+	ctx, span := startSpan(ctx, "repository.ListMachineClients", qListMachineClients)
+	defer func() { endSpan(span, err) }()
+
+	rows, err := r.querier().Query(ctx, qListMachineClients)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		client, err := scanMachineClient(rows, func(dest any) any { return dest })
+		if err != nil {
+			return nil, err
+		}
+		clients = append(clients, client)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return clients, nil
+}
+
+func (r *PgxRepository) DeleteMachineClient(ctx context.Context, clientID string) (err error) {
+	ctx, span := startSpan(ctx, "repository.DeleteMachineClient", qDeleteMachineClient)
+	defer func() { endSpan(span, err) }()
+
+	return r.execAffectingOne(ctx, qDeleteMachineClient, ErrOAuthNotFound, clientID)
+}
+
+func (r *PgxRepository) ListSessions(ctx context.Context, userID string) (sessions []Session, err error) {
+	ctx, span := startSpan(ctx, "repository.ListSessions", qListSessions)
+	defer func() { endSpan(span, err) }()
+
+	rows, err := r.querier().Query(ctx, qListSessions, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+func (r *PgxRepository) GetSession(ctx context.Context, sessionID string) (session Session, err error) {
+	ctx, span := startSpan(ctx, "repository.GetSession", qGetSession)
+	defer func() { endSpan(span, err) }()
+
+	session, err = scanSession(r.querier().QueryRow(ctx, qGetSession, sessionID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Session{}, ErrSessionNotFound
+	}
+	return session, err
+}
+
+func (r *PgxRepository) TouchSession(ctx context.Context, sessionID string) (session Session, err error) {
+	ctx, span := startSpan(ctx, "repository.TouchSession", qTouchSession)
+	defer func() { endSpan(span, err) }()
+
+	session, err = scanSession(r.querier().QueryRow(ctx, qTouchSession, sessionID, SessionSeenInterval.Seconds()))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Session{}, ErrSessionNotFound
+	}
+	return session, err
+}
+
+func (r *PgxRepository) RevokeSession(ctx context.Context, userID, sessionID string) (err error) {
+	ctx, span := startSpan(ctx, "repository.RevokeSession", qRevokeSession)
+	defer func() { endSpan(span, err) }()
+
+	return r.execAffectingOne(ctx, qRevokeSession, ErrSessionNotFound, userID, sessionID)
+}
+
+func (r *PgxRepository) RevokeOtherSessions(ctx context.Context, userID, keepSessionID string) (revoked int64, err error) {
+	ctx, span := startSpan(ctx, "repository.RevokeOtherSessions", qRevokeOtherSessions)
+	defer func() { endSpan(span, err) }()
+
+	tag, err := r.querier().Exec(ctx, qRevokeOtherSessions, userID, keepSessionID)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// execAffectingOne runs query and returns notFound when it changed no row.
+func (r *PgxRepository) execAffectingOne(ctx context.Context, query string, notFound error, args ...any) error {
+	tag, err := r.querier().Exec(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() < 1 {
+		return notFound
+	}
+	return nil
+}
@@ -1,24 +1,459 @@
 package repository
 
-var (
-	qInsertUser = `
-		INSERT INTO users(id, phone, name, password) 
-		VALUES ($1, $2, $3, $4);`
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
 
-	qGetUserByPhone = `
-		SELECT
+const userColumns = `
 		    id,
 		    phone,
 		    name,
 		    password,
+		    email,
+		    email_verified_at,
+		    avatar_url,
+		    locale,
+		    timezone,
+		    success_login,
+		    last_login_at,
+		    version,
 		    created_at,
-		    updated_at
+		    updated_at`
+
+var (
+	qInsertUser = `
+		INSERT INTO users(id, phone, name, password) 
+		VALUES ($1, $2, $3, $4);`
+
+	qGetUserByPhone = `
+		SELECT` + userColumns + `
 		FROM users
 		WHERE phone = $1;`
 
+	qGetUserByEmail = `
+		SELECT` + userColumns + `
+		FROM users
+		WHERE lower(email) = lower($1);`
+
+	qGetUserByID = `
+		SELECT` + userColumns + `
+		FROM users
+		WHERE id = $1;`
+
+	qUserExists = `
+		SELECT EXISTS(SELECT 1 FROM users WHERE phone = $1);`
+
 	qIncrementLoginCount = `
 		UPDATE users
 		SET success_login = success_login + 1,
+		    last_login_at = now(),
+		    updated_at = now()
+		WHERE phone = $1;`
+
+	qUpdatePassword = `
+		UPDATE users
+		SET password = $2,
 		    updated_at = now()
 		WHERE phone = $1;`
+
+	qUpsertEmailVerification = `
+		INSERT INTO email_verifications(user_id, email, token_hash, expires_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_id) DO UPDATE
+		SET email = EXCLUDED.email,
+		    token_hash = EXCLUDED.token_hash,
+		    expires_at = EXCLUDED.expires_at,
+		    created_at = now();`
+
+	// The token is consumed even when expired or when the user changed the
+	// email in the meantime; only a still valid token marks it verified.
+	qConfirmEmailVerification = `
+		WITH verification AS (
+		    DELETE FROM email_verifications
+		    WHERE token_hash = $1
+		    RETURNING user_id, email, expires_at
+		)
+		UPDATE users u
+		SET email_verified_at = now(),
+		    updated_at = now(),
+		    version = u.version + 1
+		FROM verification v
+		WHERE u.id = v.user_id
+		  AND lower(u.email) = lower(v.email)
+		  AND v.expires_at > now()
+		RETURNING u.id;`
+
+	// A confirmed secret is never replaced.
+	qSaveTOTP = `
+		INSERT INTO user_totp(user_id, secret)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE
+		SET secret = EXCLUDED.secret,
+		    last_used_step = 0,
+		    created_at = now()
+		WHERE user_totp.confirmed_at IS NULL;`
+
+	qGetTOTP = `
+		SELECT user_id, secret, confirmed_at, last_used_step
+		FROM user_totp
+		WHERE user_id = $1;`
+
+	qConfirmTOTP = `
+		UPDATE user_totp
+		SET confirmed_at = now(),
+		    last_used_step = $2
+		WHERE user_id = $1
+		  AND confirmed_at IS NULL;`
+
+	qUseTOTPStep = `
+		UPDATE user_totp
+		SET last_used_step = $2
+		WHERE user_id = $1
+		  AND confirmed_at IS NOT NULL
+		  AND last_used_step < $2;`
+
+	qDeleteRecoveryCodes = `
+		DELETE FROM mfa_recovery_codes
+		WHERE user_id = $1;`
+
+	qInsertRecoveryCode = `
+		INSERT INTO mfa_recovery_codes(user_id, code_hash)
+		VALUES ($1, $2);`
+
+	qUseRecoveryCode = `
+		UPDATE mfa_recovery_codes
+		SET used_at = now()
+		WHERE user_id = $1
+		  AND code_hash = $2
+		  AND used_at IS NULL;`
+
+	qInsertMFAChallenge = `
+		INSERT INTO mfa_challenges(token_hash, user_id, expires_at)
+		VALUES ($1, $2, $3);`
+
+	qRecordMFAAttempt = `
+		UPDATE mfa_challenges
+		SET attempts = attempts + 1
+		WHERE token_hash = $1
+		  AND expires_at > now()
+		  AND attempts < $2
+		RETURNING user_id;`
+
+	qDeleteMFAChallenge = `
+		DELETE FROM mfa_challenges
+		WHERE token_hash = $1;`
+
+	qInsertWebAuthnChallenge = `
+		INSERT INTO webauthn_challenges(challenge, ceremony, user_id, session_data, expires_at)
+		VALUES ($1, $2, $3, $4, $5);`
+
+	// The challenge is consumed even when expired; only a live one is
+	// returned.
+	qConsumeWebAuthnChallenge = `
+		WITH challenge AS (
+		    DELETE FROM webauthn_challenges
+		    WHERE challenge = $1
+		      AND ceremony = $2
+		    RETURNING challenge, ceremony, user_id, session_data, expires_at
+		)
+		SELECT challenge, ceremony, user_id::text, session_data, expires_at
+		FROM challenge
+		WHERE expires_at > now();`
+
+	qInsertPasskey = `
+		INSERT INTO passkeys(credential_id, user_id, public_key, attestation_type, transports, aaguid,
+		                     sign_count, backup_eligible, backup_state)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9);`
+
+	qListPasskeys = `
+		SELECT credential_id, user_id::text, public_key, attestation_type, transports, aaguid,
+		       sign_count, backup_eligible, backup_state, clone_warning, created_at, last_used_at
+		FROM passkeys
+		WHERE user_id = $1
+		ORDER BY created_at;`
+
+	qUpdatePasskeyUse = `
+		UPDATE passkeys
+		SET sign_count = $2,
+		    backup_state = $3,
+		    clone_warning = $4,
+		    last_used_at = now()
+		WHERE credential_id = $1;`
+
+	qInsertLoginOTP = `
+		INSERT INTO login_otps(id, phone, user_id, code_hash, expires_at)
+		VALUES ($1, $2, $3, $4, $5);`
+
+	qCountLoginOTPs = `
+		SELECT count(*)
+		FROM login_otps
+		WHERE phone = $1
+		  AND created_at > now() - make_interval(secs => $2);`
+
+	// Only the most recent code of a phone can be used; requesting a new
+	// one retires the previous.
+	qRecordLoginOTPAttempt = `
+		UPDATE login_otps
+		SET attempts = attempts + 1
+		WHERE id = (
+		    SELECT id
+		    FROM login_otps
+		    WHERE phone = $1
+		    ORDER BY created_at DESC
+		    LIMIT 1
+		)
+		  AND consumed_at IS NULL
+		  AND expires_at > now()
+		  AND attempts < $2
+		RETURNING id, phone, user_id::text, code_hash, attempts, expires_at;`
+
+	qConsumeLoginOTP = `
+		UPDATE login_otps
+		SET consumed_at = now()
+		WHERE id = $1
+		  AND consumed_at IS NULL;`
+
+	qDeleteExpiredChallenges = `
+		WITH mfa AS (
+		    DELETE FROM mfa_challenges
+		    WHERE expires_at <= now()
+		), webauthn AS (
+		    DELETE FROM webauthn_challenges
+		    WHERE expires_at <= now()
+		)
+		DELETE FROM login_otps
+		WHERE expires_at <= now()
+		  AND created_at <= now() - make_interval(secs => $1);`
+
+	qInsertOAuthClient = `
+		INSERT INTO oauth_clients(id, secret_hash, name, redirect_uris, owner_id)
+		VALUES ($1, $2, $3, $4, $5);`
+
+	qGetOAuthClient = `
+		SELECT id, secret_hash, name, redirect_uris, owner_id, created_at
+		FROM oauth_clients
+		WHERE id = $1;`
+
+	qInsertAuthorizationCode = `
+		INSERT INTO oauth_authorization_codes(code_hash, client_id, user_id, redirect_uri, scope, nonce,
+		                                      code_challenge, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8);`
+
+	// The code is consumed even when expired; only a live one is returned.
+	qConsumeAuthorizationCode = `
+		WITH code AS (
+		    DELETE FROM oauth_authorization_codes
+		    WHERE code_hash = $1
+		    RETURNING code_hash, client_id, user_id, redirect_uri, scope, nonce, code_challenge, expires_at
+		)
+		SELECT code_hash, client_id, user_id, redirect_uri, scope, nonce, code_challenge, expires_at
+		FROM code
+		WHERE expires_at > now();`
+
+	qGetOAuthConsent = `
+		SELECT user_id, client_id, scopes
+		FROM oauth_consents
+		WHERE user_id = $1
+		  AND client_id = $2;`
+
+	qSaveOAuthConsent = `
+		INSERT INTO oauth_consents(user_id, client_id, scopes)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id, client_id) DO UPDATE
+		SET scopes = EXCLUDED.scopes,
+		    updated_at = now();`
+
+	qInsertMachineClient = `
+		INSERT INTO machine_clients(id, secret_hash, name, scopes, created_by)
+		VALUES ($1, $2, $3, $4, $5);`
+
+	qGetMachineClient = `
+		SELECT id, secret_hash, name, scopes, created_by, created_at
+		FROM machine_clients
+		WHERE id = $1;`
+
+	qListMachineClients = `
+		SELECT id, secret_hash, name, scopes, created_by, created_at
+		FROM machine_clients
+		ORDER BY created_at, id;`
+
+	qDeleteMachineClient = `
+		DELETE FROM machine_clients
+		WHERE id = $1;`
+
+	qInsertSession = `
+		INSERT INTO sessions(id, user_id, user_agent, ip, device_name, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6);`
+
+	qListSessions = `
+		SELECT id, user_id, user_agent, ip, device_name, created_at, last_seen_at, expires_at
+		FROM sessions
+		WHERE user_id = $1
+		  AND revoked_at IS NULL
+		  AND expires_at > now()
+		ORDER BY last_seen_at DESC, created_at DESC;`
+
+	qGetSession = `
+		SELECT id, user_id, user_agent, ip, device_name, created_at, last_seen_at, expires_at
+		FROM sessions
+		WHERE id = $1
+		  AND revoked_at IS NULL
+		  AND expires_at > now();`
+
+	qTouchSession = `
+		WITH live AS (
+			SELECT id, user_id, user_agent, ip, device_name, created_at, last_seen_at, expires_at
+			FROM sessions
+			WHERE id = $1
+			  AND revoked_at IS NULL
+			  AND expires_at > now()
+		), touched AS (
+			UPDATE sessions
+			SET last_seen_at = now()
+			FROM live
+			WHERE sessions.id = live.id
+			  AND live.last_seen_at <= now() - make_interval(secs => $2)
+			RETURNING sessions.last_seen_at
+		)
+		SELECT id, user_id, user_agent, ip, device_name, created_at,
+		       COALESCE((SELECT last_seen_at FROM touched), live.last_seen_at), expires_at
+		FROM live;`
+
+	qRevokeSession = `
+		UPDATE sessions
+		SET revoked_at = now()
+		WHERE user_id = $1
+		  AND id = $2
+		  AND revoked_at IS NULL
+		  AND expires_at > now();`
+
+	qRevokeOtherSessions = `
+		UPDATE sessions
+		SET revoked_at = now()
+		WHERE user_id = $1
+		  AND id <> $2
+		  AND revoked_at IS NULL
+		  AND expires_at > now();`
 )
+
+// scanUser reads a row selected with userColumns. Both *sql.Row and pgx.Row
+// satisfy rowScanner.
+func scanUser(row rowScanner) (user User, err error) {
+	err = row.Scan(&user.UserID, &user.Phone, &user.Name, &user.Password,
+		&user.Email, &user.EmailVerifiedAt, &user.AvatarURL, &user.Locale, &user.Timezone,
+		&user.SuccessLogin, &user.LastLoginAt, &user.Version, &user.CreatedAt, &user.UpdatedAt)
+	return user, err
+}
+
+// scanSession reads a row selected by qListSessions or qGetSession.
+func scanSession(row rowScanner) (session Session, err error) {
+	err = row.Scan(&session.SessionID, &session.UserID, &session.UserAgent, &session.IP, &session.DeviceName,
+		&session.CreatedAt, &session.LastSeenAt, &session.ExpiresAt)
+	return session, err
+}
+
+// scanPasskey reads a row selected by qListPasskeys. lib/pq needs array
+// destinations wrapped by pq.Array, while pgx scans them as they are.
+func scanPasskey(row rowScanner, array func(any) any) (passkey Passkey, err error) {
+	err = row.Scan(&passkey.CredentialID, &passkey.UserID, &passkey.PublicKey, &passkey.AttestationType,
+		array(&passkey.Transports), &passkey.AAGUID, &passkey.SignCount, &passkey.BackupEligible,
+		&passkey.BackupState, &passkey.CloneWarning, &passkey.CreatedAt, &passkey.LastUsedAt)
+	return passkey, err
+}
+
+// scanOAuthClient reads a row selected by qGetOAuthClient; array works like
+// in scanPasskey.
+func scanOAuthClient(row rowScanner, array func(any) any) (client OAuthClient, err error) {
+	err = row.Scan(&client.ClientID, &client.SecretHash, &client.Name, array(&client.RedirectURIs),
+		&client.OwnerID, &client.CreatedAt)
+	return client, err
+}
+
+// scanMachineClient reads a row selected by qGetMachineClient or
+// qListMachineClients; array works like in scanPasskey.
+func scanMachineClient(row rowScanner, array func(any) any) (client MachineClient, err error) {
+	err = row.Scan(&client.ClientID, &client.SecretHash, &client.Name, array(&client.Scopes),
+		&client.CreatedBy, &client.CreatedAt)
+	return client, err
+}
+
+func scanAuthorizationCode(row rowScanner) (code AuthorizationCode, err error) {
+	err = row.Scan(&code.CodeHash, &code.ClientID, &code.UserID, &code.RedirectURI, &code.Scope, &code.Nonce,
+		&code.CodeChallenge, &code.ExpiresAt)
+	return code, err
+}
+
+// stringArray keeps array columns from being set to NULL for nil slices.
+func stringArray(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// buildUpdateUserQuery returns the UPDATE statement and its arguments for the
+// non-empty fields of input, matching the user by its current phone. The
+// version is always bumped and, when input.Version is set, must match.
+func buildUpdateUserQuery(input UpdateUser, identifier string) (string, []interface{}) {
+	column := 1
+	query := `UPDATE users SET `
+
+	updateCol := make([]string, 0)
+	valueUpdate := make([]interface{}, 0)
+	if len(strings.TrimSpace(input.Phone)) > 0 {
+		valueUpdate = append(valueUpdate, input.Phone)
+		updateCol = append(updateCol, fmt.Sprintf("phone = $%d", column))
+		column++
+	}
+	if len(strings.TrimSpace(input.Name)) > 0 {
+		valueUpdate = append(valueUpdate, input.Name)
+		updateCol = append(updateCol, fmt.Sprintf("name = $%d", column))
+		column++
+	}
+	if input.Email != nil {
+		valueUpdate = append(valueUpdate, *input.Email)
+		updateCol = append(updateCol,
+			fmt.Sprintf("email = $%d::varchar", column),
+			fmt.Sprintf("email_verified_at = CASE WHEN lower(email) IS NOT DISTINCT FROM lower($%d::varchar) THEN email_verified_at END", column))
+		column++
+	}
+	for _, nullable := range []struct {
+		column string
+		value  *sql.NullString
+	}{
+		{"avatar_url", input.AvatarURL},
+		{"locale", input.Locale},
+		{"timezone", input.Timezone},
+	} {
+		if nullable.value != nil {
+			valueUpdate = append(valueUpdate, *nullable.value)
+			updateCol = append(updateCol, fmt.Sprintf("%s = $%d", nullable.column, column))
+			column++
+		}
+	}
+
+	valueUpdate = append(valueUpdate, time.Now())
+	updateCol = append(updateCol, fmt.Sprintf("updated_at = $%d", column))
+	column++
+
+	updateCol = append(updateCol, "version = version + 1")
+
+	query += strings.Join(updateCol, ",")
+	query += fmt.Sprintf(" WHERE phone = $%d", column)
+	valueUpdate = append(valueUpdate, identifier)
+	column++
+
+	if input.Version > 0 {
+		query += fmt.Sprintf(" AND version = $%d", column)
+		valueUpdate = append(valueUpdate, input.Version)
+	}
+
+	return query, valueUpdate
+}
@@ -2,25 +2,91 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
 
 	_ "github.com/lib/pq"
 )
 
+const (
+	pingTimeout       = 5 * time.Second
+	maxConnectBackoff = 30 * time.Second
+)
+
 type Repository struct {
-	Db *sql.DB
+	Db    *sql.DB
+	stmts *stmtCache
+	// tx is set on the repository handed to a WithTx callback.
+	tx *sql.Tx
 }
 
 type NewRepositoryOptions struct {
 	Dsn string
+
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+
+	// ConnectRetries is the number of additional pings attempted when the
+	// database is not reachable at startup. The wait between attempts starts
+	// at ConnectBackoff and doubles each time, capped at maxConnectBackoff.
+	ConnectRetries int
+	ConnectBackoff time.Duration
 }
 
-func NewRepository(opts NewRepositoryOptions) *Repository {
+func NewRepository(opts NewRepositoryOptions) (*Repository, error) {
 	db, err := sql.Open("postgres", opts.Dsn)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
+
+	db.SetMaxOpenConns(opts.MaxOpenConns)
+	db.SetMaxIdleConns(opts.MaxIdleConns)
+	db.SetConnMaxLifetime(opts.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(opts.ConnMaxIdleTime)
+
+	if err = pingWithRetry(db.PingContext, opts.ConnectRetries, opts.ConnectBackoff); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	return newRepository(db), nil
+}
+
+func newRepository(db *sql.DB) *Repository {
 	return &Repository{
-		Db: db,
+		Db:    db,
+		stmts: newStmtCache(db),
+	}
+}
+
+// Close releases the cached prepared statements and the connection pool.
+func (r *Repository) Close() error {
+	return errors.Join(r.stmts.close(), r.Db.Close())
+}
+
+func pingWithRetry(ping func(ctx context.Context) error, retries int, backoff time.Duration) error {
+	for attempt := 1; ; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), pingTimeout)
+		err := ping(ctx)
+		cancel()
+		if err == nil {
+			return nil
+		}
+		if attempt > retries {
+			return fmt.Errorf("database not reachable after %d attempt(s): %w", attempt, err)
+		}
+
+		log.Printf("database not reachable (attempt %d/%d), retrying in %s: %v", attempt, retries+1, backoff, err)
+		time.Sleep(backoff)
+		backoff *= 2
+		if backoff > maxConnectBackoff {
+			backoff = maxConnectBackoff
+		}
 	}
 }
@@ -0,0 +1,1059 @@
+// Package repotest contains a behavioural contract every
+// repository.RepositoryInterface implementation must satisfy. Implementations
+// run it from their own tests through RunContract.
+package repotest
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/SawitProRecruitment/UserService/repository"
+	"github.com/google/uuid"
+)
+
+// Factory returns an empty repository for a single contract case.
+type Factory func(t *testing.T) repository.RepositoryInterface
+
+func RunContract(t *testing.T, newRepo Factory) {
+	t.Run("register and get by phone", func(t *testing.T) {
+		repo := newRepo(t)
+		ctx := context.Background()
+
+		input := newUser("+62821111121")
+		id, err := repo.RegisterUser(ctx, input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id != input.ID {
+			t.Fatalf("expected id %s, got %s", input.ID, id)
+		}
+
+		user, err := repo.GetUserByPhone(ctx, input.Phone)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user.UserID != input.ID || user.Phone != input.Phone || user.Name != input.Name ||
+			user.Password != input.Password {
+			t.Fatalf("unexpected user %+v", user)
+		}
+		if user.CreatedAt.IsZero() {
+			t.Fatal("expected created_at to be set")
+		}
+		if user.UpdatedAt.Valid {
+			t.Fatal("expected updated_at to be empty for a new user")
+		}
+	})
+
+	t.Run("duplicate phone", func(t *testing.T) {
+		repo := newRepo(t)
+		ctx := context.Background()
+
+		mustRegister(t, repo, newUser("+62821111121"))
+		_, err := repo.RegisterUser(ctx, newUser("+62821111121"))
+		if !errors.Is(err, repository.ErrConflict) {
+			t.Fatalf("expected ErrConflict, got %v", err)
+		}
+	})
+
+	t.Run("update", func(t *testing.T) {
+		repo := newRepo(t)
+		ctx := context.Background()
+
+		mustRegister(t, repo, newUser("+62821111121"))
+		err := repo.UpdateUser(ctx, repository.UpdateUser{Name: "Johnny", Phone: "+62821111122"}, "+62821111121")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		user, err := repo.GetUserByPhone(ctx, "+62821111122")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user.Name != "Johnny" || !user.UpdatedAt.Valid {
+			t.Fatalf("unexpected user %+v", user)
+		}
+		if _, err = repo.GetUserByPhone(ctx, "+62821111121"); !errors.Is(err, repository.ErrUserNotFound) {
+			t.Fatalf("expected old phone to be gone, got %v", err)
+		}
+	})
+
+	t.Run("update only name keeps phone", func(t *testing.T) {
+		repo := newRepo(t)
+		ctx := context.Background()
+
+		mustRegister(t, repo, newUser("+62821111121"))
+		err := repo.UpdateUser(ctx, repository.UpdateUser{Name: "Johnny"}, "+62821111121")
+		if err != nil {
+			t.Fatal(err)
+		}
+		user, err := repo.GetUserByPhone(ctx, "+62821111121")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user.Name != "Johnny" {
+			t.Fatalf("unexpected user %+v", user)
+		}
+	})
+
+	t.Run("update to taken phone", func(t *testing.T) {
+		repo := newRepo(t)
+		ctx := context.Background()
+
+		mustRegister(t, repo, newUser("+62821111121"))
+		mustRegister(t, repo, newUser("+62821111122"))
+		err := repo.UpdateUser(ctx, repository.UpdateUser{Phone: "+62821111122"}, "+62821111121")
+		if !errors.Is(err, repository.ErrConflict) {
+			t.Fatalf("expected ErrConflict, got %v", err)
+		}
+	})
+
+	t.Run("update unknown user", func(t *testing.T) {
+		repo := newRepo(t)
+		err := repo.UpdateUser(context.Background(), repository.UpdateUser{Name: "Johnny"}, "+62821111121")
+		if err == nil {
+			t.Fatal("expected error for unknown user")
+		}
+	})
+
+	t.Run("update bumps version", func(t *testing.T) {
+		repo := newRepo(t)
+		ctx := context.Background()
+
+		mustRegister(t, repo, newUser("+62821111121"))
+		before, err := repo.GetUserByPhone(ctx, "+62821111121")
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = repo.UpdateUser(ctx, repository.UpdateUser{Name: "Johnny", Version: before.Version}, "+62821111121")
+		if err != nil {
+			t.Fatal(err)
+		}
+		after, err := repo.GetUserByPhone(ctx, "+62821111121")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if after.Version != before.Version+1 {
+			t.Fatalf("expected version %d, got %d", before.Version+1, after.Version)
+		}
+	})
+
+	t.Run("update with stale version", func(t *testing.T) {
+		repo := newRepo(t)
+		ctx := context.Background()
+
+		mustRegister(t, repo, newUser("+62821111121"))
+		user, err := repo.GetUserByPhone(ctx, "+62821111121")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = repo.UpdateUser(ctx, repository.UpdateUser{Name: "Johnny"}, "+62821111121"); err != nil {
+			t.Fatal(err)
+		}
+
+		err = repo.UpdateUser(ctx, repository.UpdateUser{Name: "Jane", Version: user.Version}, "+62821111121")
+		if !errors.Is(err, repository.ErrVersionConflict) {
+			t.Fatalf("expected ErrVersionConflict, got %v", err)
+		}
+	})
+
+	t.Run("update optional profile fields", func(t *testing.T) {
+		repo := newRepo(t)
+		ctx := context.Background()
+
+		mustRegister(t, repo, newUser("+62821111121"))
+		err := repo.UpdateUser(ctx, repository.UpdateUser{
+			AvatarURL: &sql.NullString{String: "https://example.com/a.png", Valid: true},
+			Locale:    &sql.NullString{String: "id-ID", Valid: true},
+			Timezone:  &sql.NullString{String: "Asia/Jakarta", Valid: true},
+		}, "+62821111121")
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = repo.UpdateUser(ctx, repository.UpdateUser{
+			AvatarURL: &sql.NullString{},
+		}, "+62821111121")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		user, err := repo.GetUserByPhone(ctx, "+62821111121")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user.AvatarURL.Valid || user.Locale.String != "id-ID" || user.Timezone.String != "Asia/Jakarta" {
+			t.Fatalf("unexpected user %+v", user)
+		}
+	})
+
+	t.Run("email is unique regardless of case", func(t *testing.T) {
+		repo := newRepo(t)
+		ctx := context.Background()
+
+		mustRegister(t, repo, newUser("+62821111121"))
+		mustRegister(t, repo, newUser("+62821111122"))
+		err := repo.UpdateUser(ctx, repository.UpdateUser{
+			Email: &sql.NullString{String: "john@example.com", Valid: true},
+		}, "+62821111121")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = repo.UpdateUser(ctx, repository.UpdateUser{
+			Email: &sql.NullString{String: "John@Example.com", Valid: true},
+		}, "+62821111122")
+		if !errors.Is(err, repository.ErrConflict) {
+			t.Fatalf("expected ErrConflict, got %v", err)
+		}
+	})
+
+	t.Run("update password keeps the version", func(t *testing.T) {
+		repo := newRepo(t)
+		ctx := context.Background()
+
+		input := newUser("+62821111121")
+		mustRegister(t, repo, input)
+		if err := repo.UpdatePassword(ctx, input.Phone, "rehashed"); err != nil {
+			t.Fatal(err)
+		}
+
+		user, err := repo.GetUserByPhone(ctx, input.Phone)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user.Password != "rehashed" || user.Version != 1 {
+			t.Fatalf("unexpected user %+v", user)
+		}
+
+		if err = repo.UpdatePassword(ctx, "+62821111122", "rehashed"); !errors.Is(err, repository.ErrUserNotFound) {
+			t.Fatalf("expected ErrUserNotFound, got %v", err)
+		}
+	})
+
+	t.Run("get user by email ignores case", func(t *testing.T) {
+		repo := newRepo(t)
+		ctx := context.Background()
+
+		input := newUser("+62821111121")
+		mustRegister(t, repo, input)
+		err := repo.UpdateUser(ctx, repository.UpdateUser{
+			Email: &sql.NullString{String: "John@Example.com", Valid: true},
+		}, input.Phone)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		user, err := repo.GetUserByEmail(ctx, "john@EXAMPLE.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user.UserID != input.ID || user.Email.String != "John@Example.com" {
+			t.Fatalf("unexpected user %+v", user)
+		}
+
+		if _, err = repo.GetUserByEmail(ctx, "jane@example.com"); !errors.Is(err, repository.ErrUserNotFound) {
+			t.Fatalf("expected ErrUserNotFound, got %v", err)
+		}
+	})
+
+	t.Run("email verification", func(t *testing.T) {
+		repo := newRepo(t)
+		ctx := context.Background()
+
+		input := newUser("+62821111121")
+		mustRegister(t, repo, input)
+		email := &sql.NullString{String: "john@example.com", Valid: true}
+		if err := repo.UpdateUser(ctx, repository.UpdateUser{Email: email}, input.Phone); err != nil {
+			t.Fatal(err)
+		}
+
+		err := repo.CreateEmailVerification(ctx, repository.EmailVerification{
+			UserID:    input.ID,
+			Email:     "john@example.com",
+			TokenHash: "expired",
+			ExpiresAt: time.Now().Add(-time.Minute),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = repo.ConfirmEmailVerification(ctx, "expired"); !errors.Is(err, repository.ErrVerificationNotFound) {
+			t.Fatalf("expected ErrVerificationNotFound for expired token, got %v", err)
+		}
+
+		err = repo.CreateEmailVerification(ctx, repository.EmailVerification{
+			UserID:    input.ID,
+			Email:     "john@example.com",
+			TokenHash: "valid",
+			ExpiresAt: time.Now().Add(time.Hour),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		userID, err := repo.ConfirmEmailVerification(ctx, "valid")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if userID != input.ID {
+			t.Fatalf("expected user %s, got %s", input.ID, userID)
+		}
+		if _, err = repo.ConfirmEmailVerification(ctx, "valid"); !errors.Is(err, repository.ErrVerificationNotFound) {
+			t.Fatalf("expected token to be single use, got %v", err)
+		}
+
+		user, err := repo.GetUserByPhone(ctx, input.Phone)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !user.EmailVerifiedAt.Valid {
+			t.Fatal("expected email to be verified")
+		}
+
+		// Same address in another case keeps the verification, a new one drops it.
+		err = repo.UpdateUser(ctx, repository.UpdateUser{
+			Email: &sql.NullString{String: "JOHN@example.com", Valid: true},
+		}, input.Phone)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user, _ = repo.GetUserByPhone(ctx, input.Phone); !user.EmailVerifiedAt.Valid {
+			t.Fatal("expected verification to be kept")
+		}
+		err = repo.UpdateUser(ctx, repository.UpdateUser{
+			Email: &sql.NullString{String: "johnny@example.com", Valid: true},
+		}, input.Phone)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user, _ = repo.GetUserByPhone(ctx, input.Phone); user.EmailVerifiedAt.Valid {
+			t.Fatal("expected verification to be reset")
+		}
+	})
+
+	t.Run("increment login", func(t *testing.T) {
+		repo := newRepo(t)
+		ctx := context.Background()
+
+		mustRegister(t, repo, newUser("+62821111121"))
+		for i := 0; i < 2; i++ {
+			if err := repo.IncrSuccessLogin(ctx, "+62821111121"); err != nil {
+				t.Fatal(err)
+			}
+		}
+		user, err := repo.GetUserByPhone(ctx, "+62821111121")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user.SuccessLogin != 2 {
+			t.Fatalf("expected 2 successful logins, got %d", user.SuccessLogin)
+		}
+		if !user.LastLoginAt.Valid {
+			t.Fatal("expected last_login_at to be set")
+		}
+		if err = repo.IncrSuccessLogin(ctx, "+62821111199"); err == nil {
+			t.Fatal("expected error for unknown user")
+		}
+	})
+
+	t.Run("transaction commits composed operations", func(t *testing.T) {
+		repo := newRepo(t)
+		ctx := context.Background()
+
+		err := repo.WithTx(ctx, func(tx repository.RepositoryInterface) error {
+			if _, err := tx.RegisterUser(ctx, newUser("+62821111121")); err != nil {
+				return err
+			}
+			if _, err := tx.GetUserByPhone(ctx, "+62821111121"); err != nil {
+				return err
+			}
+			return tx.IncrSuccessLogin(ctx, "+62821111121")
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		user, err := repo.GetUserByPhone(ctx, "+62821111121")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user.SuccessLogin != 1 {
+			t.Fatalf("expected 1 successful login, got %d", user.SuccessLogin)
+		}
+	})
+
+	t.Run("transaction rolls back on error", func(t *testing.T) {
+		repo := newRepo(t)
+		ctx := context.Background()
+		errAbort := errors.New("abort")
+
+		mustRegister(t, repo, newUser("+62821111121"))
+		err := repo.WithTx(ctx, func(tx repository.RepositoryInterface) error {
+			if _, err := tx.RegisterUser(ctx, newUser("+62821111122")); err != nil {
+				return err
+			}
+			if err := tx.UpdateUser(ctx, repository.UpdateUser{Name: "Johnny"}, "+62821111121"); err != nil {
+				return err
+			}
+			return tx.WithTx(ctx, func(nested repository.RepositoryInterface) error {
+				return errAbort
+			})
+		})
+		if !errors.Is(err, errAbort) {
+			t.Fatalf("expected the callback error, got %v", err)
+		}
+
+		if _, err = repo.GetUserByPhone(ctx, "+62821111122"); !errors.Is(err, repository.ErrUserNotFound) {
+			t.Fatalf("expected registration to be rolled back, got %v", err)
+		}
+		user, err := repo.GetUserByPhone(ctx, "+62821111121")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user.Name != "John" {
+			t.Fatalf("expected update to be rolled back, got %+v", user)
+		}
+	})
+
+	t.Run("get user by id", func(t *testing.T) {
+		repo := newRepo(t)
+		ctx := context.Background()
+
+		input := newUser("+62821111121")
+		mustRegister(t, repo, input)
+		user, err := repo.GetUserByID(ctx, input.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user.Phone != input.Phone {
+			t.Fatalf("unexpected user %+v", user)
+		}
+		if _, err = repo.GetUserByID(ctx, uuid.NewString()); !errors.Is(err, repository.ErrUserNotFound) {
+			t.Fatalf("expected ErrUserNotFound, got %v", err)
+		}
+	})
+
+	t.Run("totp enrollment", func(t *testing.T) {
+		repo := newRepo(t)
+		ctx := context.Background()
+
+		input := newUser("+62821111121")
+		mustRegister(t, repo, input)
+		if _, err := repo.GetTOTP(ctx, input.ID); !errors.Is(err, repository.ErrMFANotFound) {
+			t.Fatalf("expected ErrMFANotFound, got %v", err)
+		}
+		if err := repo.UseTOTPStep(ctx, input.ID, 10); !errors.Is(err, repository.ErrMFANotFound) {
+			t.Fatalf("expected pending TOTP to refuse codes, got %v", err)
+		}
+
+		for _, secret := range []string{"FIRST", "SECOND"} {
+			if err := repo.SaveTOTP(ctx, input.ID, secret); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := repo.ConfirmTOTP(ctx, input.ID, 10, []string{"a", "b"}); err != nil {
+			t.Fatal(err)
+		}
+		totp, err := repo.GetTOTP(ctx, input.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if totp.Secret != "SECOND" || !totp.ConfirmedAt.Valid || totp.LastUsedStep != 10 {
+			t.Fatalf("unexpected totp %+v", totp)
+		}
+
+		if err = repo.SaveTOTP(ctx, input.ID, "THIRD"); !errors.Is(err, repository.ErrConflict) {
+			t.Fatalf("expected ErrConflict, got %v", err)
+		}
+		if err = repo.ConfirmTOTP(ctx, input.ID, 11, nil); !errors.Is(err, repository.ErrMFANotFound) {
+			t.Fatalf("expected ErrMFANotFound, got %v", err)
+		}
+
+		if err = repo.UseTOTPStep(ctx, input.ID, 10); !errors.Is(err, repository.ErrMFANotFound) {
+			t.Fatalf("expected a used step to be refused, got %v", err)
+		}
+		if err = repo.UseTOTPStep(ctx, input.ID, 11); err != nil {
+			t.Fatal(err)
+		}
+
+		if err = repo.UseRecoveryCode(ctx, input.ID, "a"); err != nil {
+			t.Fatal(err)
+		}
+		for _, hash := range []string{"a", "c"} {
+			if err = repo.UseRecoveryCode(ctx, input.ID, hash); !errors.Is(err, repository.ErrMFANotFound) {
+				t.Fatalf("expected recovery code %s to be refused, got %v", hash, err)
+			}
+		}
+	})
+
+	t.Run("mfa challenge", func(t *testing.T) {
+		repo := newRepo(t)
+		ctx := context.Background()
+
+		input := newUser("+62821111121")
+		mustRegister(t, repo, input)
+		for hash, expiresAt := range map[string]time.Time{
+			"live":    time.Now().Add(time.Minute),
+			"expired": time.Now().Add(-time.Minute),
+		} {
+			err := repo.CreateMFAChallenge(ctx, repository.MFAChallenge{
+				UserID:    input.ID,
+				TokenHash: hash,
+				ExpiresAt: expiresAt,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if _, err := repo.RecordMFAAttempt(ctx, "expired", 2); !errors.Is(err, repository.ErrMFANotFound) {
+			t.Fatalf("expected ErrMFANotFound, got %v", err)
+		}
+		for i := 0; i < 2; i++ {
+			userID, err := repo.RecordMFAAttempt(ctx, "live", 2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if userID != input.ID {
+				t.Fatalf("expected user %s, got %s", input.ID, userID)
+			}
+		}
+		if _, err := repo.RecordMFAAttempt(ctx, "live", 2); !errors.Is(err, repository.ErrMFANotFound) {
+			t.Fatalf("expected attempts to run out, got %v", err)
+		}
+
+		if err := repo.DeleteMFAChallenge(ctx, "live"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := repo.RecordMFAAttempt(ctx, "live", 5); !errors.Is(err, repository.ErrMFANotFound) {
+			t.Fatalf("expected ErrMFANotFound, got %v", err)
+		}
+	})
+
+	t.Run("login otp", func(t *testing.T) {
+		repo := newRepo(t)
+		ctx := context.Background()
+
+		input := newUser("+62821111121")
+		mustRegister(t, repo, input)
+		create := func(phone string, userID sql.NullString, hash string, expiresAt time.Time) string {
+			id := uuid.NewString()
+			err := repo.CreateLoginOTP(ctx, repository.LoginOTP{
+				ID:        id,
+				Phone:     phone,
+				UserID:    userID,
+				CodeHash:  hash,
+				ExpiresAt: expiresAt,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			return id
+		}
+		owner := sql.NullString{String: input.ID, Valid: true}
+
+		create(input.Phone, owner, "first", time.Now().Add(time.Minute))
+		time.Sleep(time.Millisecond)
+		second := create(input.Phone, owner, "second", time.Now().Add(time.Minute))
+		if count, err := repo.CountLoginOTPs(ctx, input.Phone, time.Hour); err != nil || count != 2 {
+			t.Fatalf("expected 2 codes, got %d, %v", count, err)
+		}
+
+		// Only the most recent code counts.
+		for i := 1; i <= 2; i++ {
+			otp, err := repo.RecordLoginOTPAttempt(ctx, input.Phone, 2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if otp.ID != second || otp.CodeHash != "second" || otp.UserID != owner || otp.Attempts != i {
+				t.Fatalf("unexpected code %+v", otp)
+			}
+		}
+		if _, err := repo.RecordLoginOTPAttempt(ctx, input.Phone, 2); !errors.Is(err, repository.ErrOTPNotFound) {
+			t.Fatalf("expected attempts to run out, got %v", err)
+		}
+
+		if err := repo.ConsumeLoginOTP(ctx, second); err != nil {
+			t.Fatal(err)
+		}
+		if err := repo.ConsumeLoginOTP(ctx, second); !errors.Is(err, repository.ErrOTPNotFound) {
+			t.Fatalf("expected ErrOTPNotFound, got %v", err)
+		}
+		if _, err := repo.RecordLoginOTPAttempt(ctx, input.Phone, 5); !errors.Is(err, repository.ErrOTPNotFound) {
+			t.Fatalf("expected used code to be refused, got %v", err)
+		}
+
+		create("+62821111122", sql.NullString{}, "nobody", time.Now().Add(time.Minute))
+		otp, err := repo.RecordLoginOTPAttempt(ctx, "+62821111122", 5)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if otp.UserID.Valid || otp.Phone != "+62821111122" {
+			t.Fatalf("unexpected code %+v", otp)
+		}
+
+		create("+62821111123", sql.NullString{}, "expired", time.Now().Add(-time.Minute))
+		if _, err = repo.RecordLoginOTPAttempt(ctx, "+62821111123", 5); !errors.Is(err, repository.ErrOTPNotFound) {
+			t.Fatalf("expected ErrOTPNotFound, got %v", err)
+		}
+		if count, err := repo.CountLoginOTPs(ctx, "+62821111124", time.Hour); err != nil || count != 0 {
+			t.Fatalf("expected no codes, got %d, %v", count, err)
+		}
+	})
+
+	t.Run("expired challenges", func(t *testing.T) {
+		repo := newRepo(t)
+		ctx := context.Background()
+
+		input := newUser("+62821111121")
+		mustRegister(t, repo, input)
+		live, expired := time.Now().Add(time.Minute), time.Now().Add(-time.Minute)
+		createMFA := func(hash string, expiresAt time.Time) error {
+			return repo.CreateMFAChallenge(ctx, repository.MFAChallenge{UserID: input.ID, TokenHash: hash, ExpiresAt: expiresAt})
+		}
+		createWebAuthn := func(challenge string, expiresAt time.Time) error {
+			return repo.CreateWebAuthnChallenge(ctx, repository.WebAuthnChallenge{
+				Challenge:   challenge,
+				Ceremony:    repository.CeremonyLogin,
+				SessionData: []byte(`{}`),
+				ExpiresAt:   expiresAt,
+			})
+		}
+		for _, err := range []error{
+			createMFA("live", live),
+			createMFA("expired", expired),
+			createWebAuthn("live", live),
+			createWebAuthn("expired", expired),
+		} {
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		for phone, expiresAt := range map[string]time.Time{"+62821111122": live, "+62821111123": expired} {
+			err := repo.CreateLoginOTP(ctx, repository.LoginOTP{ID: uuid.NewString(), Phone: phone, CodeHash: "hash", ExpiresAt: expiresAt})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		countOTPs := func(phone string) int {
+			count, err := repo.CountLoginOTPs(ctx, phone, time.Hour)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return count
+		}
+
+		// Expired codes requested within the window still count towards it.
+		if err := repo.DeleteExpiredChallenges(ctx, time.Hour); err != nil {
+			t.Fatal(err)
+		}
+		if count := countOTPs("+62821111123"); count != 1 {
+			t.Fatalf("expected the expired code to be kept within the window, got %d", count)
+		}
+		time.Sleep(10 * time.Millisecond)
+		if err := repo.DeleteExpiredChallenges(ctx, time.Millisecond); err != nil {
+			t.Fatal(err)
+		}
+		if count := countOTPs("+62821111123"); count != 0 {
+			t.Fatalf("expected the expired code to be deleted, got %d", count)
+		}
+		if count := countOTPs("+62821111122"); count != 1 {
+			t.Fatalf("expected the live code to be kept, got %d", count)
+		}
+
+		// The expired challenges are gone, so they can be created again.
+		if err := createMFA("expired", live); err != nil {
+			t.Fatalf("expected the expired MFA challenge to be deleted, got %v", err)
+		}
+		if err := createWebAuthn("expired", live); err != nil {
+			t.Fatalf("expected the expired WebAuthn challenge to be deleted, got %v", err)
+		}
+		if _, err := repo.RecordMFAAttempt(ctx, "live", 5); err != nil {
+			t.Fatalf("expected the live MFA challenge to be kept, got %v", err)
+		}
+		if _, err := repo.ConsumeWebAuthnChallenge(ctx, "live", repository.CeremonyLogin); err != nil {
+			t.Fatalf("expected the live WebAuthn challenge to be kept, got %v", err)
+		}
+	})
+
+	t.Run("oauth", func(t *testing.T) {
+		repo := newRepo(t)
+		ctx := context.Background()
+
+		owner := newUser("+62821111121")
+		mustRegister(t, repo, owner)
+		client := repository.OAuthClient{
+			ClientID:     "inventory",
+			SecretHash:   sql.NullString{String: "secret-hash", Valid: true},
+			Name:         "Inventory",
+			RedirectURIs: []string{"https://inventory.example.com/callback", "http://127.0.0.1/callback"},
+			OwnerID:      owner.ID,
+		}
+		if err := repo.CreateOAuthClient(ctx, client); err != nil {
+			t.Fatal(err)
+		}
+		if err := repo.CreateOAuthClient(ctx, client); !errors.Is(err, repository.ErrConflict) {
+			t.Fatalf("expected ErrConflict, got %v", err)
+		}
+		public := repository.OAuthClient{ClientID: "mobile", Name: "Mobile", OwnerID: owner.ID}
+		if err := repo.CreateOAuthClient(ctx, public); err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := repo.GetOAuthClient(ctx, "inventory")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.SecretHash != client.SecretHash || got.Name != client.Name || got.OwnerID != owner.ID ||
+			len(got.RedirectURIs) != 2 || got.RedirectURIs[1] != client.RedirectURIs[1] || got.CreatedAt.IsZero() {
+			t.Fatalf("unexpected client %+v", got)
+		}
+		if got, err = repo.GetOAuthClient(ctx, "mobile"); err != nil || got.SecretHash.Valid || len(got.RedirectURIs) != 0 {
+			t.Fatalf("unexpected public client %+v, %v", got, err)
+		}
+		if _, err = repo.GetOAuthClient(ctx, "unknown"); !errors.Is(err, repository.ErrOAuthNotFound) {
+			t.Fatalf("expected ErrOAuthNotFound, got %v", err)
+		}
+
+		for hash, expiresAt := range map[string]time.Time{
+			"live":    time.Now().Add(time.Minute),
+			"expired": time.Now().Add(-time.Minute),
+		} {
+			err = repo.CreateAuthorizationCode(ctx, repository.AuthorizationCode{
+				CodeHash:      hash,
+				ClientID:      "inventory",
+				UserID:        owner.ID,
+				RedirectURI:   client.RedirectURIs[0],
+				Scope:         "openid profile",
+				Nonce:         "n-0S6_WzA2Mj",
+				CodeChallenge: "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM",
+				ExpiresAt:     expiresAt,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		code, err := repo.ConsumeAuthorizationCode(ctx, "live")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code.UserID != owner.ID || code.ClientID != "inventory" || code.Scope != "openid profile" ||
+			code.Nonce != "n-0S6_WzA2Mj" || code.CodeChallenge != "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM" {
+			t.Fatalf("unexpected code %+v", code)
+		}
+		for _, hash := range []string{"live", "expired"} {
+			if _, err = repo.ConsumeAuthorizationCode(ctx, hash); !errors.Is(err, repository.ErrOAuthNotFound) {
+				t.Fatalf("expected ErrOAuthNotFound for %s code, got %v", hash, err)
+			}
+		}
+
+		if _, err = repo.GetOAuthConsent(ctx, owner.ID, "inventory"); !errors.Is(err, repository.ErrOAuthNotFound) {
+			t.Fatalf("expected ErrOAuthNotFound, got %v", err)
+		}
+		for _, scopes := range [][]string{{"openid"}, {"openid", "email"}} {
+			err = repo.SaveOAuthConsent(ctx, repository.OAuthConsent{UserID: owner.ID, ClientID: "inventory", Scopes: scopes})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		consent, err := repo.GetOAuthConsent(ctx, owner.ID, "inventory")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(consent.Scopes) != 2 || consent.Scopes[1] != "email" {
+			t.Fatalf("unexpected consent %+v", consent)
+		}
+		if _, err = repo.GetOAuthConsent(ctx, owner.ID, "mobile"); !errors.Is(err, repository.ErrOAuthNotFound) {
+			t.Fatalf("expected ErrOAuthNotFound, got %v", err)
+		}
+	})
+
+	t.Run("machine clients", func(t *testing.T) {
+		repo := newRepo(t)
+		ctx := context.Background()
+
+		admin := newUser("+62821111121")
+		mustRegister(t, repo, admin)
+		for _, client := range []repository.MachineClient{
+			{ClientID: "billing", SecretHash: "billing-hash", Name: "Billing", Scopes: []string{"users:read"}, CreatedBy: admin.ID},
+			{ClientID: "audit", SecretHash: "audit-hash", Name: "Audit", CreatedBy: admin.ID},
+		} {
+			if err := repo.CreateMachineClient(ctx, client); err != nil {
+				t.Fatal(err)
+			}
+		}
+		err := repo.CreateMachineClient(ctx, repository.MachineClient{ClientID: "billing", SecretHash: "x", Name: "Copy", CreatedBy: admin.ID})
+		if !errors.Is(err, repository.ErrConflict) {
+			t.Fatalf("expected ErrConflict, got %v", err)
+		}
+
+		got, err := repo.GetMachineClient(ctx, "billing")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.SecretHash != "billing-hash" || got.Name != "Billing" || len(got.Scopes) != 1 || got.Scopes[0] != "users:read" ||
+			got.CreatedBy != admin.ID || got.CreatedAt.IsZero() {
+			t.Fatalf("unexpected client %+v", got)
+		}
+		if _, err = repo.GetMachineClient(ctx, "unknown"); !errors.Is(err, repository.ErrOAuthNotFound) {
+			t.Fatalf("expected ErrOAuthNotFound, got %v", err)
+		}
+
+		clients, err := repo.ListMachineClients(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(clients) != 2 || clients[0].ClientID != "billing" || clients[1].ClientID != "audit" || len(clients[1].Scopes) != 0 {
+			t.Fatalf("unexpected clients %+v", clients)
+		}
+
+		if err = repo.DeleteMachineClient(ctx, "billing"); err != nil {
+			t.Fatal(err)
+		}
+		if err = repo.DeleteMachineClient(ctx, "billing"); !errors.Is(err, repository.ErrOAuthNotFound) {
+			t.Fatalf("expected ErrOAuthNotFound, got %v", err)
+		}
+		if _, err = repo.GetMachineClient(ctx, "billing"); !errors.Is(err, repository.ErrOAuthNotFound) {
+			t.Fatalf("expected ErrOAuthNotFound, got %v", err)
+		}
+	})
+
+	t.Run("sessions", func(t *testing.T) {
+		repo := newRepo(t)
+		ctx := context.Background()
+
+		owner, other := newUser("+62821111121"), newUser("+62821111122")
+		mustRegister(t, repo, owner)
+		mustRegister(t, repo, other)
+		newSession := func(userID string, ttl time.Duration) string {
+			t.Helper()
+			id := uuid.NewString()
+			err := repo.CreateSession(ctx, repository.Session{
+				SessionID:  id,
+				UserID:     userID,
+				UserAgent:  "curl/8.0",
+				IP:         "192.0.2.1",
+				DeviceName: "curl",
+				ExpiresAt:  time.Now().Add(ttl),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			return id
+		}
+		first := newSession(owner.ID, time.Hour)
+		second := newSession(owner.ID, time.Hour)
+		third := newSession(owner.ID, time.Hour)
+		expired := newSession(owner.ID, -time.Minute)
+		foreign := newSession(other.ID, time.Hour)
+
+		if _, err := repo.TouchSession(ctx, expired); !errors.Is(err, repository.ErrSessionNotFound) {
+			t.Fatalf("expected ErrSessionNotFound, got %v", err)
+		}
+		touched, err := repo.TouchSession(ctx, first)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The session was seen when it was created, less than
+		// SessionSeenInterval ago, so the use is not written again.
+		if touched.SessionID != first || touched.UserID != owner.ID || !touched.LastSeenAt.Equal(touched.CreatedAt) {
+			t.Fatalf("unexpected touched session %+v", touched)
+		}
+
+		sessions, err := repo.ListSessions(ctx, owner.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(sessions) != 3 || sessions[0].SessionID != third || sessions[2].SessionID != first {
+			t.Fatalf("expected 3 live sessions, last seen first, got %+v", sessions)
+		}
+		if got := sessions[2]; got.UserAgent != "curl/8.0" || got.IP != "192.0.2.1" || got.DeviceName != "curl" ||
+			got.CreatedAt.IsZero() || !got.LastSeenAt.Equal(got.CreatedAt) {
+			t.Fatalf("unexpected session %+v", got)
+		}
+		got, err := repo.GetSession(ctx, second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.UserID != owner.ID || got.DeviceName != "curl" || !got.LastSeenAt.Equal(got.CreatedAt) {
+			t.Fatalf("unexpected session %+v", got)
+		}
+		if _, err = repo.GetSession(ctx, expired); !errors.Is(err, repository.ErrSessionNotFound) {
+			t.Fatalf("expected ErrSessionNotFound, got %v", err)
+		}
+
+		if err = repo.RevokeSession(ctx, other.ID, second); !errors.Is(err, repository.ErrSessionNotFound) {
+			t.Fatalf("expected sessions of others to be left alone, got %v", err)
+		}
+		if err = repo.RevokeSession(ctx, owner.ID, second); err != nil {
+			t.Fatal(err)
+		}
+		if err = repo.RevokeSession(ctx, owner.ID, second); !errors.Is(err, repository.ErrSessionNotFound) {
+			t.Fatalf("expected ErrSessionNotFound, got %v", err)
+		}
+		if _, err = repo.TouchSession(ctx, second); !errors.Is(err, repository.ErrSessionNotFound) {
+			t.Fatalf("expected revoked session to be refused, got %v", err)
+		}
+		if _, err = repo.GetSession(ctx, second); !errors.Is(err, repository.ErrSessionNotFound) {
+			t.Fatalf("expected ErrSessionNotFound, got %v", err)
+		}
+
+		revoked, err := repo.RevokeOtherSessions(ctx, owner.ID, first)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if revoked != 1 {
+			t.Fatalf("expected 1 session revoked, got %d", revoked)
+		}
+		if _, err = repo.TouchSession(ctx, third); !errors.Is(err, repository.ErrSessionNotFound) {
+			t.Fatalf("expected revoked session to be refused, got %v", err)
+		}
+		for _, id := range []string{first, foreign} {
+			if _, err = repo.TouchSession(ctx, id); err != nil {
+				t.Fatal(err)
+			}
+		}
+	})
+
+	t.Run("webauthn challenge", func(t *testing.T) {
+		repo := newRepo(t)
+		ctx := context.Background()
+
+		input := newUser("+62821111121")
+		mustRegister(t, repo, input)
+		challenges := []repository.WebAuthnChallenge{
+			{
+				Challenge:   "registration",
+				Ceremony:    repository.CeremonyRegistration,
+				UserID:      sql.NullString{String: input.ID, Valid: true},
+				SessionData: []byte(`{"challenge":"registration"}`),
+				ExpiresAt:   time.Now().Add(time.Minute),
+			},
+			{
+				Challenge:   "login",
+				Ceremony:    repository.CeremonyLogin,
+				SessionData: []byte(`{"challenge":"login"}`),
+				ExpiresAt:   time.Now().Add(time.Minute),
+			},
+			{
+				Challenge:   "expired",
+				Ceremony:    repository.CeremonyLogin,
+				SessionData: []byte(`{}`),
+				ExpiresAt:   time.Now().Add(-time.Minute),
+			},
+		}
+		for _, challenge := range challenges {
+			if err := repo.CreateWebAuthnChallenge(ctx, challenge); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if _, err := repo.ConsumeWebAuthnChallenge(ctx, "registration", repository.CeremonyLogin); !errors.Is(err, repository.ErrPasskeyNotFound) {
+			t.Fatalf("expected challenges of other ceremonies to be refused, got %v", err)
+		}
+		got, err := repo.ConsumeWebAuthnChallenge(ctx, "registration", repository.CeremonyRegistration)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.UserID.String != input.ID || string(got.SessionData) != `{"challenge":"registration"}` {
+			t.Fatalf("unexpected challenge %+v", got)
+		}
+		got, err = repo.ConsumeWebAuthnChallenge(ctx, "login", repository.CeremonyLogin)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.UserID.Valid {
+			t.Fatalf("expected no user for a login challenge, got %+v", got.UserID)
+		}
+
+		for _, challenge := range challenges {
+			if _, err = repo.ConsumeWebAuthnChallenge(ctx, challenge.Challenge, challenge.Ceremony); !errors.Is(err, repository.ErrPasskeyNotFound) {
+				t.Fatalf("expected %s to be gone, got %v", challenge.Challenge, err)
+			}
+		}
+	})
+
+	t.Run("passkeys", func(t *testing.T) {
+		repo := newRepo(t)
+		ctx := context.Background()
+
+		input := newUser("+62821111121")
+		mustRegister(t, repo, input)
+		passkey := repository.Passkey{
+			CredentialID:    []byte{1, 2, 3},
+			UserID:          input.ID,
+			PublicKey:       []byte{4, 5, 6},
+			AttestationType: "none",
+			Transports:      []string{"internal", "hybrid"},
+			SignCount:       1,
+			BackupEligible:  true,
+		}
+		if err := repo.CreatePasskey(ctx, passkey); err != nil {
+			t.Fatal(err)
+		}
+		if err := repo.CreatePasskey(ctx, passkey); !errors.Is(err, repository.ErrConflict) {
+			t.Fatalf("expected ErrConflict, got %v", err)
+		}
+		second := passkey
+		second.CredentialID = []byte{7, 8, 9}
+		second.Transports = nil
+		if err := repo.CreatePasskey(ctx, second); err != nil {
+			t.Fatal(err)
+		}
+
+		err := repo.UpdatePasskeyUse(ctx, repository.Passkey{CredentialID: passkey.CredentialID, SignCount: 5, BackupState: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = repo.UpdatePasskeyUse(ctx, repository.Passkey{CredentialID: []byte{0}}); !errors.Is(err, repository.ErrPasskeyNotFound) {
+			t.Fatalf("expected ErrPasskeyNotFound, got %v", err)
+		}
+
+		passkeys, err := repo.ListPasskeys(ctx, input.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(passkeys) != 2 {
+			t.Fatalf("expected 2 passkeys, got %+v", passkeys)
+		}
+		var got repository.Passkey
+		for _, p := range passkeys {
+			if string(p.CredentialID) == string(passkey.CredentialID) {
+				got = p
+			}
+		}
+		if string(got.PublicKey) != string(passkey.PublicKey) || got.AttestationType != "none" ||
+			len(got.Transports) != 2 || got.Transports[1] != "hybrid" || got.SignCount != 5 ||
+			!got.BackupEligible || !got.BackupState || !got.LastUsedAt.Valid || got.CreatedAt.IsZero() {
+			t.Fatalf("unexpected passkey %+v", got)
+		}
+
+		if passkeys, err = repo.ListPasskeys(ctx, uuid.NewString()); err != nil || len(passkeys) != 0 {
+			t.Fatalf("expected no passkeys, got %+v, %v", passkeys, err)
+		}
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		repo := newRepo(t)
+		_, err := repo.GetUserByPhone(context.Background(), "+62821111121")
+		if !errors.Is(err, repository.ErrUserNotFound) {
+			t.Fatalf("expected ErrUserNotFound, got %v", err)
+		}
+	})
+}
+
+func newUser(phone string) repository.RegisterUser {
+	return repository.RegisterUser{
+		ID:       uuid.NewString(),
+		Phone:    phone,
+		Name:     "John",
+		Password: "hash",
+	}
+}
+
+func mustRegister(t *testing.T, repo repository.RepositoryInterface, input repository.RegisterUser) {
+	t.Helper()
+	if _, err := repo.RegisterUser(context.Background(), input); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,110 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"sync"
+
+	"github.com/lib/pq"
+)
+
+// stmtCache holds the statements for the fixed queries in query.go. They are
+// prepared lazily on first use and reused afterwards; database/sql takes care
+// of preparing them again on every pooled connection that runs them.
+type stmtCache struct {
+	db    *sql.DB
+	mu    sync.RWMutex
+	stmts map[string]*sql.Stmt
+}
+
+func newStmtCache(db *sql.DB) *stmtCache {
+	return &stmtCache{
+		db:    db,
+		stmts: make(map[string]*sql.Stmt),
+	}
+}
+
+func (c *stmtCache) get(ctx context.Context, query string) (*sql.Stmt, error) {
+	c.mu.RLock()
+	stmt, ok := c.stmts[query]
+	c.mu.RUnlock()
+	if ok {
+		return stmt, nil
+	}
+
+	// Preparing is a round trip to the server, so it must not hold up the
+	// lookups of other queries. Concurrent callers may prepare the same query;
+	// the first one to finish wins and the others close theirs.
+	prepareCtx, span := tracer.Start(ctx, "repository.prepare")
+	stmt, err := c.db.PrepareContext(prepareCtx, query)
+	endSpan(span, err)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cached, ok := c.stmts[query]; ok {
+		_ = stmt.Close()
+		return cached, nil
+	}
+	c.stmts[query] = stmt
+	return stmt, nil
+}
+
+// invalidate drops stmt from the cache so the next get prepares it again.
+// It is a no-op when another caller already replaced the statement.
+func (c *stmtCache) invalidate(query string, stmt *sql.Stmt) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.stmts[query] == stmt {
+		delete(c.stmts, query)
+		_ = stmt.Close()
+	}
+}
+
+// run executes fn with the cached statement for query. When the failure shows
+// the statement never ran on the server (broken connection, or the server no
+// longer knows the prepared statement), it is prepared again and fn retried once.
+func (c *stmtCache) run(ctx context.Context, query string, fn func(stmt *sql.Stmt) error) error {
+	stmt, err := c.get(ctx, query)
+	if err != nil {
+		return err
+	}
+	err = fn(stmt)
+	if !isStaleStmtError(err) {
+		return err
+	}
+
+	c.invalidate(query, stmt)
+	stmt, err = c.get(ctx, query)
+	if err != nil {
+		return err
+	}
+	return fn(stmt)
+}
+
+func (c *stmtCache) close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var errs []error
+	for query, stmt := range c.stmts {
+		errs = append(errs, stmt.Close())
+		delete(c.stmts, query)
+	}
+	return errors.Join(errs...)
+}
+
+func isStaleStmtError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, driver.ErrBadConn) {
+		return true
+	}
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "26000"
+}
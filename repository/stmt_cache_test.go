@@ -0,0 +1,284 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// countingDriver is a minimal database/sql driver that answers every query with
+// a single user row and counts the server round-trips a real Postgres
+// connection would need: one each for Parse (prepare), Execute and Close.
+type countingDriver struct {
+	roundTrips atomic.Int64
+	prepares   atomic.Int64
+
+	mu sync.Mutex
+	// failNext makes the next statement execution fail with this error.
+	failNext error
+	// prepareGate, when set, holds prepares until it is closed.
+	prepareGate chan struct{}
+}
+
+func (d *countingDriver) failWith(err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.failNext = err
+}
+
+func (d *countingDriver) Open(string) (driver.Conn, error) {
+	return &countingConn{d: d}, nil
+}
+
+type countingConn struct {
+	d *countingDriver
+}
+
+func (c *countingConn) Prepare(query string) (driver.Stmt, error) {
+	c.d.mu.Lock()
+	gate := c.d.prepareGate
+	c.d.mu.Unlock()
+	if gate != nil {
+		<-gate
+	}
+	c.d.roundTrips.Add(1)
+	c.d.prepares.Add(1)
+	return &countingStmt{d: c.d}, nil
+}
+
+func (c *countingConn) Close() error { return nil }
+
+func (c *countingConn) Begin() (driver.Tx, error) { return countingTx{}, nil }
+
+type countingTx struct{}
+
+func (countingTx) Commit() error   { return nil }
+func (countingTx) Rollback() error { return nil }
+
+type countingStmt struct {
+	d *countingDriver
+}
+
+func (s *countingStmt) Close() error {
+	s.d.roundTrips.Add(1)
+	return nil
+}
+
+func (s *countingStmt) NumInput() int { return -1 }
+
+func (s *countingStmt) takeFailure() error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+	err := s.d.failNext
+	s.d.failNext = nil
+	return err
+}
+
+func (s *countingStmt) Exec([]driver.Value) (driver.Result, error) {
+	s.d.roundTrips.Add(1)
+	if err := s.takeFailure(); err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (s *countingStmt) Query([]driver.Value) (driver.Rows, error) {
+	s.d.roundTrips.Add(1)
+	if err := s.takeFailure(); err != nil {
+		return nil, err
+	}
+	return &userRows{}, nil
+}
+
+type userRows struct {
+	done bool
+}
+
+func (r *userRows) Columns() []string {
+	return []string{"id", "phone", "name", "password", "email", "email_verified_at", "avatar_url", "locale",
+		"timezone", "success_login", "last_login_at", "version", "created_at", "updated_at"}
+}
+
+func (r *userRows) Close() error { return nil }
+
+func (r *userRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	dest[0] = "id"
+	dest[1] = "+62821111121"
+	dest[2] = "John"
+	dest[3] = "hash"
+	for i := 4; i <= 8; i++ {
+		dest[i] = nil
+	}
+	dest[9] = int64(0)
+	dest[10] = nil
+	dest[11] = int64(1)
+	dest[12] = time.Now()
+	dest[13] = nil
+	return nil
+}
+
+var driverSeq atomic.Int64
+
+func newCountingRepository(tb testing.TB) (*Repository, *countingDriver) {
+	d := &countingDriver{}
+	name := fmt.Sprintf("counting-%d", driverSeq.Add(1))
+	sql.Register(name, d)
+	db, err := sql.Open(name, "")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	repo := newRepository(db)
+	tb.Cleanup(func() {
+		_ = repo.Close()
+	})
+	return repo, d
+}
+
+func TestStmtCachePreparesOnce(t *testing.T) {
+	repo, d := newCountingRepository(t)
+	ctx := context.Background()
+
+	for i := 0; i < 5; i++ {
+		if _, err := repo.GetUserByPhone(ctx, "+62821111121"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got := d.prepares.Load(); got != 1 {
+		t.Fatalf("expected 1 prepare, got %d", got)
+	}
+}
+
+func TestStmtCacheRepreparesStaleStatement(t *testing.T) {
+	repo, d := newCountingRepository(t)
+	ctx := context.Background()
+
+	if _, err := repo.GetUserByPhone(ctx, "+62821111121"); err != nil {
+		t.Fatal(err)
+	}
+
+	d.failWith(&pq.Error{Code: "26000", Message: "prepared statement does not exist"})
+	user, err := repo.GetUserByPhone(ctx, "+62821111121")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Name != "John" {
+		t.Fatalf("unexpected user %+v", user)
+	}
+	if got := d.prepares.Load(); got != 2 {
+		t.Fatalf("expected statement to be prepared again, got %d prepares", got)
+	}
+}
+
+func TestStmtCacheLookupsDoNotWaitForPrepare(t *testing.T) {
+	repo, d := newCountingRepository(t)
+	repo.Db.SetMaxOpenConns(2)
+	ctx := context.Background()
+
+	if _, err := repo.stmts.get(ctx, qGetUserByPhone); err != nil {
+		t.Fatal(err)
+	}
+
+	gate := make(chan struct{})
+	d.mu.Lock()
+	d.prepareGate = gate
+	d.mu.Unlock()
+	prepared := make(chan error)
+	go func() {
+		_, err := repo.stmts.get(ctx, qGetUserByEmail)
+		prepared <- err
+	}()
+
+	looked := make(chan error)
+	go func() {
+		_, err := repo.stmts.get(ctx, qGetUserByPhone)
+		looked <- err
+	}()
+	select {
+	case err := <-looked:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("lookup of a cached statement waited for another prepare")
+	}
+
+	close(gate)
+	if err := <-prepared; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStmtCacheKeepsFirstOfConcurrentPrepares(t *testing.T) {
+	repo, _ := newCountingRepository(t)
+	repo.Db.SetMaxOpenConns(4)
+	ctx := context.Background()
+
+	stmts := make([]*sql.Stmt, 4)
+	var wg sync.WaitGroup
+	for i := range stmts {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			stmt, err := repo.stmts.get(ctx, qGetUserByPhone)
+			if err != nil {
+				t.Error(err)
+			}
+			stmts[i] = stmt
+		}(i)
+	}
+	wg.Wait()
+
+	for _, stmt := range stmts {
+		if stmt != stmts[0] {
+			t.Fatal("concurrent callers got different statements")
+		}
+	}
+}
+
+// BenchmarkGetUserByPhone compares the previous prepare/query/close per call
+// against the cached statement, reporting simulated server round-trips.
+func BenchmarkGetUserByPhone(b *testing.B) {
+	ctx := context.Background()
+
+	b.Run("prepare_per_call", func(b *testing.B) {
+		repo, d := newCountingRepository(b)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			stmt, err := repo.Db.PrepareContext(ctx, qGetUserByPhone)
+			if err != nil {
+				b.Fatal(err)
+			}
+			_, err = scanUser(stmt.QueryRowContext(ctx, "+62821111121"))
+			_ = stmt.Close()
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+		b.ReportMetric(float64(d.roundTrips.Load())/float64(b.N), "roundtrips/op")
+	})
+
+	b.Run("cached", func(b *testing.B) {
+		repo, d := newCountingRepository(b)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if _, err := repo.GetUserByPhone(ctx, "+62821111121"); err != nil {
+				b.Fatal(err)
+			}
+		}
+		b.ReportMetric(float64(d.roundTrips.Load())/float64(b.N), "roundtrips/op")
+	})
+}
@@ -0,0 +1,108 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+const (
+	maxTxAttempts = 3
+	txRetryDelay  = 20 * time.Millisecond
+
+	pgSerializationFailure = "40001"
+	pgDeadlockDetected     = "40P01"
+)
+
+// TxFunc receives a repository whose operations all run inside the same
+// transaction. It may be invoked more than once when the transaction is
+// retried, so it must not have side effects outside the repository.
+type TxFunc func(repo RepositoryInterface) error
+
+func isRetryableTxError(err error) bool {
+	switch pgErrorCode(err) {
+	case pgSerializationFailure, pgDeadlockDetected:
+		return true
+	}
+	return false
+}
+
+// retryTx runs attempt until it succeeds, fails with a non-retryable error or
+// maxTxAttempts is reached.
+func retryTx(ctx context.Context, attempt func() error) error {
+	var err error
+	for i := 1; i <= maxTxAttempts; i++ {
+		err = attempt()
+		if !isRetryableTxError(err) {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Duration(i) * txRetryDelay):
+		}
+	}
+	return err
+}
+
+// WithTx runs fn in a serializable transaction, committing when fn returns
+// nil and retrying on serialization failures and deadlocks. Calling WithTx on
+// a repository that is already scoped to a transaction joins it.
+func (r *Repository) WithTx(ctx context.Context, fn TxFunc) (err error) {
+	if r.tx != nil {
+		return fn(r)
+	}
+
+	ctx, span := tracer.Start(ctx, "repository.WithTx")
+	defer func() { endSpan(span, err) }()
+
+	return retryTx(ctx, func() error {
+		tx, err := r.Db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = tx.Rollback()
+		}()
+
+		if err = fn(&Repository{Db: r.Db, stmts: r.stmts, tx: tx}); err != nil {
+			return err
+		}
+		return tx.Commit()
+	})
+}
+
+// execInTx runs fn in the transaction the repository is scoped to, or in a new
+// transaction that is committed when fn succeeds.
+func (r *Repository) execInTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	if r.tx != nil {
+		return fn(r.tx)
+	}
+
+	tx, err := r.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	if err = fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// withStmt runs fn with the cached statement for query, bound to the
+// transaction when the repository is scoped to one.
+func (r *Repository) withStmt(ctx context.Context, query string, fn func(stmt *sql.Stmt) error) error {
+	if r.tx == nil {
+		return r.stmts.run(ctx, query, fn)
+	}
+
+	stmt, err := r.stmts.get(ctx, query)
+	if err != nil {
+		return err
+	}
+	return fn(r.tx.StmtContext(ctx, stmt))
+}
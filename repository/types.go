@@ -22,15 +22,172 @@ type RegisterUser struct {
 }
 
 type User struct {
-	UserID    string       `json:"userID" db:"id"`
-	Phone     string       `json:"phone" db:"phone"`
-	Name      string       `json:"name" db:"name"`
-	Password  string       `json:"password" db:"password"`
-	CreatedAt time.Time    `json:"createdAt" db:"created_at"`
-	UpdatedAt sql.NullTime `json:"updatedAt" db:"updated_at"`
+	UserID          string         `json:"userID" db:"id"`
+	Phone           string         `json:"phone" db:"phone"`
+	Name            string         `json:"name" db:"name"`
+	Password        string         `json:"password" db:"password"`
+	Email           sql.NullString `json:"email" db:"email"`
+	EmailVerifiedAt sql.NullTime   `json:"emailVerifiedAt" db:"email_verified_at"`
+	AvatarURL       sql.NullString `json:"avatarUrl" db:"avatar_url"`
+	Locale          sql.NullString `json:"locale" db:"locale"`
+	Timezone        sql.NullString `json:"timezone" db:"timezone"`
+	SuccessLogin    int64          `json:"successLogin" db:"success_login"`
+	LastLoginAt     sql.NullTime   `json:"lastLoginAt" db:"last_login_at"`
+	Version         int64          `json:"version" db:"version"`
+	CreatedAt       time.Time      `json:"createdAt" db:"created_at"`
+	UpdatedAt       sql.NullTime   `json:"updatedAt" db:"updated_at"`
 }
 
 type UpdateUser struct {
 	Phone string `db:"phone"`
 	Name  string `db:"name"`
+	// The nullable columns are left unchanged when nil and cleared when set
+	// to an invalid NullString. Changing the email resets its verification.
+	Email     *sql.NullString `db:"email"`
+	AvatarURL *sql.NullString `db:"avatar_url"`
+	Locale    *sql.NullString `db:"locale"`
+	Timezone  *sql.NullString `db:"timezone"`
+	// Version, when non-zero, is the version the caller last read; the
+	// update fails with ErrVersionConflict if the row changed since.
+	Version int64 `db:"version"`
+}
+
+type TOTP struct {
+	UserID string `db:"user_id"`
+	// Secret is base32 encoded; it has to be kept readable to check codes.
+	Secret      string       `db:"secret"`
+	ConfirmedAt sql.NullTime `db:"confirmed_at"`
+	// LastUsedStep is the time step of the last accepted code, codes of that
+	// or earlier steps are refused.
+	LastUsedStep int64 `db:"last_used_step"`
+}
+
+// MFAChallenge is issued after a correct password for a user with MFA and
+// is exchanged for a token together with a code.
+type MFAChallenge struct {
+	UserID    string    `db:"user_id"`
+	TokenHash string    `db:"token_hash"`
+	ExpiresAt time.Time `db:"expires_at"`
+}
+
+// Session is created at login. The access token carries its ID and is
+// refused once the session is revoked or expired.
+type Session struct {
+	SessionID  string    `db:"id"`
+	UserID     string    `db:"user_id"`
+	UserAgent  string    `db:"user_agent"`
+	IP         string    `db:"ip"`
+	DeviceName string    `db:"device_name"`
+	CreatedAt  time.Time `db:"created_at"`
+	LastSeenAt time.Time `db:"last_seen_at"`
+	ExpiresAt  time.Time `db:"expires_at"`
+}
+
+// SessionSeenInterval is how stale LastSeenAt must be before TouchSession
+// records a use again, so that authenticated requests do not all write.
+const SessionSeenInterval = time.Minute
+
+// Passkey is a WebAuthn credential registered by a user.
+type Passkey struct {
+	CredentialID    []byte   `db:"credential_id"`
+	UserID          string   `db:"user_id"`
+	PublicKey       []byte   `db:"public_key"`
+	AttestationType string   `db:"attestation_type"`
+	Transports      []string `db:"transports"`
+	AAGUID          []byte   `db:"aaguid"`
+	SignCount       int64    `db:"sign_count"`
+	BackupEligible  bool     `db:"backup_eligible"`
+	BackupState     bool     `db:"backup_state"`
+	// CloneWarning is set once the authenticator reported a sign count that
+	// did not increase, hinting that the key was copied.
+	CloneWarning bool         `db:"clone_warning"`
+	CreatedAt    time.Time    `db:"created_at"`
+	LastUsedAt   sql.NullTime `db:"last_used_at"`
+}
+
+const (
+	CeremonyRegistration = "registration"
+	CeremonyLogin        = "login"
+)
+
+// WebAuthnChallenge keeps the state of a registration or login ceremony
+// between its two requests. It is keyed by the challenge, which the client
+// sends back inside the signed client data.
+type WebAuthnChallenge struct {
+	Challenge string `db:"challenge"`
+	Ceremony  string `db:"ceremony"`
+	// UserID is only set for registrations; passkey logins start without
+	// knowing the user.
+	UserID      sql.NullString `db:"user_id"`
+	SessionData []byte         `db:"session_data"`
+	ExpiresAt   time.Time      `db:"expires_at"`
+}
+
+// LoginOTP is a one-time code texted to a phone for logging in without a
+// password. Requests for numbers no user has are recorded as well, without
+// a user, so that they count against the same limits.
+type LoginOTP struct {
+	ID        string         `db:"id"`
+	Phone     string         `db:"phone"`
+	UserID    sql.NullString `db:"user_id"`
+	CodeHash  string         `db:"code_hash"`
+	Attempts  int            `db:"attempts"`
+	ExpiresAt time.Time      `db:"expires_at"`
+}
+
+// OAuthClient is an application users log in to with their account through
+// OpenID Connect.
+type OAuthClient struct {
+	ClientID string `db:"id"`
+	// SecretHash is not set for public clients, such as single page and
+	// mobile apps, which cannot keep a secret and rely on PKCE alone.
+	SecretHash   sql.NullString `db:"secret_hash"`
+	Name         string         `db:"name"`
+	RedirectURIs []string       `db:"redirect_uris"`
+	// OwnerID is the user who registered the client.
+	OwnerID   string    `db:"owner_id"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
+// MachineClient is a backend job or service that gets tokens for itself,
+// without a user, through the client credentials grant.
+type MachineClient struct {
+	ClientID   string `db:"id"`
+	SecretHash string `db:"secret_hash"`
+	Name       string `db:"name"`
+	// Scopes are the scopes the client may ask tokens for.
+	Scopes []string `db:"scopes"`
+	// CreatedBy is the admin who created the client.
+	CreatedBy string    `db:"created_by"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
+// AuthorizationCode is handed to a client through the redirect after the
+// user consented and is exchanged once for tokens.
+type AuthorizationCode struct {
+	CodeHash    string `db:"code_hash"`
+	ClientID    string `db:"client_id"`
+	UserID      string `db:"user_id"`
+	RedirectURI string `db:"redirect_uri"`
+	// Scope is space separated, as in OAuth requests.
+	Scope string `db:"scope"`
+	Nonce string `db:"nonce"`
+	// CodeChallenge is the S256 PKCE challenge the code verifier has to
+	// match.
+	CodeChallenge string    `db:"code_challenge"`
+	ExpiresAt     time.Time `db:"expires_at"`
+}
+
+// OAuthConsent records the scopes a user granted a client.
+type OAuthConsent struct {
+	UserID   string   `db:"user_id"`
+	ClientID string   `db:"client_id"`
+	Scopes   []string `db:"scopes"`
+}
+
+type EmailVerification struct {
+	UserID    string    `db:"user_id"`
+	Email     string    `db:"email"`
+	TokenHash string    `db:"token_hash"`
+	ExpiresAt time.Time `db:"expires_at"`
 }
@@ -2,6 +2,8 @@ package transport
 
 import (
 	"github.com/SawitProRecruitment/UserService/handler"
+	"github.com/SawitProRecruitment/UserService/internal"
+	"github.com/SawitProRecruitment/UserService/model"
 	"github.com/labstack/echo/v4"
 )
 
@@ -10,9 +12,45 @@ type API struct {
 	Router  *echo.Echo
 }
 
-func RegisterHandler(e *echo.Echo, handler handler.HandlerInterface) {
+func RegisterHandler(e *echo.Echo, handler handler.HandlerInterface, tokens TokenStore, cfg internal.Config) {
+	auth := AuthMiddleware(tokens, cfg.SessionCookie)
+	clientAuth := ClientAuthMiddleware(tokens)
+	machineAuth := MachineAuthMiddleware(tokens)
+	forwardAuth := ForwardAuthMiddleware(tokens, cfg.SessionCookie)
 	e.POST("/user", handler.Register)
-	e.PUT("/user", handler.UpdateUser, AuthMiddleware)
+	e.PUT("/user", handler.UpdateUser, auth)
+	e.PATCH("/user", handler.PatchUser, auth)
+	e.POST("/user/email/verification", handler.RequestEmailVerification, auth)
+	e.POST("/user/email/verify", handler.VerifyEmail)
+	e.POST("/user/mfa/totp", handler.EnrollTOTP, auth)
+	e.POST("/user/mfa/totp/confirm", handler.ConfirmTOTP, auth)
+	e.POST("/user/passkeys/challenge", handler.BeginPasskeyRegistration, auth)
+	e.POST("/user/passkeys", handler.FinishPasskeyRegistration, auth)
+	e.GET("/user/sessions", handler.ListSessions, auth)
+	e.DELETE("/user/sessions", handler.RevokeOtherSessions, auth)
+	e.DELETE("/user/sessions/:id", handler.RevokeSession, auth)
 	e.POST("/login", handler.Login)
-	e.GET("/profile", handler.GetProfile, AuthMiddleware)
+	e.POST("/login/mfa", handler.LoginMFA)
+	e.POST("/login/passkey/challenge", handler.BeginPasskeyLogin, RateLimitMiddleware(cfg.WebAuthn.LoginRateLimit))
+	e.POST("/login/passkey", handler.FinishPasskeyLogin)
+	if cfg.SMS.Enabled() {
+		e.POST("/login/otp/request", handler.RequestLoginOTP)
+		e.POST("/login/otp/verify", handler.VerifyLoginOTP)
+	}
+	e.GET("/profile", handler.GetProfile, auth)
+	e.POST("/oauth/clients", handler.RegisterOAuthClient, auth)
+	e.GET("/oauth/authorize", handler.Authorize, auth)
+	e.POST("/oauth/authorize", handler.ApproveAuthorization, auth)
+	e.POST("/oauth/token", handler.IssueOAuthToken)
+	e.POST("/oauth/revoke", handler.RevokeOAuthToken)
+	e.POST("/oauth/introspect", handler.IntrospectToken)
+	e.GET("/userinfo", handler.UserInfo, clientAuth)
+	e.POST("/userinfo", handler.UserInfo, clientAuth)
+	e.GET("/.well-known/openid-configuration", handler.OpenIDConfiguration)
+	e.GET("/.well-known/jwks.json", handler.JWKS)
+	e.POST("/admin/machine-clients", handler.CreateMachineClient, auth)
+	e.GET("/admin/machine-clients", handler.ListMachineClients, auth)
+	e.DELETE("/admin/machine-clients/:id", handler.DeleteMachineClient, auth)
+	e.GET("/auth/verify", handler.VerifyForwardAuth, forwardAuth)
+	e.GET("/users/:id", handler.GetUser, machineAuth, RequireScope(model.ScopeUsersRead))
 }
@@ -0,0 +1,129 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/SawitProRecruitment/UserService/internal"
+	"github.com/SawitProRecruitment/UserService/model"
+	"github.com/SawitProRecruitment/UserService/repository"
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	authv3 "github.com/envoyproxy/go-control-plane/envoy/service/auth/v3"
+	typev3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+	rpcstatus "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ExtAuthzStore is the part of the repository ExtAuthzServer needs.
+type ExtAuthzStore interface {
+	SessionStore
+	GetUserByID(ctx context.Context, id string) (repository.User, error)
+}
+
+// ExtAuthzServer implements the Check API of the Envoy ext_authz filter,
+// for services of the mesh to authenticate requests with like
+// AuthMiddleware. Allowed requests reach the service with the user in
+// x-user-* headers, as sent by the forward-auth endpoint.
+type ExtAuthzServer struct {
+	authv3.UnimplementedAuthorizationServer
+
+	store    ExtAuthzStore
+	adminIDs []string
+	cookies  internal.SessionCookie
+}
+
+// NewExtAuthzServer returns a server checking sessions and users with store;
+// adminIDs are the users with the admin role. Session cookies are accepted
+// as configured by cookies, with the same CSRF check as AuthMiddleware.
+func NewExtAuthzServer(store ExtAuthzStore, adminIDs []string, cookies internal.SessionCookie) *ExtAuthzServer {
+	return &ExtAuthzServer{store: store, adminIDs: adminIDs, cookies: cookies}
+}
+
+// identityHeaders are always replaced, so that clients cannot pass their
+// own.
+var identityHeaders = []string{"x-user-id", "x-user-phone", "x-user-roles"}
+
+func (s *ExtAuthzServer) Check(ctx context.Context, req *authv3.CheckRequest) (*authv3.CheckResponse, error) {
+	// Envoy passes header names in lower case.
+	request := req.GetAttributes().GetRequest().GetHttp()
+	headers := request.GetHeaders()
+	tokenString := strings.TrimPrefix(headers["authorization"], "Bearer ")
+	accept, csrfFailed := userToken, false
+	if tokenString == "" && s.cookies.Enabled {
+		cookies := &http.Request{Header: http.Header{"Cookie": {headers["cookie"]}}}
+		if cookie, err := cookies.Cookie(model.SessionCookie); err == nil {
+			tokenString = cookie.Value
+			accept = func(claims *model.Claims) bool {
+				if !userToken(claims) {
+					return false
+				}
+				csrfFailed = !csrfVerified(request.GetMethod(), headers[strings.ToLower(model.CSRFHeader)], s.cookies, claims)
+				return !csrfFailed
+			}
+		}
+	}
+
+	claims, code := authenticate(ctx, tokenString, accept, touchSession(s.store))
+	if csrfFailed {
+		return forbidden("invalid CSRF token"), nil
+	}
+	if code == http.StatusInternalServerError {
+		return nil, status.Error(codes.Internal, "checking the token failed")
+	}
+	if claims == nil {
+		return denied(), nil
+	}
+	user, err := s.store.GetUserByID(ctx, claims.UserID)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		return denied(), nil
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, "looking up the user failed")
+	}
+
+	values := []string{user.UserID, user.Phone, strings.Join(model.UserRoles(user.UserID, s.adminIDs), ",")}
+	set := make([]*corev3.HeaderValueOption, len(identityHeaders))
+	for i, name := range identityHeaders {
+		set[i] = &corev3.HeaderValueOption{
+			Header:       &corev3.HeaderValue{Key: name, Value: values[i]},
+			AppendAction: corev3.HeaderValueOption_OVERWRITE_IF_EXISTS_OR_ADD,
+		}
+	}
+	return &authv3.CheckResponse{
+		Status: &rpcstatus.Status{Code: int32(codes.OK)},
+		HttpResponse: &authv3.CheckResponse_OkResponse{
+			OkResponse: &authv3.OkHttpResponse{Headers: set},
+		},
+	}, nil
+}
+
+// forbidden refuses a request of a known user, which logging in again would
+// not help with.
+func forbidden(reason string) *authv3.CheckResponse {
+	return &authv3.CheckResponse{
+		Status: &rpcstatus.Status{Code: int32(codes.PermissionDenied), Message: reason},
+		HttpResponse: &authv3.CheckResponse_DeniedResponse{
+			DeniedResponse: &authv3.DeniedHttpResponse{
+				Status: &typev3.HttpStatus{Code: typev3.StatusCode_Forbidden},
+				Body:   reason,
+			},
+		},
+	}
+}
+
+func denied() *authv3.CheckResponse {
+	return &authv3.CheckResponse{
+		Status: &rpcstatus.Status{Code: int32(codes.Unauthenticated)},
+		HttpResponse: &authv3.CheckResponse_DeniedResponse{
+			DeniedResponse: &authv3.DeniedHttpResponse{
+				Status: &typev3.HttpStatus{Code: typev3.StatusCode_Unauthorized},
+				Headers: []*corev3.HeaderValueOption{{
+					Header: &corev3.HeaderValue{Key: "www-authenticate", Value: "Bearer"},
+				}},
+			},
+		},
+	}
+}
@@ -0,0 +1,165 @@
+package transport
+
+import (
+	"context"
+	"crypto/rsa"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SawitProRecruitment/UserService/internal"
+	"github.com/SawitProRecruitment/UserService/model"
+	"github.com/SawitProRecruitment/UserService/repository"
+	"github.com/dgrijalva/jwt-go"
+	authv3 "github.com/envoyproxy/go-control-plane/envoy/service/auth/v3"
+	typev3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// newExtAuthzClient serves an ExtAuthzServer in process and returns a client
+// of it.
+func newExtAuthzClient(t *testing.T, store ExtAuthzStore, adminIDs []string, cookies internal.SessionCookie) authv3.AuthorizationClient {
+	t.Helper()
+	loadPublicKey = func() (*rsa.PublicKey, error) { return internal.SigningKey("unit_test") }
+	t.Cleanup(func() { loadPublicKey = internal.LoadPublicKey })
+
+	lis := bufconn.Listen(1 << 20)
+	server := grpc.NewServer()
+	authv3.RegisterAuthorizationServer(server, NewExtAuthzServer(store, adminIDs, cookies))
+	go func() { _ = server.Serve(lis) }()
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	return authv3.NewAuthorizationClient(conn)
+}
+
+func checkRequest(method string, headers map[string]string) *authv3.CheckRequest {
+	return &authv3.CheckRequest{Attributes: &authv3.AttributeContext{
+		Request: &authv3.AttributeContext_Request{
+			Http: &authv3.AttributeContext_HttpRequest{Method: method, Path: "/reports", Headers: headers},
+		},
+	}}
+}
+
+func TestExtAuthz(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewMemoryRepository()
+	userID, err := repo.RegisterUser(ctx, repository.RegisterUser{Phone: "+62821111121", Name: "John", Password: "hash"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = repo.CreateSession(ctx, repository.Session{SessionID: "session", UserID: userID, ExpiresAt: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sign := func(claims *model.Claims) string {
+		t.Helper()
+		claims.ExpiresAt = time.Now().Add(time.Hour).Unix()
+		token, err := internal.SignToken(claims, "unit_test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	token := sign(&model.Claims{Phone: "+62821111121", SessionID: "session"})
+	cookies := internal.SessionCookie{Enabled: true, CSRFSecret: strings.Repeat("s", 32)}
+	client := newExtAuthzClient(t, repo, []string{userID}, cookies)
+	withoutCookies := newExtAuthzClient(t, repo, []string{userID}, internal.SessionCookie{})
+	cookie := "theme=dark; " + model.SessionCookie + "=" + token
+	csrf := model.CSRFToken(cookies.CSRFSecret, "session")
+
+	for name, test := range map[string]struct {
+		method  string
+		headers map[string]string
+	}{
+		"bearer":                 {"POST", map[string]string{"authorization": "Bearer " + token}},
+		"cookie":                 {"GET", map[string]string{"cookie": cookie}},
+		"cookie with CSRF token": {"POST", map[string]string{"cookie": cookie, "x-csrf-token": csrf}},
+	} {
+		t.Run("allows tokens in "+name, func(t *testing.T) {
+			resp, err := client.Check(ctx, checkRequest(test.method, test.headers))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if codes.Code(resp.GetStatus().GetCode()) != codes.OK {
+				t.Fatalf("expected OK, got %v", resp.GetStatus())
+			}
+			got := map[string]string{}
+			for _, header := range resp.GetOkResponse().GetHeaders() {
+				got[header.GetHeader().GetKey()] = header.GetHeader().GetValue()
+			}
+			if got["x-user-id"] != userID || got["x-user-phone"] != "+62821111121" || got["x-user-roles"] != "user,admin" {
+				t.Fatalf("unexpected identity headers %v", got)
+			}
+		})
+	}
+
+	clientToken := sign(&model.Claims{StandardClaims: jwt.StandardClaims{Subject: userID}, SessionID: "session", ClientID: "inventory"})
+	for name, headers := range map[string]map[string]string{
+		"no token":        {},
+		"invalid token":   {"authorization": "Bearer not-a-token"},
+		"client token":    {"authorization": "Bearer " + clientToken},
+		"unknown session": {"authorization": "Bearer " + sign(&model.Claims{Phone: "+62821111121", SessionID: "unknown"})},
+	} {
+		t.Run("denies "+name, func(t *testing.T) {
+			resp, err := client.Check(ctx, checkRequest("GET", headers))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if codes.Code(resp.GetStatus().GetCode()) != codes.Unauthenticated ||
+				resp.GetDeniedResponse().GetStatus().GetCode() != typev3.StatusCode_Unauthorized {
+				t.Fatalf("expected a 401 denial, got %v", resp)
+			}
+		})
+	}
+
+	for name, headers := range map[string]map[string]string{
+		"without CSRF header":           {"cookie": cookie},
+		"with the CSRF token elsewhere": {"cookie": cookie + "; " + model.CSRFCookie + "=" + csrf},
+		"with another CSRF token":       {"cookie": cookie, "x-csrf-token": model.CSRFToken(cookies.CSRFSecret, "other")},
+	} {
+		t.Run("forbids cookie POST "+name, func(t *testing.T) {
+			resp, err := client.Check(ctx, checkRequest("POST", headers))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if codes.Code(resp.GetStatus().GetCode()) != codes.PermissionDenied ||
+				resp.GetDeniedResponse().GetStatus().GetCode() != typev3.StatusCode_Forbidden {
+				t.Fatalf("expected a 403 denial, got %v", resp)
+			}
+		})
+	}
+
+	t.Run("denies cookies while disabled", func(t *testing.T) {
+		resp, err := withoutCookies.Check(ctx, checkRequest("GET", map[string]string{"cookie": cookie}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if codes.Code(resp.GetStatus().GetCode()) != codes.Unauthenticated {
+			t.Fatalf("expected a denial, got %v", resp)
+		}
+	})
+
+	t.Run("denies revoked sessions", func(t *testing.T) {
+		if err := repo.RevokeSession(ctx, userID, "session"); err != nil {
+			t.Fatal(err)
+		}
+		resp, err := client.Check(ctx, checkRequest("GET", map[string]string{"authorization": token}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if codes.Code(resp.GetStatus().GetCode()) != codes.Unauthenticated {
+			t.Fatalf("expected a denial, got %v", resp)
+		}
+	})
+}
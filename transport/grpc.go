@@ -0,0 +1,285 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/SawitProRecruitment/UserService/handler"
+	"github.com/SawitProRecruitment/UserService/model"
+	userv1 "github.com/SawitProRecruitment/UserService/proto/user/v1"
+	"github.com/labstack/echo/v4"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// UserServiceServer implements the gRPC UserService with the handlers of the
+// REST API, so that both validate, keep sessions and fail alike. Calls of
+// methods needing a user have to pass AuthInterceptor first.
+type UserServiceServer struct {
+	userv1.UnimplementedUserServiceServer
+
+	handler handler.HandlerInterface
+	echo    *echo.Echo
+}
+
+// NewUserServiceServer returns a server answering calls with handler.
+func NewUserServiceServer(handler handler.HandlerInterface) *UserServiceServer {
+	return &UserServiceServer{handler: handler, echo: echo.New()}
+}
+
+// publicMethods are the methods AuthInterceptor lets through without a
+// token, like the routes without AuthMiddleware.
+var publicMethods = []string{
+	userv1.UserService_Register_FullMethodName,
+	userv1.UserService_Login_FullMethodName,
+}
+
+type claimsKey struct{}
+
+// AuthInterceptor checks the token in the authorization metadata of calls
+// like AuthMiddleware, except for Register and Login. Refused tokens fail
+// with Unauthenticated.
+func AuthInterceptor(sessions SessionStore) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, next grpc.UnaryHandler) (interface{}, error) {
+		for _, method := range publicMethods {
+			if info.FullMethod == method {
+				return next(ctx, req)
+			}
+		}
+
+		tokenString := ""
+		if values := metadata.ValueFromIncomingContext(ctx, "authorization"); len(values) > 0 {
+			tokenString = strings.TrimPrefix(values[0], "Bearer ")
+		}
+		claims, code := authenticate(ctx, tokenString, userToken, touchSession(sessions))
+		if code == http.StatusInternalServerError {
+			return nil, status.Error(codes.Internal, "checking the token failed")
+		}
+		if claims == nil {
+			return nil, status.Error(codes.Unauthenticated, "a valid token is required")
+		}
+		return next(context.WithValue(ctx, claimsKey{}, claims), req)
+	}
+}
+
+func (s *UserServiceServer) Register(ctx context.Context, req *userv1.RegisterRequest) (*userv1.RegisterResponse, error) {
+	var resp struct {
+		Data struct {
+			UserID string `json:"user_id"`
+		} `json:"data"`
+	}
+	_, err := s.call(ctx, s.handler.Register, model.RegisterUserReq{
+		Phone:    req.GetPhone(),
+		Name:     req.GetName(),
+		Password: req.GetPassword(),
+	}, nil, &resp)
+	if err != nil {
+		return nil, err
+	}
+	return &userv1.RegisterResponse{UserId: resp.Data.UserID}, nil
+}
+
+func (s *UserServiceServer) Login(ctx context.Context, req *userv1.LoginRequest) (*userv1.LoginResponse, error) {
+	var resp struct {
+		Token       string `json:"token"`
+		MFARequired bool   `json:"mfa_required"`
+		MFAToken    string `json:"mfa_token"`
+		ExpiresIn   int32  `json:"expires_in"`
+	}
+	header, err := s.call(ctx, s.handler.Login, model.LoginRequest{
+		Identifier: req.GetIdentifier(),
+		Password:   req.GetPassword(),
+		DeviceName: req.GetDeviceName(),
+	}, nil, &resp)
+	if err != nil {
+		return nil, err
+	}
+	// With session cookies enabled the token is only in the cookie.
+	if resp.Token == "" {
+		for _, cookie := range (&http.Response{Header: header}).Cookies() {
+			if cookie.Name == model.SessionCookie {
+				resp.Token = cookie.Value
+			}
+		}
+	}
+	return &userv1.LoginResponse{
+		Token:       resp.Token,
+		MfaRequired: resp.MFARequired,
+		MfaToken:    resp.MFAToken,
+		ExpiresIn:   resp.ExpiresIn,
+	}, nil
+}
+
+func (s *UserServiceServer) GetProfile(ctx context.Context, _ *userv1.GetProfileRequest) (*userv1.Profile, error) {
+	return s.profile(ctx, s.handler.GetProfile, nil, nil)
+}
+
+func (s *UserServiceServer) UpdateUser(ctx context.Context, req *userv1.UpdateUserRequest) (*userv1.Profile, error) {
+	header := http.Header{}
+	if req.GetVersion() > 0 {
+		header.Set("If-Match", strconv.Quote(strconv.FormatInt(req.GetVersion(), 10)))
+	}
+	return s.profile(ctx, s.handler.UpdateUser, model.UpdateUserReq{
+		Phone:     req.GetPhone(),
+		Name:      req.GetName(),
+		Email:     req.GetEmail(),
+		AvatarURL: req.GetAvatarUrl(),
+		Locale:    req.GetLocale(),
+		Timezone:  req.GetTimezone(),
+	}, header)
+}
+
+// profile calls a handler answering with the profile of the user and its
+// ETag.
+func (s *UserServiceServer) profile(ctx context.Context, h echo.HandlerFunc, body interface{}, header http.Header) (*userv1.Profile, error) {
+	var resp struct {
+		Data model.GetProfileResp `json:"data"`
+	}
+	respHeader, err := s.call(ctx, h, body, header, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	profile := &userv1.Profile{
+		Name:          resp.Data.Name,
+		Phone:         resp.Data.Phone,
+		Email:         resp.Data.Email,
+		EmailVerified: resp.Data.EmailVerified,
+		AvatarUrl:     resp.Data.AvatarURL,
+		Locale:        resp.Data.Locale,
+		Timezone:      resp.Data.Timezone,
+	}
+	if resp.Data.LastLoginAt != nil {
+		profile.LastLoginAt = timestamppb.New(*resp.Data.LastLoginAt)
+	}
+	if etag, err := strconv.Unquote(respHeader.Get("ETag")); err == nil {
+		profile.Version, _ = strconv.ParseInt(etag, 10, 64)
+	}
+	return profile, nil
+}
+
+// call runs h for a JSON request with body and decodes its answer into
+// resp, or turns it into an error. It returns the headers of the answer.
+func (s *UserServiceServer) call(ctx context.Context, h echo.HandlerFunc, body interface{}, header http.Header, resp interface{}) (http.Header, error) {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "encoding the request failed")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "/", bytes.NewReader(payload))
+	if err != nil {
+		return nil, status.Error(codes.Internal, "building the request failed")
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	// Sessions record the client like for REST calls.
+	if values := metadata.ValueFromIncomingContext(ctx, "user-agent"); len(values) > 0 {
+		req.Header.Set("User-Agent", values[0])
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		req.RemoteAddr = p.Addr.String()
+	}
+
+	rec := &responseRecorder{header: http.Header{}}
+	c := s.echo.NewContext(req, rec)
+	if claims, ok := ctx.Value(claimsKey{}).(*model.Claims); ok {
+		c.Set("claims", claims)
+	}
+	if err = h(c); err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	if rec.status >= http.StatusBadRequest {
+		return nil, statusError(rec.status, rec.body.Bytes())
+	}
+	if err = json.Unmarshal(rec.body.Bytes(), resp); err != nil {
+		return nil, status.Error(codes.Internal, "decoding the response failed")
+	}
+	return rec.header, nil
+}
+
+// statusError maps the error answer of a handler to a gRPC status, with the
+// rejected fields of validation errors as BadRequest details.
+func statusError(httpStatus int, body []byte) error {
+	var resp struct {
+		Error  string            `json:"error"`
+		Fields model.FieldErrors `json:"fields"`
+	}
+	_ = json.Unmarshal(body, &resp)
+
+	code := grpcCode(httpStatus)
+	if code == codes.Internal {
+		return status.Error(code, "internal error")
+	}
+	if resp.Error == "" {
+		resp.Error = strings.ToLower(http.StatusText(httpStatus))
+	}
+	st := status.New(code, resp.Error)
+	if len(resp.Fields) == 0 {
+		return st.Err()
+	}
+	violations := make([]*errdetails.BadRequest_FieldViolation, 0, len(resp.Fields))
+	for field, reason := range resp.Fields {
+		violations = append(violations, &errdetails.BadRequest_FieldViolation{Field: field, Description: reason})
+	}
+	if detailed, err := st.WithDetails(&errdetails.BadRequest{FieldViolations: violations}); err == nil {
+		st = detailed
+	}
+	return st.Err()
+}
+
+func grpcCode(httpStatus int) codes.Code {
+	switch httpStatus {
+	case http.StatusBadRequest, http.StatusUnsupportedMediaType:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusConflict:
+		return codes.AlreadyExists
+	case http.StatusPreconditionFailed:
+		return codes.FailedPrecondition
+	case http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	default:
+		return codes.Internal
+	}
+}
+
+// responseRecorder keeps the answer of a handler called by
+// UserServiceServer.
+type responseRecorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (r *responseRecorder) Header() http.Header {
+	return r.header
+}
+
+func (r *responseRecorder) Write(p []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.body.Write(p)
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+}
@@ -0,0 +1,169 @@
+package transport
+
+import (
+	"context"
+	"crypto/rsa"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/SawitProRecruitment/UserService/handler"
+	"github.com/SawitProRecruitment/UserService/internal"
+	userv1 "github.com/SawitProRecruitment/UserService/proto/user/v1"
+	"github.com/SawitProRecruitment/UserService/repository"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// newUserServiceClient serves a UserServiceServer backed by repo in process
+// and returns a client of it.
+func newUserServiceClient(t *testing.T, repo repository.RepositoryInterface, cookies internal.SessionCookie) userv1.UserServiceClient {
+	t.Helper()
+	loadPublicKey = func() (*rsa.PublicKey, error) { return internal.SigningKey("unit_test") }
+	t.Cleanup(func() { loadPublicKey = internal.LoadPublicKey })
+
+	cfg := internal.Config{App: internal.AppConfig{Env: "unit_test"}, SessionCookie: cookies}
+	lis := bufconn.Listen(1 << 20)
+	server := grpc.NewServer(grpc.UnaryInterceptor(AuthInterceptor(repo)))
+	userv1.RegisterUserServiceServer(server, NewUserServiceServer(handler.NewServer(cfg, handler.NewServerOptions{Repository: repo})))
+	go func() { _ = server.Serve(lis) }()
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	return userv1.NewUserServiceClient(conn)
+}
+
+func expectCode(t *testing.T, err error, code codes.Code) *status.Status {
+	t.Helper()
+	st, _ := status.FromError(err)
+	if st.Code() != code {
+		t.Fatalf("expected %v, got %v", code, err)
+	}
+	return st
+}
+
+func TestUserService(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewMemoryRepository()
+	client := newUserServiceClient(t, repo, internal.SessionCookie{})
+
+	registered, err := client.Register(ctx, &userv1.RegisterRequest{Phone: "+62821111121", Name: "John", Password: "Test123456!"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if registered.GetUserId() == "" {
+		t.Fatal("expected the ID of the new user")
+	}
+
+	t.Run("rejects invalid registrations with the fields", func(t *testing.T) {
+		_, err := client.Register(ctx, &userv1.RegisterRequest{Phone: "0821", Name: "John", Password: "Test123456!"})
+		st := expectCode(t, err, codes.InvalidArgument)
+		var violations []*errdetails.BadRequest_FieldViolation
+		for _, detail := range st.Details() {
+			if badRequest, ok := detail.(*errdetails.BadRequest); ok {
+				violations = badRequest.GetFieldViolations()
+			}
+		}
+		if len(violations) != 1 || violations[0].GetField() != "phone" {
+			t.Fatalf("expected a violation of phone, got %v", violations)
+		}
+	})
+
+	t.Run("rejects registered phones", func(t *testing.T) {
+		_, err := client.Register(ctx, &userv1.RegisterRequest{Phone: "+62821111121", Name: "Jane", Password: "Test123456!"})
+		expectCode(t, err, codes.AlreadyExists)
+	})
+
+	t.Run("rejects wrong passwords", func(t *testing.T) {
+		_, err := client.Login(ctx, &userv1.LoginRequest{Identifier: "+62821111121", Password: "Wrong123456!"})
+		expectCode(t, err, codes.Unauthenticated)
+	})
+
+	login, err := client.Login(ctx, &userv1.LoginRequest{Identifier: "+62821111121", Password: "Test123456!", DeviceName: "inventory"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if login.GetToken() == "" || login.GetMfaRequired() {
+		t.Fatalf("expected a token, got %v", login)
+	}
+	authCtx := metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+login.GetToken())
+
+	for name, ctx := range map[string]context.Context{
+		"no token":      ctx,
+		"invalid token": metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer not-a-token"),
+	} {
+		t.Run("refuses calls with "+name, func(t *testing.T) {
+			_, err := client.GetProfile(ctx, &userv1.GetProfileRequest{})
+			expectCode(t, err, codes.Unauthenticated)
+		})
+	}
+
+	profile, err := client.GetProfile(authCtx, &userv1.GetProfileRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if profile.GetName() != "John" || profile.GetPhone() != "+62821111121" || profile.GetLastLoginAt() == nil || profile.GetVersion() == 0 {
+		t.Fatalf("unexpected profile %v", profile)
+	}
+
+	t.Run("updates the user", func(t *testing.T) {
+		updated, err := client.UpdateUser(authCtx, &userv1.UpdateUserRequest{Name: "Johnny", Version: profile.GetVersion()})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if updated.GetName() != "Johnny" || updated.GetVersion() == profile.GetVersion() {
+			t.Fatalf("unexpected profile %v", updated)
+		}
+	})
+
+	t.Run("rejects updates of stale versions", func(t *testing.T) {
+		_, err := client.UpdateUser(authCtx, &userv1.UpdateUserRequest{Name: "Jack", Version: profile.GetVersion()})
+		expectCode(t, err, codes.FailedPrecondition)
+	})
+
+	t.Run("refuses revoked sessions", func(t *testing.T) {
+		sessions, err := repo.ListSessions(ctx, registered.GetUserId())
+		if err != nil || len(sessions) != 1 {
+			t.Fatalf("expected one session, got %v, %v", sessions, err)
+		}
+		if sessions[0].DeviceName != "inventory" {
+			t.Fatalf("expected the device name of the login, got %q", sessions[0].DeviceName)
+		}
+		if err = repo.RevokeSession(ctx, registered.GetUserId(), sessions[0].SessionID); err != nil {
+			t.Fatal(err)
+		}
+		_, err = client.GetProfile(authCtx, &userv1.GetProfileRequest{})
+		expectCode(t, err, codes.Unauthenticated)
+	})
+}
+
+func TestUserServiceLoginWithSessionCookies(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewMemoryRepository()
+	client := newUserServiceClient(t, repo, internal.SessionCookie{Enabled: true, CSRFSecret: strings.Repeat("s", 32)})
+
+	if _, err := client.Register(ctx, &userv1.RegisterRequest{Phone: "+62821111121", Name: "John", Password: "Test123456!"}); err != nil {
+		t.Fatal(err)
+	}
+	// Calls are no browsers: they still get the token REST only sets as
+	// the session cookie.
+	login, err := client.Login(ctx, &userv1.LoginRequest{Identifier: "+62821111121", Password: "Test123456!"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	authCtx := metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+login.GetToken())
+	if _, err = client.GetProfile(authCtx, &userv1.GetProfileRequest{}); err != nil {
+		t.Fatal(err)
+	}
+}
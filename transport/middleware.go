@@ -1,40 +1,289 @@
 package transport
 
 import (
+	"context"
+	"crypto/subtle"
 	"errors"
 	"github.com/SawitProRecruitment/UserService/internal"
 	"github.com/SawitProRecruitment/UserService/model"
+	"github.com/SawitProRecruitment/UserService/repository"
 	"github.com/dgrijalva/jwt-go"
 	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/labstack/echo/otelecho"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/time/rate"
+	"log"
 	"net/http"
+	"slices"
+	"strings"
 )
 
-func AuthMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
-	return func(c echo.Context) error {
-		tokenString := c.Request().Header.Get("Authorization")
-		if tokenString == "" {
-			return c.JSON(http.StatusForbidden, map[string]struct{}{})
+// SessionStore is the part of the repository AuthMiddleware checks sessions
+// with.
+type SessionStore interface {
+	TouchSession(ctx context.Context, sessionID string) (repository.Session, error)
+}
+
+// MachineClientStore is the part of the repository MachineAuthMiddleware
+// checks clients with.
+type MachineClientStore interface {
+	GetMachineClient(ctx context.Context, clientID string) (repository.MachineClient, error)
+}
+
+// TokenStore is what the middlewares of RegisterHandler need.
+type TokenStore interface {
+	SessionStore
+	MachineClientStore
+}
+
+// AuthMiddleware accepts tokens signed with our key whose session is still
+// live, and records that the session was seen. Tokens issued to OAuth
+// clients are refused, as are tokens without a session, which cannot be
+// revoked. With cookies enabled, browsers may send the token in the session
+// cookie instead, but then have to pass the CSRF check for requests changing
+// state.
+func AuthMiddleware(sessions SessionStore, cookies internal.SessionCookie) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			tokenString, fromCookie := sessionToken(c, cookies)
+			accept, csrfFailed := userToken, false
+			if fromCookie {
+				accept = func(claims *model.Claims) bool {
+					if !userToken(claims) {
+						return false
+					}
+					csrfFailed = !csrfVerified(c.Request().Method, c.Request().Header.Get(model.CSRFHeader), cookies, claims)
+					return !csrfFailed
+				}
+			}
+			claims, status := authenticate(c.Request().Context(), tokenString, accept, touchSession(sessions))
+			if csrfFailed {
+				return c.JSON(http.StatusForbidden, map[string]string{"error": "invalid CSRF token"})
+			}
+			if claims == nil {
+				return c.JSON(status, map[string]struct{}{})
+			}
+			c.Set("claims", claims)
+
+			return next(c)
 		}
-		publicKey, err := internal.LoadPublicKey()
-		if err != nil {
-			return c.JSON(http.StatusInternalServerError, map[string]struct{}{})
+	}
+}
+
+// ForwardAuthMiddleware checks tokens like AuthMiddleware for the
+// forward-auth endpoint. Refused tokens are not answered here but leave the
+// claims unset, so that the handler can send the user to the login page.
+// The proxy asks with GET whatever the request it checks is, so the CSRF
+// check of session cookies goes by the method it forwards instead, which
+// has to be sent for anything but requests authenticated by a bearer token.
+func ForwardAuthMiddleware(sessions SessionStore, cookies internal.SessionCookie) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			tokenString, fromCookie := sessionToken(c, cookies)
+			accept, csrfFailed := userToken, false
+			if fromCookie {
+				accept = func(claims *model.Claims) bool {
+					if !userToken(claims) {
+						return false
+					}
+					csrfFailed = !csrfVerified(forwardedMethod(c), c.Request().Header.Get(model.CSRFHeader), cookies, claims)
+					return !csrfFailed
+				}
+			}
+			claims, status := authenticate(c.Request().Context(), tokenString, accept, touchSession(sessions))
+			if csrfFailed {
+				return c.JSON(http.StatusForbidden, map[string]string{"error": "invalid CSRF token"})
+			}
+			if status == http.StatusInternalServerError {
+				return c.JSON(status, map[string]struct{}{})
+			}
+			c.Set("claims", claims)
+			return next(c)
 		}
-		token, err := jwt.ParseWithClaims(tokenString, &model.Claims{}, func(token *jwt.Token) (interface{}, error) {
-			return publicKey, nil
-		})
-		if err != nil {
-			if errors.Is(err, jwt.ErrSignatureInvalid) {
-				return c.JSON(http.StatusForbidden, map[string]struct{}{})
-			}
-			return c.JSON(http.StatusForbidden, map[string]struct{}{})
+	}
+}
+
+// ClientAuthMiddleware is AuthMiddleware for the endpoints OAuth clients
+// call, accepting only tokens issued to clients on behalf of a user.
+func ClientAuthMiddleware(sessions SessionStore) echo.MiddlewareFunc {
+	return tokenMiddleware(func(claims *model.Claims) bool {
+		return claims.ClientID != "" && claims.SessionID != ""
+	}, touchSession(sessions))
+}
+
+// MachineAuthMiddleware accepts the tokens machine clients get for
+// themselves, which have no session. Instead the client has to still
+// exist, so that deleting it revokes its tokens.
+func MachineAuthMiddleware(clients MachineClientStore) echo.MiddlewareFunc {
+	return tokenMiddleware(func(claims *model.Claims) bool {
+		return claims.ClientID != "" && claims.SessionID == "" && claims.Subject == claims.ClientID
+	}, func(ctx context.Context, claims *model.Claims) error {
+		_, err := clients.GetMachineClient(ctx, claims.ClientID)
+		return err
+	})
+}
+
+// RequireScope lets through requests whose token, as set by one of the
+// middlewares above, was granted scope.
+func RequireScope(scope string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			claims, _ := c.Get("claims").(*model.Claims)
+			if claims == nil || !slices.Contains(strings.Fields(claims.Scope), scope) {
+				c.Response().Header().Set("WWW-Authenticate", `Bearer error="insufficient_scope", scope="`+scope+`"`)
+				return c.JSON(http.StatusForbidden, map[string]string{
+					"error":             "insufficient_scope",
+					"error_description": "the " + scope + " scope is required",
+				})
+			}
+			return next(c)
 		}
-		if !token.Valid {
-			return c.JSON(http.StatusForbidden, map[string]struct{}{})
+	}
+}
+
+// RateLimitMiddleware answers requests beyond limit with 429 Too Many
+// Requests, counting them per client IP.
+func RateLimitMiddleware(limit internal.RateLimit) echo.MiddlewareFunc {
+	return middleware.RateLimiterWithConfig(middleware.RateLimiterConfig{
+		Store: middleware.NewRateLimiterMemoryStoreWithConfig(middleware.RateLimiterMemoryStoreConfig{
+			Rate:  rate.Limit(limit.Rate),
+			Burst: limit.Burst,
+		}),
+		DenyHandler: func(c echo.Context, identifier string, err error) error {
+			c.Response().Header().Set("Retry-After", "1")
+			return c.JSON(http.StatusTooManyRequests, map[string]string{"error": "too many requests, try again later"})
+		},
+	})
+}
+
+func userToken(claims *model.Claims) bool {
+	return claims.ClientID == "" && claims.SessionID != ""
+}
+
+func touchSession(sessions SessionStore) func(ctx context.Context, claims *model.Claims) error {
+	return func(ctx context.Context, claims *model.Claims) error {
+		session, err := sessions.TouchSession(ctx, claims.SessionID)
+		claims.UserID = session.UserID
+		return err
+	}
+}
+
+// tokenMiddleware lets through requests whose bearer token authenticate
+// accepts.
+func tokenMiddleware(accept func(claims *model.Claims) bool, check func(ctx context.Context, claims *model.Claims) error) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			claims, status := authenticate(c.Request().Context(), bearerToken(c), accept, check)
+			if claims == nil {
+				return c.JSON(status, map[string]struct{}{})
+			}
+			c.Set("claims", claims)
+
+			return next(c)
 		}
+	}
+}
+
+// bearerToken returns the token of the Authorization header. The Bearer
+// scheme is optional for our own clients, which predate OAuth.
+func bearerToken(c echo.Context) string {
+	return strings.TrimPrefix(c.Request().Header.Get("Authorization"), "Bearer ")
+}
+
+// sessionToken returns the bearer token, or else the one of the session
+// cookie of browsers when enabled, telling which.
+func sessionToken(c echo.Context, cookies internal.SessionCookie) (tokenString string, fromCookie bool) {
+	if tokenString = bearerToken(c); tokenString != "" || !cookies.Enabled {
+		return tokenString, false
+	}
+	cookie, err := c.Cookie(model.SessionCookie)
+	if err != nil || cookie.Value == "" {
+		return "", false
+	}
+	return cookie.Value, true
+}
+
+// forwardedMethod is the method of the request a proxy checks, as sent by
+// Traefik or, configured to, by nginx. It is empty when neither sent it.
+func forwardedMethod(c echo.Context) string {
+	if method := c.Request().Header.Get("X-Forwarded-Method"); method != "" {
+		return method
+	}
+	return c.Request().Header.Get("X-Original-Method")
+}
+
+// csrfVerified tells whether a request with method may be made by a browser
+// on behalf of its user: either it does not change state, or it carries the
+// CSRF token of the session of claims in header, which other sites cannot
+// read. Unknown methods, including none, need the token.
+func csrfVerified(method, header string, cookies internal.SessionCookie, claims *model.Claims) bool {
+	switch strings.ToUpper(method) {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	want := model.CSRFToken(cookies.CSRFSecret, claims.SessionID)
+	return subtle.ConstantTimeCompare([]byte(header), []byte(want)) == 1
+}
 
-		claims := token.Claims.(*model.Claims)
-		c.Set("claims", claims)
+// loadPublicKey is replaced by tests, which run outside the directory of
+// the key.
+var loadPublicKey = internal.LoadPublicKey
+
+// authenticate verifies the token, refuses ID tokens, lets accept decide
+// whether it is of the right kind and check whether it was revoked. It
+// returns the claims of accepted tokens, otherwise the status to answer with.
+func authenticate(ctx context.Context, tokenString string, accept func(claims *model.Claims) bool,
+	check func(ctx context.Context, claims *model.Claims) error) (*model.Claims, int) {
+	if tokenString == "" {
+		return nil, http.StatusForbidden
+	}
+	publicKey, err := loadPublicKey()
+	if err != nil {
+		return nil, http.StatusInternalServerError
+	}
+	token, err := jwt.ParseWithClaims(tokenString, &model.Claims{}, func(token *jwt.Token) (interface{}, error) {
+		return publicKey, nil
+	})
+	if err != nil || !token.Valid {
+		return nil, http.StatusForbidden
+	}
 
-		return next(c)
+	claims := token.Claims.(*model.Claims)
+	if claims.IDToken() || !accept(claims) {
+		return nil, http.StatusForbidden
 	}
+	if err = check(ctx, claims); err != nil {
+		if errors.Is(err, repository.ErrSessionNotFound) || errors.Is(err, repository.ErrOAuthNotFound) {
+			return nil, http.StatusForbidden
+		}
+		return nil, http.StatusInternalServerError
+	}
+	return claims, http.StatusOK
+}
+
+func TracingMiddleware(serviceName string) echo.MiddlewareFunc {
+	return otelecho.Middleware(serviceName)
+}
+
+// RequestLogger writes one line per request including the trace and span IDs
+// of the request span, so log lines can be correlated with exported traces.
+func RequestLogger() echo.MiddlewareFunc {
+	return middleware.RequestLoggerWithConfig(middleware.RequestLoggerConfig{
+		LogMethod:  true,
+		LogURI:     true,
+		LogStatus:  true,
+		LogLatency: true,
+		LogError:   true,
+		LogValuesFunc: func(c echo.Context, v middleware.RequestLoggerValues) error {
+			spanCtx := trace.SpanContextFromContext(c.Request().Context())
+			errMsg := ""
+			if v.Error != nil {
+				errMsg = v.Error.Error()
+			}
+			log.Printf("trace_id=%s span_id=%s method=%s uri=%s status=%d latency=%s error=%q",
+				spanCtx.TraceID(), spanCtx.SpanID(), v.Method, v.URI, v.Status, v.Latency, errMsg)
+			return nil
+		},
+	})
 }
@@ -0,0 +1,188 @@
+package transport
+
+import (
+	"context"
+	"crypto/rsa"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SawitProRecruitment/UserService/internal"
+	"github.com/SawitProRecruitment/UserService/model"
+	"github.com/SawitProRecruitment/UserService/repository"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/labstack/echo/v4"
+)
+
+func TestAuthMiddlewareSessionCookie(t *testing.T) {
+	loadPublicKey = func() (*rsa.PublicKey, error) { return internal.SigningKey("unit_test") }
+	t.Cleanup(func() { loadPublicKey = internal.LoadPublicKey })
+
+	ctx := context.Background()
+	repo := repository.NewMemoryRepository()
+	userID, err := repo.RegisterUser(ctx, repository.RegisterUser{Phone: "+62821111121", Name: "John", Password: "hash"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = repo.CreateSession(ctx, repository.Session{SessionID: "session", UserID: userID, ExpiresAt: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := internal.SignToken(&model.Claims{Phone: "+62821111121", SessionID: "session"}, "unit_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cookies := internal.SessionCookie{Enabled: true, CSRFSecret: strings.Repeat("s", 32)}
+	csrf := model.CSRFToken(cookies.CSRFSecret, "session")
+
+	serve := func(cookies internal.SessionCookie, method, path string, setup func(req *http.Request)) int {
+		e := echo.New()
+		ok := func(c echo.Context) error { return c.NoContent(http.StatusNoContent) }
+		e.GET("/profile", ok, AuthMiddleware(repo, cookies))
+		e.PUT("/user", ok, AuthMiddleware(repo, cookies))
+		e.GET("/auth/verify", func(c echo.Context) error {
+			if claims, _ := c.Get("claims").(*model.Claims); claims == nil {
+				return c.NoContent(http.StatusUnauthorized)
+			}
+			return c.NoContent(http.StatusNoContent)
+		}, ForwardAuthMiddleware(repo, cookies))
+
+		req := httptest.NewRequest(method, path, nil)
+		setup(req)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	withCookie := func(csrfCookie, csrfHeader string) func(req *http.Request) {
+		return func(req *http.Request) {
+			req.AddCookie(&http.Cookie{Name: model.SessionCookie, Value: token})
+			if csrfCookie != "" {
+				req.AddCookie(&http.Cookie{Name: model.CSRFCookie, Value: csrfCookie})
+			}
+			if csrfHeader != "" {
+				req.Header.Set(model.CSRFHeader, csrfHeader)
+			}
+		}
+	}
+
+	// forwarded adds the method of the request a proxy checks.
+	forwarded := func(header, method string, setup func(req *http.Request)) func(req *http.Request) {
+		return func(req *http.Request) {
+			setup(req)
+			req.Header.Set(header, method)
+		}
+	}
+
+	for name, test := range map[string]struct {
+		method, path string
+		setup        func(req *http.Request)
+		want         int
+	}{
+		"cookie on safe methods":                    {"GET", "/profile", withCookie("", ""), http.StatusNoContent},
+		"cookie with the CSRF token of the session": {"PUT", "/user", withCookie(csrf, csrf), http.StatusNoContent},
+		"cookie with the CSRF header alone":         {"PUT", "/user", withCookie("", csrf), http.StatusNoContent},
+		"cookie without CSRF header":                {"PUT", "/user", withCookie(csrf, ""), http.StatusForbidden},
+		"cookie with a planted CSRF cookie":         {"PUT", "/user", withCookie("planted", "planted"), http.StatusForbidden},
+		"cookie with the CSRF token of another session": {"PUT", "/user",
+			withCookie("", model.CSRFToken(cookies.CSRFSecret, "other")), http.StatusForbidden},
+		"bearer without CSRF": {"PUT", "/user", func(req *http.Request) { req.Header.Set("Authorization", "Bearer "+token) }, http.StatusNoContent},
+		"invalid cookie with valid CSRF": {"PUT", "/user", func(req *http.Request) {
+			req.AddCookie(&http.Cookie{Name: model.SessionCookie, Value: "not-a-token"})
+			req.Header.Set(model.CSRFHeader, csrf)
+		}, http.StatusForbidden},
+		"no token":                  {"GET", "/profile", func(req *http.Request) {}, http.StatusForbidden},
+		"forwarded GET with cookie": {"GET", "/auth/verify", forwarded("X-Forwarded-Method", "GET", withCookie("", "")), http.StatusNoContent},
+		"forwarded POST with cookie and CSRF": {"GET", "/auth/verify",
+			forwarded("X-Original-Method", "POST", withCookie("", csrf)), http.StatusNoContent},
+		"forwarded POST with cookie without CSRF header": {"GET", "/auth/verify",
+			forwarded("X-Forwarded-Method", "POST", withCookie(csrf, "")), http.StatusForbidden},
+		"forwarded with cookie without method": {"GET", "/auth/verify", withCookie("", ""), http.StatusForbidden},
+		"forwarded POST with bearer without CSRF": {"GET", "/auth/verify", forwarded("X-Forwarded-Method", "POST",
+			func(req *http.Request) { req.Header.Set("Authorization", "Bearer "+token) }), http.StatusNoContent},
+		"forwarded without token": {"GET", "/auth/verify", forwarded("X-Forwarded-Method", "POST", func(req *http.Request) {}),
+			http.StatusUnauthorized},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if got := serve(cookies, test.method, test.path, test.setup); got != test.want {
+				t.Fatalf("expected %d, got %d", test.want, got)
+			}
+		})
+	}
+
+	t.Run("cookie while disabled", func(t *testing.T) {
+		if got := serve(internal.SessionCookie{}, "GET", "/profile", withCookie("", "")); got != http.StatusForbidden {
+			t.Fatalf("expected %d, got %d", http.StatusForbidden, got)
+		}
+	})
+}
+
+func TestAuthMiddlewareRefusesIDTokens(t *testing.T) {
+	loadPublicKey = func() (*rsa.PublicKey, error) { return internal.SigningKey("unit_test") }
+	t.Cleanup(func() { loadPublicKey = internal.LoadPublicKey })
+
+	ctx := context.Background()
+	repo := repository.NewMemoryRepository()
+	userID, err := repo.RegisterUser(ctx, repository.RegisterUser{Phone: "+62821111121", Name: "John", Password: "hash"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = repo.CreateSession(ctx, repository.Session{SessionID: "session", UserID: userID, ExpiresAt: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// An OpenID Connect client hands its ID token on, carrying the session
+	// of the user it logged in.
+	idToken, err := internal.SignToken(&model.IDTokenClaims{
+		StandardClaims: jwt.StandardClaims{
+			Subject:   userID,
+			Audience:  "client",
+			ExpiresAt: time.Now().Add(time.Hour).Unix(),
+		},
+		AuthorizedParty: "client",
+		SessionID:       "session",
+	}, "unit_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := echo.New()
+	e.PUT("/user", func(c echo.Context) error { return c.NoContent(http.StatusNoContent) }, AuthMiddleware(repo, internal.SessionCookie{}))
+	req := httptest.NewRequest(http.MethodPut, "/user", nil)
+	req.Header.Set("Authorization", "Bearer "+idToken)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("expected 403, got %d", rec.Code)
+	}
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	e := echo.New()
+	e.POST("/login/passkey/challenge", func(c echo.Context) error {
+		return c.NoContent(http.StatusNoContent)
+	}, RateLimitMiddleware(internal.RateLimit{Rate: 0.001, Burst: 2}))
+
+	serve := func(ip string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/login/passkey/challenge", nil)
+		req.RemoteAddr = ip + ":1234"
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	for i := 0; i < 2; i++ {
+		if rec := serve("192.0.2.1"); rec.Code != http.StatusNoContent {
+			t.Fatalf("request %d: expected 204, got %d", i, rec.Code)
+		}
+	}
+	rec := serve("192.0.2.1")
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") == "" {
+		t.Fatalf("expected 429 with Retry-After, got %d %v", rec.Code, rec.Header())
+	}
+	if rec := serve("192.0.2.2"); rec.Code != http.StatusNoContent {
+		t.Fatalf("expected other addresses to be let through, got %d", rec.Code)
+	}
+}